@@ -0,0 +1,240 @@
+package main
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// adminCacheSamples is how many entries /admin/cache lists with their TTLs.
+const adminCacheSamples = 20
+
+// requireAdmin wraps h so that it is only served to requests with an
+// "Authorization: Bearer" header carrying the -admin-token. So that browsers
+// can open /admin, the token is also accepted as the password of basic
+// authentication, with any user name. Browsers send remembered basic
+// credentials with requests made by other sites too, so those are refused
+// anything but GET and HEAD when they come from another site.
+func (a *App) requireAdmin(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token, bearer := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		ok := bearer
+		if !ok {
+			_, token, ok = r.BasicAuth()
+		}
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(a.cfg.AdminToken)) != 1 {
+			w.Header().Add("WWW-Authenticate", `Bearer realm="admin"`)
+			w.Header().Add("WWW-Authenticate", `Basic realm="admin"`)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if !bearer && r.Method != http.MethodGet && r.Method != http.MethodHead && isCrossSite(r) {
+			http.Error(w, "Cross-site admin requests are not allowed; send the token as a bearer token", http.StatusForbidden)
+			return
+		}
+		w.Header().Set("Cache-Control", "no-store")
+		h(w, r)
+	}
+}
+
+// isCrossSite reports whether r was made by a page of another site, going by
+// the Sec-Fetch-Site header browsers send or, failing that, by the Origin.
+// Requests without either, as from curl, are not cross-site.
+func isCrossSite(r *http.Request) bool {
+	if site := r.Header.Get("Sec-Fetch-Site"); site != "" {
+		return site != "same-origin" && site != "none"
+	}
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return false
+	}
+	u, err := url.Parse(origin)
+	return err != nil || !strings.EqualFold(u.Host, r.Host)
+}
+
+// cacheSample is a cached key and how much longer it will be kept.
+type cacheSample struct {
+	Key        string `json:"key"`
+	TTLSeconds int    `json:"ttl_seconds"`
+}
+
+// cacheStatus is the JSON body of /admin/cache.
+type cacheStatus struct {
+	Backend string         `json:"backend"`
+	Entries int            `json:"entries"`
+	Stats   CacheStats     `json:"stats"`
+	ByKind  map[string]int `json:"by_kind"`
+	Samples []cacheSample  `json:"samples"`
+}
+
+// adminCacheHandler serves /admin/cache: how many entries are cached, per
+// source and kind of lookup, and the remaining TTL of the first few keys.
+func (a *App) adminCacheHandler(w http.ResponseWriter, r *http.Request) {
+	keys := a.cache.Keys()
+	sort.Strings(keys)
+
+	status := cacheStatus{
+		Backend: a.cfg.CacheBackend,
+		Entries: len(keys),
+		Stats:   a.cache.Stats(),
+		ByKind:  make(map[string]int),
+		Samples: []cacheSample{},
+	}
+	for _, key := range keys {
+		// Keys are "source:kind:id"; count them by "source:kind"
+		kind := key
+		if i := strings.LastIndex(key, ":"); i > 0 {
+			kind = key[:i]
+		}
+		status.ByKind[kind]++
+
+		if len(status.Samples) < adminCacheSamples {
+			if ttl, ok := a.cache.TTL(key); ok {
+				status.Samples = append(status.Samples, cacheSample{
+					Key:        key,
+					TTLSeconds: int(ttl.Round(time.Second) / time.Second),
+				})
+			}
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(status)
+}
+
+// adminFlushHandler serves POST /admin/cache/flush, which empties the cache
+// so that every following lookup goes upstream.
+func (a *App) adminFlushHandler(w http.ResponseWriter, r *http.Request) {
+	n := a.cache.Len()
+	a.cache.Flush()
+	a.logInfof("Admin: flushed %d cache entries", n)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		Flushed int `json:"flushed"`
+	}{n})
+}
+
+// adminTemplate renders /admin.
+var adminTemplate = template.Must(template.New("admin").Parse(`
+<!DOCTYPE html>
+<html lang="en">
+<head>
+    <meta charset="utf-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1">
+    <title>Admin</title>
+    <link rel="stylesheet" href="/static/style.css">
+</head>
+<body>
+    <main class="container">
+        <h1>Admin</h1>
+        <p class="footnote">As of {{.Now.Format "2006-01-02 15:04:05 MST"}}. Times below are in UTC.</p>
+
+        <h2>Upstream</h2>
+        <table class="dashboard">
+            <tr><th scope="row">Source</th><td>{{.Source}}</td></tr>
+            <tr><th scope="row">BGPView circuit breaker</th><td>{{if eq .Breaker "closed"}}<span class="badge badge-full">closed</span>{{else}}<span class="badge badge-none">{{.Breaker}}</span>{{end}}</td></tr>
+            <tr><th scope="row">Rate limited</th><td>{{if .RetryAfter}}<span class="badge badge-none">for another {{.RetryAfter}}</span>{{else}}no{{end}}{{if not .LastRateLimited.IsZero}} (last {{.LastRateLimited.UTC.Format "15:04:05"}}){{end}}</td></tr>
+            <tr><th scope="row">Requests in flight</th><td>{{.SlotsInUse}} of {{.Slots}}</td></tr>
+        </table>
+
+        <h2>Cache</h2>
+        <table class="dashboard">
+            <tr><th scope="row">Backend</th><td>{{.CacheBackend}}</td></tr>
+            <tr><th scope="row">Entries</th><td>{{.CacheEntries}}</td></tr>
+            <tr><th scope="row">Hits / misses</th><td>{{.CacheStats.Hits}} / {{.CacheStats.Misses}}{{with .HitRatio}} ({{.}} hits){{end}}</td></tr>
+            <tr><th scope="row">Stores / evictions</th><td>{{.CacheStats.Sets}} / {{.CacheStats.Evictions}}</td></tr>
+        </table>
+
+        <h2>Recent lookups</h2>
+        {{if .Lookups}}
+        <table class="dashboard">
+            <tr><th>Time</th><th>ASN</th><th>Result</th><th>Took</th></tr>
+            {{range .Lookups}}
+            <tr>
+                <td>{{.Time.UTC.Format "15:04:05"}}</td>
+                <td><a href="/?asn={{.ASN}}">AS{{.ASN}}</a></td>
+                <td>{{with .Error}}<span class="error-note">{{.}}</span>{{else}}{{.Prefixes}} IPv6 prefixes{{if .Cached}} (cached){{end}}{{end}}</td>
+                <td>{{.Duration}}</td>
+            </tr>
+            {{end}}
+        </table>
+        {{else}}
+        <p class="info">No lookups since the server started.</p>
+        {{end}}
+
+        <h2>Recent BGPView requests</h2>
+        {{if .Upstream}}
+        <table class="dashboard">
+            <tr><th>Time</th><th>Path</th><th>Result</th><th>Took</th></tr>
+            {{range .Upstream}}
+            <tr>
+                <td>{{.Time.UTC.Format "15:04:05"}}</td>
+                <td>{{.Path}}</td>
+                <td>{{with .Error}}<span class="error-note">{{.}}</span>{{else}}{{.Status}}{{end}}</td>
+                <td>{{.Duration}}</td>
+            </tr>
+            {{end}}
+        </table>
+        {{else}}
+        <p class="info">No requests to BGPView since the server started.</p>
+        {{end}}
+    </main>
+</body>
+</html>
+`))
+
+// adminHandler serves /admin, a page for operators to check on the service
+// at a glance: upstream health, the cache and the latest lookups and BGPView
+// requests, kept in memory since the server started.
+func (a *App) adminHandler(w http.ResponseWriter, r *http.Request) {
+	stats := a.cache.Stats()
+	data := struct {
+		Now             time.Time
+		Source          string
+		Breaker         string
+		RetryAfter      time.Duration
+		LastRateLimited time.Time
+		SlotsInUse      int
+		Slots           int
+		CacheBackend    string
+		CacheEntries    int
+		CacheStats      CacheStats
+		HitRatio        string
+		Lookups         []lookupEvent
+		Upstream        []upstreamEvent
+	}{
+		Now:             time.Now().UTC(),
+		Source:          a.source.Name(),
+		Breaker:         bgpViewBreaker.State(),
+		RetryAfter:      bgpViewRateLimit.RetryAfter().Round(time.Second),
+		LastRateLimited: bgpViewRateLimit.Last(),
+		SlotsInUse:      len(a.upstream.slots),
+		Slots:           cap(a.upstream.slots),
+		CacheBackend:    a.cfg.CacheBackend,
+		CacheEntries:    a.cache.Len(),
+		CacheStats:      stats,
+		Lookups:         a.recentLookups.recent(),
+		Upstream:        upstreamEvents.recent(),
+	}
+	if total := stats.Hits + stats.Misses; total > 0 {
+		data.HitRatio = fmt.Sprintf("%.0f%%", 100*float64(stats.Hits)/float64(total))
+	}
+
+	var buf bytes.Buffer
+	if err := adminTemplate.Execute(&buf, data); err != nil {
+		log.Printf("Failed to render admin page: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	buf.WriteTo(w)
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRequireAdminCrossSite(t *testing.T) {
+	a := newTestApp(t, http.NotFoundHandler(), "-admin-token", "secret")
+	router := a.newRouter()
+
+	tests := []struct {
+		name    string
+		method  string
+		bearer  bool
+		headers map[string]string
+		status  int
+	}{
+		{"basic from curl", http.MethodPost, false, nil, http.StatusOK},
+		{"basic same origin", http.MethodPost, false, map[string]string{"Sec-Fetch-Site": "same-origin"}, http.StatusOK},
+		{"basic cross site", http.MethodPost, false, map[string]string{"Sec-Fetch-Site": "cross-site"}, http.StatusForbidden},
+		{"basic same site", http.MethodPost, false, map[string]string{"Sec-Fetch-Site": "same-site"}, http.StatusForbidden},
+		{"basic foreign origin", http.MethodPost, false, map[string]string{"Origin": "https://evil.example"}, http.StatusForbidden},
+		{"basic own origin", http.MethodPost, false, map[string]string{"Origin": "http://example.com"}, http.StatusOK},
+		{"bearer cross site", http.MethodPost, true, map[string]string{"Sec-Fetch-Site": "cross-site"}, http.StatusOK},
+		{"basic cross site GET", http.MethodGet, false, map[string]string{"Sec-Fetch-Site": "cross-site"}, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := "/admin/cache/flush"
+			if tt.method == http.MethodGet {
+				path = "/admin/cache"
+			}
+			r := httptest.NewRequest(tt.method, path, nil)
+			if tt.bearer {
+				r.Header.Set("Authorization", "Bearer secret")
+			} else {
+				r.SetBasicAuth("admin", "secret")
+			}
+			for name, value := range tt.headers {
+				r.Header.Set(name, value)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, r)
+
+			if w.Code != tt.status {
+				t.Errorf("status = %d, want %d; body: %s", w.Code, tt.status, w.Body)
+			}
+		})
+	}
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// App is one configured instance of the service. It holds the settings, the
+// upstream client and its pacing, and the cache, template and per-client
+// limits that its handlers and lookups use, so that several can run in one
+// process, each configured its own way. The
+// circuit breaker and rate-limit tracking of BGPView stay process-wide,
+// since what BGPView tells one App holds for every App.
+type App struct {
+	cfg       *Config
+	verbosity logLevel // per -quiet and -verbose
+	client    *http.Client
+	// upstream paces the BGPView requests and bounds how many are in
+	// flight, per -upstream-min-interval, -upstream-burst and
+	// -max-upstream-concurrency.
+	upstream *upstreamLimiter
+	// source is where prefixes and AS details are looked up, per -source.
+	source PrefixLookup
+	cache  CacheBackend
+
+	// lookups deduplicates concurrent identical upstream lookups, keyed
+	// by the lookup's cache key, so that a burst of requests for the same
+	// ASN before the cache is populated results in one BGPView call.
+	lookups *flightGroup
+
+	// watchlist keeps the IPv6 status of the ASNs given with -watch for
+	// the dashboard. It is nil unless -watch is set.
+	watchlist *watcher
+
+	// recentLookups are the latest lookups on /, for /admin.
+	recentLookups *eventRing[lookupEvent]
+
+	// supportForms maps ASNs to their provider's support form, from
+	// -support-forms-file.
+	supportForms map[string]supportForm
+
+	// rirLinks are the RIR links of the no-IPv6 message, from
+	// -rir-links-file. Nil is defaultRIRLinks.
+	rirLinks []rirLink
+
+	// trustedProxies are the -trusted-proxies, whose X-Forwarded-For
+	// headers clientAddr believes.
+	trustedProxies []netip.Prefix
+
+	// asnAllowlist, when non-empty, is the only ASNs looked up, and
+	// asnBlocklist those refused, per -asn-allowlist and -asn-blocklist.
+	asnAllowlist, asnBlocklist asnSet
+
+	// refreshes limits forced refreshes, whoisQueries /whois queries and
+	// pings /reachability checks, per client address.
+	refreshes, whoisQueries, pings *refreshLimiter
+
+	// history records the IPv6 prefix count of every looked-up ASN so that
+	// a provider's own adoption trend can be shown. It is nil unless
+	// -db-file is set.
+	history *historyStore
+
+	// template renders the web interface: the built-in one, or the one
+	// parsed from -template-file
+	template *template.Template
+}
+
+// newApp sets up an App from cfg: its BGPView client, which reads fixtures
+// in offline mode, its cache backend, limits, history and -watch list.
+func newApp(cfg *Config) (*App, error) {
+	verbosity, err := logLevelFor(cfg)
+	if err != nil {
+		return nil, err
+	}
+	cfg.BGPViewBase = strings.TrimSuffix(cfg.BGPViewBase, "/")
+	cfg.RIPEstatBase = strings.TrimSuffix(cfg.RIPEstatBase, "/")
+	cfg.PublicURL = strings.TrimSuffix(cfg.PublicURL, "/")
+	if cfg.MaxBodySize <= 0 {
+		return nil, fmt.Errorf("-max-body-size must be positive")
+	}
+	if cfg.WriteTimeout > 0 && cfg.WriteTimeout <= cfg.RequestTimeout {
+		log.Printf("WARNING: -write-timeout %v is not above -request-timeout %v, so slow lookups may be cut off without an error page", cfg.WriteTimeout, cfg.RequestTimeout)
+	}
+	a := &App{
+		cfg:       cfg,
+		verbosity: verbosity,
+		client: &http.Client{
+			Timeout:   upstreamTimeout,
+			Transport: newUpstreamTransport(),
+		},
+		upstream:      newUpstreamLimiter(cfg.MaxUpstream, cfg.UpstreamMinInterval, cfg.UpstreamBurst),
+		lookups:       &flightGroup{},
+		recentLookups: newEventRing[lookupEvent](recentEventsSize),
+		refreshes:     &refreshLimiter{interval: refreshInterval},
+		whoisQueries:  &refreshLimiter{interval: whoisInterval},
+		pings:         &refreshLimiter{interval: pingInterval},
+	}
+
+	if err := a.loadTemplate(); err != nil {
+		return nil, fmt.Errorf("invalid template: %w", err)
+	}
+
+	if a.asnAllowlist, err = parseASNSet(cfg.ASNAllowlist); err != nil {
+		return nil, fmt.Errorf("invalid -asn-allowlist: %w", err)
+	}
+	if a.asnBlocklist, err = parseASNSet(cfg.ASNBlocklist); err != nil {
+		return nil, fmt.Errorf("invalid -asn-blocklist: %w", err)
+	}
+
+	if cfg.FixturesDir != "" {
+		a.useFixtures(cfg.FixturesDir)
+	}
+
+	sources := make(map[string]PrefixLookup)
+	source, err := a.newSource(cfg.Source, sources)
+	if err != nil {
+		return nil, fmt.Errorf("invalid -source: %w", err)
+	}
+	a.source = source
+	if cfg.RIRSources != "" {
+		regional, err := a.newRegionalSource(source, cfg.RIRSources, sources)
+		if err != nil {
+			return nil, fmt.Errorf("invalid -rir-sources: %w", err)
+		}
+		a.source = regional
+	}
+
+	proxies, err := parseTrustedProxies(cfg.TrustedProxies)
+	if err != nil {
+		return nil, fmt.Errorf("invalid -trusted-proxies: %w", err)
+	}
+	a.trustedProxies = proxies
+
+	if cfg.SupportFormsFile != "" {
+		forms, err := loadSupportForms(cfg.SupportFormsFile)
+		if err != nil {
+			return nil, fmt.Errorf("invalid -support-forms-file: %w", err)
+		}
+		a.supportForms = forms
+	}
+
+	if cfg.RIRLinksFile != "" {
+		if a.rirLinks, err = loadRIRLinks(cfg.RIRLinksFile); err != nil {
+			return nil, fmt.Errorf("invalid -rir-links-file: %w", err)
+		}
+	}
+
+	cache, err := newCacheBackend(cfg.CacheBackend, cfg.RedisAddr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to set up cache: %w", err)
+	}
+	if a.verbosity >= logVerbose {
+		cache = loggingCache{cache}
+	}
+	a.cache = cache
+
+	if cfg.DBFile != "" {
+		if a.history, err = openHistory(cfg.DBFile); err != nil {
+			return nil, fmt.Errorf("failed to enable prefix history: %w", err)
+		}
+	}
+
+	if err := a.useWatchList(cfg.Watch, cfg.WatchInterval, cfg.WatchStateFile); err != nil {
+		return nil, fmt.Errorf("invalid -watch: %w", err)
+	}
+	if cfg.WebhookURL != "" {
+		if err := checkWebhookURL(cfg.WebhookURL); err != nil {
+			return nil, fmt.Errorf("invalid -webhook-url: %w", err)
+		}
+		if a.watchlist == nil {
+			return nil, fmt.Errorf("-webhook-url needs -watch")
+		}
+	}
+	return a, nil
+}
+
+// newSource returns the PrefixLookup named name, creating it unless it is
+// already in sources, so that -source and -rir-sources share one instance
+// of each.
+func (a *App) newSource(name string, sources map[string]PrefixLookup) (PrefixLookup, error) {
+	if source, ok := sources[name]; ok {
+		return source, nil
+	}
+	var source PrefixLookup
+	switch name {
+	case sourceBGPView:
+		source = bgpViewSource{app: a}
+	case sourceRIPEstat:
+		source = ripeStatSource{app: a}
+	case sourceBGPTools:
+		// bgp.tools blocks clients that don't say how to reach their
+		// operator
+		if bgpToolsContact(a.cfg.Contact) == "" {
+			return nil, fmt.Errorf("%s needs -contact set to your email address, which bgp.tools requires in the User-Agent", sourceBGPTools)
+		}
+		a.cfg.BGPToolsBase = strings.TrimSuffix(a.cfg.BGPToolsBase, "/")
+		source = newBGPToolsSource(a)
+	default:
+		return nil, fmt.Errorf("unknown source %q (want %s, %s or %s)", name, sourceBGPView, sourceBGPTools, sourceRIPEstat)
+	}
+	sources[name] = source
+	return source, nil
+}
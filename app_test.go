@@ -0,0 +1,96 @@
+package main
+
+import (
+	"flag"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// bgpViewASN19625 is a BGPView /asn/19625 response.
+const bgpViewASN19625 = `{"status":"ok","data":{"asn":19625,"name":"BLACKBOX","description_short":"Blackbox","country_code":"US","rir_allocation":{"rir_name":"ARIN","country_code":"US"}}}`
+
+// bgpViewPrefixes19625 is a BGPView /asn/19625/prefixes response.
+const bgpViewPrefixes19625 = `{"status":"ok","data":{"ipv4_prefixes":[{"prefix":"192.0.2.0/24"}],"ipv6_prefixes":[{"prefix":"2001:db8::/32","country_code":"US"},{"prefix":"2001:db8:1::/48","country_code":"US"}]}}`
+
+// newTestApp returns an App configured with args whose BGPView is upstream,
+// served by an httptest.Server, without pacing unless args ask for it. The
+// process-wide protection of BGPView is reset to its defaults, with quick
+// retries, for the duration of the test.
+func newTestApp(t *testing.T, upstream http.Handler, args ...string) *App {
+	t.Helper()
+	srv := httptest.NewServer(upstream)
+	t.Cleanup(srv.Close)
+
+	breaker, rateLimit, wait := bgpViewBreaker, bgpViewRateLimit, retryBaseWait
+	bgpViewBreaker = &circuitBreaker{threshold: 5, window: time.Minute, cooldown: 30 * time.Second}
+	bgpViewRateLimit = &rateLimitTracker{}
+	retryBaseWait = time.Millisecond
+	t.Cleanup(func() {
+		bgpViewBreaker, bgpViewRateLimit, retryBaseWait = breaker, rateLimit, wait
+	})
+
+	cfg := &Config{}
+	fs := flag.NewFlagSet(t.Name(), flag.ContinueOnError)
+	defineFlags(fs, cfg)
+	if err := fs.Parse(append([]string{"-bgpview-base", srv.URL, "-upstream-min-interval", "0"}, args...)); err != nil {
+		t.Fatal(err)
+	}
+	a, err := newApp(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return a
+}
+
+// bgpViewStub serves the BGPView responses in bodies, keyed by path, and
+// 404s everything else.
+func bgpViewStub(bodies map[string]string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, ok := bodies[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(body))
+	})
+}
+
+func TestAppsConfiguredIndependently(t *testing.T) {
+	links := filepath.Join(t.TempDir(), "rir-links.json")
+	if err := os.WriteFile(links, []byte(`[{"name":"ARIN","url":"https://arin.example/ipv6"}]`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	custom := newTestApp(t, http.NotFoundHandler(),
+		"-rir-links-file", links, "-max-upstream-concurrency", "2", "-upstream-min-interval", "1s", "-upstream-burst", "3")
+	plain := newTestApp(t, http.NotFoundHandler())
+
+	if got := cap(custom.upstream.slots); got != 2 {
+		t.Errorf("configured App has %d upstream slots, want 2", got)
+	}
+	if got := cap(plain.upstream.slots); got != defaultMaxUpstream {
+		t.Errorf("default App has %d upstream slots, want %d", got, defaultMaxUpstream)
+	}
+	if p := custom.upstream.pace; p.interval != time.Second || p.burst != 3 {
+		t.Errorf("configured App paces %v with bursts of %d, want 1s and 3", p.interval, p.burst)
+	}
+	if p := plain.upstream.pace; p.interval != 0 {
+		t.Errorf("default test App paces %v, want no pacing", p.interval)
+	}
+
+	message := func(a *App) string {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		return generateIPv6RequestMessage("19625", nil, locale{Lang: "en"}, false, a.messageOptionsFromRequest(r))
+	}
+	if msg := message(custom); !strings.Contains(msg, "arin.example") || strings.Contains(msg, "ripe.net") {
+		t.Errorf("configured App's message lacks its -rir-links-file links:\n%s", msg)
+	}
+	if msg := message(plain); strings.Contains(msg, "arin.example") || !strings.Contains(msg, "ripe.net") {
+		t.Errorf("default App's message lacks the built-in links:\n%s", msg)
+	}
+}
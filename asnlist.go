@@ -0,0 +1,83 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// asnSpan is an inclusive range of AS numbers.
+type asnSpan struct {
+	First, Last uint32
+}
+
+// asnSet is a list of AS numbers and ranges, as given to -asn-allowlist and
+// -asn-blocklist.
+type asnSet []asnSpan
+
+// errASNNotPermitted is returned for ASNs excluded by the allow or block
+// list.
+var errASNNotPermitted = errors.New("this server is configured not to look up this ASN")
+
+// parseASNSet parses a comma-separated list of ASNs and ranges such as
+// "AS64500,65000-65100". Each ASN may be in any form normalizeASN accepts.
+func parseASNSet(list string) (asnSet, error) {
+	var set asnSet
+	for _, item := range strings.Split(list, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		low, high, isRange := strings.Cut(item, "-")
+		if !isRange {
+			high = low
+		}
+		first, err := parseASNBound(low)
+		if err != nil {
+			return nil, err
+		}
+		last, err := parseASNBound(high)
+		if err != nil {
+			return nil, err
+		}
+		if first > last {
+			return nil, fmt.Errorf("invalid ASN range %q: start is after end", item)
+		}
+		set = append(set, asnSpan{First: first, Last: last})
+	}
+	return set, nil
+}
+
+func parseASNBound(s string) (uint32, error) {
+	asn, err := normalizeASN(s)
+	if err != nil {
+		return 0, err
+	}
+	n, err := strconv.ParseUint(asn, 10, 32)
+	return uint32(n), err
+}
+
+// Contains reports whether asn, in asplain form, is in the set.
+func (s asnSet) Contains(asn string) bool {
+	n, err := strconv.ParseUint(asn, 10, 32)
+	if err != nil {
+		return false
+	}
+	for _, span := range s {
+		if uint32(n) >= span.First && uint32(n) <= span.Last {
+			return true
+		}
+	}
+	return false
+}
+
+// checkASNPermitted returns errASNNotPermitted if asn is outside the
+// -asn-allowlist or inside the -asn-blocklist.
+func (a *App) checkASNPermitted(asn string) error {
+	if len(a.asnAllowlist) > 0 && !a.asnAllowlist.Contains(asn) || a.asnBlocklist.Contains(asn) {
+		return fmt.Errorf("AS%s: %w", asn, errASNNotPermitted)
+	}
+	return nil
+}
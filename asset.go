@@ -0,0 +1,265 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// sourceIRR is the cache namespace for data queried from the IRR.
+const sourceIRR = "irr"
+
+// defaultIRRServer is the IRRd whois server AS-SETs are expanded with unless
+// -irr-server names another.
+const defaultIRRServer = "whois.radb.net:43"
+
+// maxASSetLength bounds AS-SET input. Hierarchical names such as
+// "AS65000:AS-CUSTOMERS" can be long, but not unboundedly so.
+const maxASSetLength = 64
+
+// maxASSetMembers is how many members of an AS-SET have their prefixes
+// looked up, so that a huge set can't use up the BGPView rate limit.
+const maxASSetMembers = 25
+
+// asSetPattern matches an AS-SET name: "AS-" and a name, optionally within
+// the hierarchy of an ASN or another set, like "AS65000:AS-CUSTOMERS".
+var asSetPattern = regexp.MustCompile(`^(?i:(AS[0-9]+:)*AS-[A-Z0-9][A-Z0-9_-]*(:(AS-[A-Z0-9][A-Z0-9_-]*|AS[0-9]+))*)$`)
+
+// errASSetInput is returned by normalizeASN for input that names an AS-SET
+// rather than a single AS number.
+var errASSetInput = errors.New("input is an AS-SET")
+
+// normalizeASSet validates input as an AS-SET name and returns it in upper
+// case, as IRR objects are conventionally written.
+func normalizeASSet(input string) (string, bool) {
+	set := strings.TrimSpace(input)
+	if len(set) > maxASSetLength || !asSetPattern.MatchString(set) {
+		return "", false
+	}
+	return strings.ToUpper(set), true
+}
+
+// ASSetMember is one ASN in an expanded AS-SET, with its IPv6 prefix count.
+type ASSetMember struct {
+	ASN         string
+	PrefixCount int
+	Error       string // set if the member's prefixes couldn't be looked up
+}
+
+// ASSetResult is an AS-SET expanded to its member ASNs, with the IPv6
+// prefixes announced by any of them.
+type ASSetResult struct {
+	Name    string
+	Members []ASSetMember
+	// Unchecked is the number of members beyond maxASSetMembers whose
+	// prefixes weren't looked up.
+	Unchecked int
+	Prefixes  []string
+}
+
+// MembersWithIPv6 returns how many checked members announce IPv6.
+func (s *ASSetResult) MembersWithIPv6() int {
+	n := 0
+	for _, m := range s.Members {
+		if m.PrefixCount > 0 {
+			n++
+		}
+	}
+	return n
+}
+
+// lookupASSet expands asSet, which must have been normalized with
+// normalizeASSet, into its member ASNs using the IRR, then looks up the IPv6
+// prefixes of the first maxASSetMembers of them. A member whose lookup fails
+// is listed with its error rather than failing the whole set.
+func (a *App) lookupASSet(ctx context.Context, asSet string) (*ASSetResult, error) {
+	members, err := a.expandASSet(ctx, asSet)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &ASSetResult{Name: asSet}
+	if len(members) > maxASSetMembers {
+		result.Unchecked = len(members) - maxASSetMembers
+		members = members[:maxASSetMembers]
+	}
+
+	result.Members = make([]ASSetMember, len(members))
+	prefixes := make([][]string, len(members))
+	var wg sync.WaitGroup
+	for i, asn := range members {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			result.Members[i].ASN = asn
+			if err := a.checkASNPermitted(asn); err != nil {
+				result.Members[i].Error = err.Error()
+				return
+			}
+			if err := checkRoutableASN(asn); err != nil {
+				result.Members[i].Error = err.Error()
+				return
+			}
+			p, err := a.lookupIPv6(ctx, asn)
+			if err != nil {
+				result.Members[i].Error = err.Error()
+				return
+			}
+			result.Members[i].PrefixCount = len(p)
+			prefixes[i] = p
+		}()
+	}
+	wg.Wait()
+
+	seen := make(map[string]bool)
+	for _, p := range prefixes {
+		for _, prefix := range p {
+			if !seen[prefix] {
+				seen[prefix] = true
+				result.Prefixes = append(result.Prefixes, prefix)
+			}
+		}
+	}
+	sort.Strings(result.Prefixes)
+	return result, nil
+}
+
+// expandASSet returns the member ASNs of asSet, recursively expanded, in
+// ascending order.
+func (a *App) expandASSet(ctx context.Context, asSet string) ([]string, error) {
+	key := cacheKey(sourceIRR, "as_set", asSet)
+	if !cacheBypassed(ctx) {
+		if members, _, found := cacheGetAs[[]string](a.cache, key); found {
+			return members, nil
+		}
+	}
+
+	v, err := a.lookups.Do(ctx, key, func(ctx context.Context) (interface{}, error) {
+		members, err := a.fetchASSet(ctx, asSet)
+		if err != nil {
+			return nil, err
+		}
+		a.cache.Set(key, members, time.Hour)
+		return members, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.([]string), nil
+}
+
+// fetchASSet asks the IRRd server at -irr-server to expand asSet with the
+// "!i<set>,1" query, which resolves nested sets server-side.
+func (a *App) fetchASSet(ctx context.Context, asSet string) ([]string, error) {
+	reply, err := irrQuery(ctx, a.cfg.IRRServer, "!i"+asSet+",1", a.cfg.MaxBodySize)
+	if errors.Is(err, errIRRNotFound) {
+		return nil, markError(ErrASNNotFound, fmt.Errorf("%s is not registered in the IRR", asSet))
+	}
+	if err != nil {
+		return nil, markError(ErrUpstreamUnavailable, fmt.Errorf("IRR query for %s failed: %w", asSet, err))
+	}
+
+	seen := make(map[uint64]bool)
+	var numbers []uint64
+	for _, field := range strings.Fields(reply) {
+		asn, err := normalizeASN(field)
+		if err != nil {
+			continue
+		}
+		n, _ := strconv.ParseUint(asn, 10, 32)
+		if !seen[n] {
+			seen[n] = true
+			numbers = append(numbers, n)
+		}
+	}
+	if len(numbers) == 0 {
+		return nil, markError(ErrASNNotFound, fmt.Errorf("%s has no member ASNs", asSet))
+	}
+	sort.Slice(numbers, func(i, j int) bool { return numbers[i] < numbers[j] })
+
+	members := make([]string, len(numbers))
+	for i, n := range numbers {
+		members[i] = strconv.FormatUint(n, 10)
+	}
+	return members, nil
+}
+
+// errIRRNotFound is returned by irrQuery when the IRR has no such object.
+var errIRRNotFound = errors.New("IRR object not found")
+
+// irrQuery sends one IRRd "!" query to server and returns the data of its
+// reply: "A<length>" followed by that many bytes and "C" on success, "C"
+// alone for success without data, "D" if the key wasn't found and "F" with
+// a message on error. Replies longer than maxSize are refused.
+func irrQuery(ctx context.Context, server, query string, maxSize int64) (string, error) {
+	conn, err := dialUpstream(ctx, server)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+
+	if _, err := io.WriteString(conn, query+"\n"); err != nil {
+		return "", err
+	}
+
+	r := bufio.NewReader(conn)
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	line = strings.TrimRight(line, "\r\n")
+	switch {
+	case line == "C":
+		return "", nil
+	case line == "D":
+		return "", errIRRNotFound
+	case strings.HasPrefix(line, "F"):
+		return "", fmt.Errorf("IRR error: %s", strings.TrimSpace(line[1:]))
+	case strings.HasPrefix(line, "A"):
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n < 0 {
+			return "", fmt.Errorf("malformed IRR reply %q", line)
+		}
+		if int64(n) > maxSize {
+			return "", fmt.Errorf("%w: IRR reply of %d bytes", errBodyTooLarge, n)
+		}
+		data := make([]byte, n)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return "", err
+		}
+		return string(data), nil
+	}
+	return "", fmt.Errorf("unexpected IRR reply %q", line)
+}
+
+// renderASSet serves a lookup of the AS-SET named in data.ASN, listing its
+// members and their combined IPv6 prefixes.
+func (a *App) renderASSet(w http.ResponseWriter, r *http.Request, data pageData) {
+	set, _ := normalizeASSet(data.ASN)
+	data.ASN = set
+
+	ctx, refreshed, wait := a.refreshContext(w, r)
+	data.Refreshed = refreshed
+	data.RefreshWait = int(wait.Round(time.Second) / time.Second)
+
+	result, err := a.lookupASSet(ctx, set)
+	if err != nil {
+		data.Error = err.Error()
+		data.ErrorKind = errorKind(err)
+		data.RetryAfter = retryAfterSeconds(err)
+		setRetryAfter(w, err)
+		a.respond(w, r, lookupErrorStatus(err), data)
+		return
+	}
+	data.ASSet = result
+	a.respond(w, r, http.StatusOK, data)
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// batchResult is one row of batch output.
+type batchResult struct {
+	ASN             string   `json:"asn"`
+	IPv6PrefixCount int      `json:"ipv6_prefix_count"`
+	HasIPv6         bool     `json:"has_ipv6"`
+	Prefixes        []string `json:"prefixes"`
+	Error           string   `json:"error,omitempty"`
+	Freshness
+}
+
+// readASNList reads one ASN per line from r, ignoring blank lines and lines
+// starting with '#'.
+func readASNList(r io.Reader) ([]string, error) {
+	var asns []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		asns = append(asns, line)
+	}
+	return asns, scanner.Err()
+}
+
+// runBatch looks up the IPv6 prefixes of every ASN listed in r and writes one
+// result per ASN to w in the given format ("csv" or "json"), in input order.
+// At most workers lookups run at once, and consecutive lookups are started at
+// least delay apart to stay within BGPView's rate limit.
+func (a *App) runBatch(ctx context.Context, r io.Reader, w io.Writer, format string, workers int, delay time.Duration) error {
+	if format != "csv" && format != "json" {
+		return fmt.Errorf("unknown batch output format %q (want csv or json)", format)
+	}
+	if workers < 1 {
+		workers = 1
+	}
+
+	inputs, err := readASNList(r)
+	if err != nil {
+		return fmt.Errorf("failed to read ASN list: %w", err)
+	}
+
+	results := make([]batchResult, len(inputs))
+	jobs := make(chan int)
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for idx := range jobs {
+				results[idx] = a.batchLookup(ctx, inputs[idx])
+			}
+		}()
+	}
+
+	// Pace the start of each lookup
+	var ticker *time.Ticker
+	if delay > 0 {
+		ticker = time.NewTicker(delay)
+		defer ticker.Stop()
+	}
+	for idx := range inputs {
+		if ticker != nil && idx > 0 {
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+			}
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		jobs <- idx
+	}
+	close(jobs)
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if format == "json" {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(results)
+	}
+	return writeBatchCSV(w, results)
+}
+
+// batchLookup looks up a single ASN for runBatch.
+func (a *App) batchLookup(ctx context.Context, input string) batchResult {
+	asn, err := normalizeASN(input)
+	if err != nil {
+		return batchResult{ASN: input, Error: err.Error()}
+	}
+
+	prefixes, freshness, err := a.lookupIPv6Fresh(ctx, asn)
+	if err != nil {
+		return batchResult{ASN: asn, Error: err.Error()}
+	}
+
+	return batchResult{
+		ASN:             asn,
+		IPv6PrefixCount: len(prefixes),
+		HasIPv6:         len(prefixes) > 0,
+		Prefixes:        prefixes,
+		Freshness:       freshness,
+	}
+}
+
+// writeBatchCSV writes results as CSV with a header row. Prefixes are joined
+// with spaces into a single column.
+func writeBatchCSV(w io.Writer, results []batchResult) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"asn", "ipv6_prefix_count", "has_ipv6", "prefixes", "error"})
+	for _, res := range results {
+		cw.Write([]string{
+			res.ASN,
+			strconv.Itoa(res.IPv6PrefixCount),
+			strconv.FormatBool(res.HasIPv6),
+			strings.Join(res.Prefixes, " "),
+			res.Error,
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
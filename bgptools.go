@@ -0,0 +1,344 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// sourceBGPTools is the -source and cache namespace for data from bgp.tools.
+const sourceBGPTools = "bgptools"
+
+// defaultBGPToolsBase is where the bgp.tools bulk files are downloaded from
+// unless -bgptools-base names a mirror.
+const defaultBGPToolsBase = "https://bgp.tools"
+
+// bgpToolsRefreshInterval is how often the bulk files are downloaded again.
+// bgp.tools asks that they aren't fetched more often than this.
+const bgpToolsRefreshInterval = 30 * time.Minute
+
+// bgpToolsRetryInterval is how long after a failed download another is
+// tried.
+const bgpToolsRetryInterval = 5 * time.Minute
+
+// bgpToolsDownloadTimeout bounds downloading one bulk file. The routing
+// table is large, so this is far longer than upstreamTimeout.
+const bgpToolsDownloadTimeout = 5 * time.Minute
+
+// maxBGPToolsRoutes bounds the routes read from the table, well above the
+// size of the global routing table, so a broken download can't exhaust
+// memory.
+const maxBGPToolsRoutes = 10_000_000
+
+// bgpToolsRoute is one line of bgp.tools' table.jsonl.
+type bgpToolsRoute struct {
+	CIDR string `json:"CIDR"`
+	ASN  uint32 `json:"ASN"`
+}
+
+// bgpToolsASN is what asns.csv says about an ASN.
+type bgpToolsASN struct {
+	Name        string
+	CountryCode string
+}
+
+// bgpToolsData is one download of the bgp.tools bulk files.
+type bgpToolsData struct {
+	routes    map[uint32]*[2][]string // IPv4 and IPv6 prefixes by origin ASN
+	asns      map[uint32]bgpToolsASN
+	fetchedAt time.Time
+}
+
+// bgpToolsSource is the PrefixLookup backed by bgp.tools. Rather than
+// querying per ASN, it downloads the whole routing table and AS name list,
+// as bgp.tools asks of automated users, and answers lookups from memory.
+type bgpToolsSource struct {
+	app    *App
+	client *http.Client
+
+	mu       sync.Mutex
+	data     *bgpToolsData
+	loading  chan struct{} // closed when the download in progress finishes
+	err      error         // of the last download
+	failedAt time.Time     // when the last download failed
+}
+
+// newBGPToolsSource returns the bgp.tools source for a and starts the first
+// download in the background.
+func newBGPToolsSource(a *App) *bgpToolsSource {
+	s := &bgpToolsSource{
+		app: a,
+		// Downloads are bounded by bgpToolsDownloadTimeout rather than
+		// the client's upstreamTimeout
+		client: &http.Client{Transport: a.client.Transport},
+	}
+	s.refresh()
+	return s
+}
+
+func (s *bgpToolsSource) Name() string  { return sourceBGPTools }
+func (s *bgpToolsSource) Label() string { return "bgp.tools" }
+
+// userAgent follows bgp.tools' convention for automated clients: a
+// description of the client followed by " - " and a contact email address.
+func (s *bgpToolsSource) userAgent() string {
+	return "ipv6request/" + version + " bgp.tools - " + bgpToolsContact(s.app.cfg.Contact)
+}
+
+// bgpToolsContact returns the email address in contact, a mailto: URL or a
+// bare address, or "" if it has none.
+func bgpToolsContact(contact string) string {
+	contact = strings.TrimPrefix(contact, "mailto:")
+	if !strings.Contains(contact, "@") || strings.Contains(contact, "/") {
+		return ""
+	}
+	return contact
+}
+
+// refresh starts downloading the bulk files, unless a download is already in
+// progress, and returns the channel closed when it finishes.
+func (s *bgpToolsSource) refresh() chan struct{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.loading != nil {
+		return s.loading
+	}
+	done := make(chan struct{})
+	s.loading = done
+
+	go func() {
+		data, err := s.download()
+		if err != nil {
+			log.Printf("Failed to download the bgp.tools data: %v", err)
+		} else {
+			s.app.logInfof("Loaded routes of %d origin ASNs from bgp.tools", len(data.routes))
+		}
+
+		s.mu.Lock()
+		if err == nil {
+			s.data = data
+		} else {
+			s.failedAt = time.Now()
+		}
+		s.err = err
+		s.loading = nil
+		s.mu.Unlock()
+		close(done)
+	}()
+	return done
+}
+
+// current returns the latest bulk data, refreshing it in the background when
+// it is older than bgpToolsRefreshInterval. Before the first download has
+// finished, it waits for it as long as ctx allows. Failed downloads are
+// retried after bgpToolsRetryInterval.
+func (s *bgpToolsSource) current(ctx context.Context) (*bgpToolsData, error) {
+	s.mu.Lock()
+	data, loading := s.data, s.loading
+	retry := s.err == nil || time.Since(s.failedAt) > bgpToolsRetryInterval
+	lastErr := s.err
+	s.mu.Unlock()
+
+	if data != nil {
+		if loading == nil && retry && time.Since(data.fetchedAt) > bgpToolsRefreshInterval {
+			s.refresh()
+		}
+		return data, nil
+	}
+
+	if loading == nil {
+		if !retry {
+			return nil, markError(ErrUpstreamUnavailable, fmt.Errorf("bgp.tools data is unavailable: %w", lastErr))
+		}
+		loading = s.refresh()
+	}
+	select {
+	case <-loading:
+	case <-ctx.Done():
+		return nil, markError(ErrUpstreamUnavailable, errors.New("the bgp.tools routing table is still loading; please try again shortly"))
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.data == nil {
+		return nil, markError(ErrUpstreamUnavailable, fmt.Errorf("bgp.tools data is unavailable: %w", s.err))
+	}
+	return s.data, nil
+}
+
+// download fetches and parses the routing table and the AS name list.
+func (s *bgpToolsSource) download() (*bgpToolsData, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), bgpToolsDownloadTimeout)
+	defer cancel()
+
+	data := &bgpToolsData{fetchedAt: time.Now()}
+	err := s.get(ctx, "/table.jsonl", func(r io.Reader) (err error) {
+		data.routes, err = parseBGPToolsTable(r)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	err = s.get(ctx, "/asns.csv", func(r io.Reader) (err error) {
+		data.asns, err = parseBGPToolsASNs(r)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// get downloads path from -bgptools-base and hands the body to parse.
+func (s *bgpToolsSource) get(ctx context.Context, path string, parse func(io.Reader) error) error {
+	url := s.app.cfg.BGPToolsBase + path
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("User-Agent", s.userAgent())
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned status %d", url, resp.StatusCode)
+	}
+	if err := parse(resp.Body); err != nil {
+		return fmt.Errorf("failed to parse %s: %w", url, err)
+	}
+	return nil
+}
+
+// parseBGPToolsTable reads table.jsonl, one route per line, into the
+// prefixes of each origin ASN.
+func parseBGPToolsTable(r io.Reader) (map[uint32]*[2][]string, error) {
+	routes := make(map[uint32]*[2][]string)
+	scanner := bufio.NewScanner(r)
+	for n := 0; scanner.Scan(); n++ {
+		if n >= maxBGPToolsRoutes {
+			return nil, fmt.Errorf("more than %d routes", maxBGPToolsRoutes)
+		}
+		var route bgpToolsRoute
+		if err := json.Unmarshal(scanner.Bytes(), &route); err != nil {
+			return nil, fmt.Errorf("line %d: %w", n+1, err)
+		}
+		family := 0
+		if strings.Contains(route.CIDR, ":") {
+			family = 1
+		}
+		prefixes := routes[route.ASN]
+		if prefixes == nil {
+			prefixes = new([2][]string)
+			routes[route.ASN] = prefixes
+		}
+		prefixes[family] = append(prefixes[family], route.CIDR)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(routes) == 0 {
+		return nil, errors.New("no routes")
+	}
+	return routes, nil
+}
+
+// parseBGPToolsASNs reads asns.csv, whose header names its columns: "asn"
+// (like "AS64500"), "name" and, if present, "cc".
+func parseBGPToolsASNs(r io.Reader) (map[uint32]bgpToolsASN, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	header, err := cr.Read()
+	if err != nil {
+		return nil, err
+	}
+	column := map[string]int{"asn": -1, "name": -1, "cc": -1}
+	for i, name := range header {
+		if _, ok := column[name]; ok {
+			column[name] = i
+		}
+	}
+	if column["asn"] < 0 || column["name"] < 0 {
+		return nil, errors.New("missing asn or name column")
+	}
+	field := func(record []string, name string) string {
+		if i := column[name]; i >= 0 && i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+
+	asns := make(map[uint32]bgpToolsASN)
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		n, err := strconv.ParseUint(strings.TrimPrefix(field(record, "asn"), "AS"), 10, 32)
+		if err != nil {
+			continue
+		}
+		asns[uint32(n)] = bgpToolsASN{
+			Name:        field(record, "name"),
+			CountryCode: strings.ToUpper(field(record, "cc")),
+		}
+	}
+	return asns, nil
+}
+
+// FetchPrefixes returns the prefixes asn originates in the bgp.tools table.
+// An ASN missing from the table announces nothing. bgp.tools doesn't give
+// the prefixes' countries.
+func (s *bgpToolsSource) FetchPrefixes(ctx context.Context, asn string) (allPrefixes, error) {
+	data, err := s.current(ctx)
+	if err != nil {
+		return allPrefixes{}, err
+	}
+	n, err := strconv.ParseUint(asn, 10, 32)
+	if err != nil {
+		return allPrefixes{}, err
+	}
+	var all allPrefixes
+	if prefixes := data.routes[uint32(n)]; prefixes != nil {
+		all.IPv4 = append([]string(nil), prefixes[0]...)
+		all.IPv6 = append([]string(nil), prefixes[1]...)
+	}
+	return all, nil
+}
+
+// FetchASNDetails returns the name and country of asn from the bgp.tools AS
+// list, which has no contacts or registry details.
+func (s *bgpToolsSource) FetchASNDetails(ctx context.Context, asn string) (*ASNDetails, error) {
+	data, err := s.current(ctx)
+	if err != nil {
+		return nil, err
+	}
+	n, err := strconv.ParseUint(asn, 10, 32)
+	if err != nil {
+		return nil, err
+	}
+	info, ok := data.asns[uint32(n)]
+	if !ok {
+		return nil, markError(ErrASNNotFound, fmt.Errorf("bgp.tools has no record of ASN %s", asn))
+	}
+	return &ASNDetails{
+		ASN:         asn,
+		Name:        info.Name,
+		CountryCode: info.CountryCode,
+	}, nil
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"sync"
+	"time"
+)
+
+// errCircuitOpen is returned instead of calling upstream while the circuit
+// breaker is open.
+var errCircuitOpen = errors.New("BGPView appears to be unavailable right now; please try again in a minute")
+
+type breakerState int
+
+const (
+	breakerClosed breakerState = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+// circuitBreaker stops calls to an upstream that keeps failing. After
+// threshold consecutive failures within window the circuit opens and every
+// call fails fast for cooldown. Once the cooldown has passed a single probe
+// call is let through (half-open): its success closes the circuit again, its
+// failure re-opens it for another cooldown.
+type circuitBreaker struct {
+	threshold int
+	window    time.Duration
+	cooldown  time.Duration
+
+	mu           sync.Mutex
+	state        breakerState
+	failures     int
+	firstFailure time.Time
+	openedAt     time.Time
+	probing      bool
+}
+
+// bgpViewBreaker guards all outbound BGPView requests. It is shared by every
+// App, so its state changes are logged whatever their -quiet or -verbose.
+var bgpViewBreaker = &circuitBreaker{
+	threshold: 5,
+	window:    time.Minute,
+	cooldown:  30 * time.Second,
+}
+
+// Allow reports whether a call may be made now, returning errCircuitOpen if
+// not.
+func (b *circuitBreaker) Allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case breakerOpen:
+		if time.Since(b.openedAt) < b.cooldown {
+			return errCircuitOpen
+		}
+		b.state = breakerHalfOpen
+		b.probing = true
+		log.Printf("Circuit breaker half-open, probing upstream")
+		return nil
+	case breakerHalfOpen:
+		// Only the single probe call is allowed through
+		if b.probing {
+			return errCircuitOpen
+		}
+		b.probing = true
+		return nil
+	default:
+		return nil
+	}
+}
+
+// State returns the breaker's state: "closed", "open" or "half-open".
+func (b *circuitBreaker) State() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case breakerOpen:
+		return "open"
+	case breakerHalfOpen:
+		return "half-open"
+	default:
+		return "closed"
+	}
+}
+
+// Success records a successful call, closing the circuit.
+func (b *circuitBreaker) Success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state != breakerClosed {
+		log.Printf("Circuit breaker closed, upstream recovered")
+	}
+	b.state = breakerClosed
+	b.failures = 0
+	b.probing = false
+}
+
+// Abandon records a call whose outcome says nothing about upstream health,
+// such as one cancelled by the caller, letting another probe through if it
+// was the half-open probe.
+func (b *circuitBreaker) Abandon() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == breakerHalfOpen {
+		b.probing = false
+	}
+}
+
+// Failure records a failed call, opening the circuit once the threshold is
+// reached or when a half-open probe fails.
+func (b *circuitBreaker) Failure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	switch b.state {
+	case breakerHalfOpen:
+		b.open(now)
+	case breakerClosed:
+		if b.failures == 0 || now.Sub(b.firstFailure) > b.window {
+			b.failures = 0
+			b.firstFailure = now
+		}
+		b.failures++
+		if b.failures >= b.threshold {
+			b.open(now)
+		}
+	}
+}
+
+func (b *circuitBreaker) open(now time.Time) {
+	log.Printf("Circuit breaker open after %d consecutive upstream failures, failing fast for %v", b.failures, b.cooldown)
+	b.state = breakerOpen
+	b.openedAt = now
+	b.probing = false
+}
@@ -0,0 +1,267 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Size of a share card, the 1.91:1 size social networks show Open Graph
+// images at.
+const (
+	cardWidth  = 1200
+	cardHeight = 630
+	cardMargin = 60
+)
+
+// Colors of a share card, matching the stylesheet's badges.
+var (
+	cardBackground = color.RGBA{0x1f, 0x29, 0x37, 0xff}
+	cardText       = color.RGBA{0xff, 0xff, 0xff, 0xff}
+	cardMuted      = color.RGBA{0xad, 0xb5, 0xbd, 0xff}
+	cardFull       = color.RGBA{0x28, 0xa7, 0x45, 0xff}
+	cardNone       = color.RGBA{0xdc, 0x35, 0x45, 0xff}
+)
+
+// cardFont is a 5x7 pixel font, enough for card text without a font
+// library. Each glyph is 7 rows from the top, with the leftmost pixel in bit
+// 4. Lower case letters are drawn in upper case, and characters without a
+// glyph as '?'.
+var cardFont = map[rune][7]byte{
+	' ':  {},
+	'!':  {0x04, 0x04, 0x04, 0x04, 0x04, 0x00, 0x04},
+	'"':  {0x0a, 0x0a, 0x0a, 0x00, 0x00, 0x00, 0x00},
+	'#':  {0x0a, 0x0a, 0x1f, 0x0a, 0x1f, 0x0a, 0x0a},
+	'&':  {0x0c, 0x12, 0x14, 0x08, 0x15, 0x12, 0x0d},
+	'\'': {0x0c, 0x04, 0x08, 0x00, 0x00, 0x00, 0x00},
+	'(':  {0x02, 0x04, 0x08, 0x08, 0x08, 0x04, 0x02},
+	')':  {0x08, 0x04, 0x02, 0x02, 0x02, 0x04, 0x08},
+	'*':  {0x00, 0x04, 0x15, 0x0e, 0x15, 0x04, 0x00},
+	'+':  {0x00, 0x04, 0x04, 0x1f, 0x04, 0x04, 0x00},
+	',':  {0x00, 0x00, 0x00, 0x00, 0x0c, 0x04, 0x08},
+	'-':  {0x00, 0x00, 0x00, 0x1f, 0x00, 0x00, 0x00},
+	'.':  {0x00, 0x00, 0x00, 0x00, 0x00, 0x0c, 0x0c},
+	'/':  {0x00, 0x01, 0x02, 0x04, 0x08, 0x10, 0x00},
+	'0':  {0x0e, 0x11, 0x13, 0x15, 0x19, 0x11, 0x0e},
+	'1':  {0x04, 0x0c, 0x04, 0x04, 0x04, 0x04, 0x0e},
+	'2':  {0x0e, 0x11, 0x01, 0x02, 0x04, 0x08, 0x1f},
+	'3':  {0x1f, 0x02, 0x04, 0x02, 0x01, 0x11, 0x0e},
+	'4':  {0x02, 0x06, 0x0a, 0x12, 0x1f, 0x02, 0x02},
+	'5':  {0x1f, 0x10, 0x1e, 0x01, 0x01, 0x11, 0x0e},
+	'6':  {0x06, 0x08, 0x10, 0x1e, 0x11, 0x11, 0x0e},
+	'7':  {0x1f, 0x01, 0x02, 0x04, 0x08, 0x08, 0x08},
+	'8':  {0x0e, 0x11, 0x11, 0x0e, 0x11, 0x11, 0x0e},
+	'9':  {0x0e, 0x11, 0x11, 0x0f, 0x01, 0x02, 0x0c},
+	':':  {0x00, 0x0c, 0x0c, 0x00, 0x0c, 0x0c, 0x00},
+	'?':  {0x0e, 0x11, 0x01, 0x02, 0x04, 0x00, 0x04},
+	'@':  {0x0e, 0x11, 0x01, 0x0d, 0x15, 0x15, 0x0e},
+	'A':  {0x0e, 0x11, 0x11, 0x11, 0x1f, 0x11, 0x11},
+	'B':  {0x1e, 0x11, 0x11, 0x1e, 0x11, 0x11, 0x1e},
+	'C':  {0x0e, 0x11, 0x10, 0x10, 0x10, 0x11, 0x0e},
+	'D':  {0x1c, 0x12, 0x11, 0x11, 0x11, 0x12, 0x1c},
+	'E':  {0x1f, 0x10, 0x10, 0x1e, 0x10, 0x10, 0x1f},
+	'F':  {0x1f, 0x10, 0x10, 0x1e, 0x10, 0x10, 0x10},
+	'G':  {0x0e, 0x11, 0x10, 0x17, 0x11, 0x11, 0x0f},
+	'H':  {0x11, 0x11, 0x11, 0x1f, 0x11, 0x11, 0x11},
+	'I':  {0x0e, 0x04, 0x04, 0x04, 0x04, 0x04, 0x0e},
+	'J':  {0x07, 0x02, 0x02, 0x02, 0x02, 0x12, 0x0c},
+	'K':  {0x11, 0x12, 0x14, 0x18, 0x14, 0x12, 0x11},
+	'L':  {0x10, 0x10, 0x10, 0x10, 0x10, 0x10, 0x1f},
+	'M':  {0x11, 0x1b, 0x15, 0x15, 0x11, 0x11, 0x11},
+	'N':  {0x11, 0x11, 0x19, 0x15, 0x13, 0x11, 0x11},
+	'O':  {0x0e, 0x11, 0x11, 0x11, 0x11, 0x11, 0x0e},
+	'P':  {0x1e, 0x11, 0x11, 0x1e, 0x10, 0x10, 0x10},
+	'Q':  {0x0e, 0x11, 0x11, 0x11, 0x15, 0x12, 0x0d},
+	'R':  {0x1e, 0x11, 0x11, 0x1e, 0x14, 0x12, 0x11},
+	'S':  {0x0f, 0x10, 0x10, 0x0e, 0x01, 0x01, 0x1e},
+	'T':  {0x1f, 0x04, 0x04, 0x04, 0x04, 0x04, 0x04},
+	'U':  {0x11, 0x11, 0x11, 0x11, 0x11, 0x11, 0x0e},
+	'V':  {0x11, 0x11, 0x11, 0x11, 0x11, 0x0a, 0x04},
+	'W':  {0x11, 0x11, 0x11, 0x15, 0x15, 0x15, 0x0a},
+	'X':  {0x11, 0x11, 0x0a, 0x04, 0x0a, 0x11, 0x11},
+	'Y':  {0x11, 0x11, 0x11, 0x0a, 0x04, 0x04, 0x04},
+	'Z':  {0x1f, 0x01, 0x02, 0x04, 0x08, 0x10, 0x1f},
+	'_':  {0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x1f},
+}
+
+// cardGlyphWidth is the width of a glyph in font pixels, including a column
+// of spacing.
+const cardGlyphWidth = 6
+
+// drawCardText draws text with its top left corner at (x, y), each font
+// pixel scale image pixels wide, cut short with "..." if it would run past
+// the card's right margin.
+func drawCardText(img draw.Image, x, y, scale int, c color.Color, text string) {
+	runes := []rune(strings.ToUpper(text))
+	if fit := (cardWidth - cardMargin - x) / (cardGlyphWidth * scale); len(runes) > fit {
+		runes = append(runes[:max(fit-3, 0)], []rune("...")...)
+	}
+	src := image.NewUniform(c)
+	for i, r := range runes {
+		glyph, ok := cardFont[r]
+		if !ok {
+			glyph = cardFont['?']
+		}
+		left := x + i*cardGlyphWidth*scale
+		for row, bits := range glyph {
+			for col := 0; col < 5; col++ {
+				if bits&(0x10>>col) == 0 {
+					continue
+				}
+				px := image.Rect(left+col*scale, y+row*scale, left+(col+1)*scale, y+(row+1)*scale)
+				draw.Draw(img, px, src, image.Point{}, draw.Src)
+			}
+		}
+	}
+}
+
+// renderCard draws the share card of an ASN with the given name, which may
+// be empty, and IPv6 prefixes, and encodes it as PNG.
+func renderCard(asn, name string, prefixes []string) ([]byte, error) {
+	img := image.NewRGBA(image.Rect(0, 0, cardWidth, cardHeight))
+	draw.Draw(img, img.Bounds(), image.NewUniform(cardBackground), image.Point{}, draw.Src)
+
+	drawCardText(img, cardMargin, cardMargin, 12, cardText, "AS"+asn)
+	drawCardText(img, cardMargin, 180, 6, cardMuted, name)
+
+	badge, badgeColor := "NO IPV6", cardNone
+	if ipv6Readiness(prefixes) == "Full" {
+		badge, badgeColor = "IPV6 READY", cardFull
+	}
+	const badgeScale = 8
+	badgeRect := image.Rect(cardMargin, 280, cardMargin+(len(badge)*cardGlyphWidth-1)*badgeScale+2*24, 280+7*badgeScale+2*24)
+	draw.Draw(img, badgeRect, image.NewUniform(badgeColor), image.Point{}, draw.Src)
+	drawCardText(img, cardMargin+24, 280+24, badgeScale, cardText, badge)
+
+	count := strconv.Itoa(len(prefixes)) + " IPv6 prefixes announced"
+	if len(prefixes) == 1 {
+		count = "1 IPv6 prefix announced"
+	}
+	drawCardText(img, cardMargin, 430, 6, cardText, count)
+	drawCardText(img, cardMargin, cardHeight-cardMargin-7*4, 4, cardMuted, "Does your provider support IPv6?")
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// cardHandler serves /card?asn=, a PNG summary of an ASN's IPv6 status to
+// share on social media or use as an Open Graph image. Cards are cached as
+// long as the prefixes they show.
+func (a *App) cardHandler(w http.ResponseWriter, r *http.Request) {
+	asn, err := normalizeASN(r.URL.Query().Get("asn"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := a.checkASNPermitted(asn); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	if err := checkRoutableASN(asn); err != nil {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+
+	ctx, _, _ := a.refreshContext(w, r)
+	key := cacheKey(a.source.Name(), "card", asn)
+	card, _, found := cacheGetAs[[]byte](a.cache, key)
+	if !found || cacheBypassed(ctx) {
+		var (
+			details             *ASNDetails
+			prefixes            []string
+			detailsErr, prefErr error
+			wg                  sync.WaitGroup
+		)
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			details, detailsErr = a.lookupASNDetails(ctx, asn)
+		}()
+		go func() {
+			defer wg.Done()
+			prefixes, prefErr = a.lookupIPv6(ctx, asn)
+		}()
+		wg.Wait()
+
+		if prefErr != nil {
+			setRetryAfter(w, prefErr)
+			http.Error(w, prefErr.Error(), lookupErrorStatus(prefErr))
+			return
+		}
+		// Without details, the card just leaves the name out, and isn't
+		// cached unless the name is missing for good
+		var name string
+		if detailsErr == nil {
+			name = details.Name
+		}
+		if card, err = renderCard(asn, name, prefixes); err != nil {
+			http.Error(w, fmt.Sprintf("Failed to render card: %v", err), http.StatusInternalServerError)
+			return
+		}
+		if sectionStatus(detailsErr) != sectionUnavailable {
+			a.cache.Set(key, card, a.prefixCacheTTL(prefixes))
+		}
+	}
+
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Cache-Control", "public, max-age=3600")
+	w.Write(card)
+}
+
+// SharePreview is what link previews of a lookup show, through its page's
+// Open Graph and Twitter card tags.
+type SharePreview struct {
+	Title       string
+	Description string
+	URL         string
+	Image       string // the lookup's /card
+}
+
+// sharePreview returns the link preview of a lookup of asn, whose name may
+// be empty, found to announce prefixes.
+func (a *App) sharePreview(r *http.Request, asn, name string, prefixes []string) *SharePreview {
+	base := a.publicURL(r)
+	preview := &SharePreview{
+		URL:   base + "/?asn=" + asn,
+		Image: base + "/card?asn=" + asn,
+	}
+	network := "AS" + asn
+	if name != "" {
+		network = name
+	}
+	if len(prefixes) == 0 {
+		preview.Title = "AS" + asn + " announces no IPv6 prefixes"
+		preview.Description = network + " doesn't support IPv6 yet. Does your provider? Look it up, and ask them for IPv6 if not."
+		return preview
+	}
+	preview.Title = "AS" + asn + " announces " + strconv.Itoa(len(prefixes)) + " IPv6 prefixes"
+	if len(prefixes) == 1 {
+		preview.Title = "AS" + asn + " announces 1 IPv6 prefix"
+	}
+	preview.Description = network + " is IPv6 ready. Does your provider support IPv6? Look it up, and ask them for it if not."
+	return preview
+}
+
+// publicURL returns the URL the site is served at: -public-url, or else
+// the scheme and host r was sent to, as forwarded by a proxy if there is
+// one.
+func (a *App) publicURL(r *http.Request) string {
+	if a.cfg.PublicURL != "" {
+		return a.cfg.PublicURL
+	}
+	scheme := "http"
+	if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host
+}
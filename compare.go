@@ -0,0 +1,156 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"html/template"
+	"log"
+	"net/http"
+	"sync"
+)
+
+// comparedASN is one column of the /compare page.
+type comparedASN struct {
+	Input     string // as entered, to refill the form
+	ASN       string
+	Error     string
+	Details   *ASNDetails
+	IPv6Count int
+	IPv4Count int
+	HasIPv4   bool   // whether the IPv4 count could be looked up
+	Readiness string // "" unless the prefixes were looked up
+}
+
+// compareASN looks up the IPv6 prefixes, IPv4 prefixes and details of the
+// ASN entered as input. Invalid input and failed prefix lookups are recorded
+// in the result's Error; failed details and IPv4 lookups just leave those
+// parts out.
+func (a *App) compareASN(ctx context.Context, input string) comparedASN {
+	c := comparedASN{Input: input}
+	asn, err := normalizeASN(input)
+	if err == nil {
+		err = a.checkASNPermitted(asn)
+	}
+	if err == nil {
+		err = checkRoutableASN(asn)
+	}
+	if err != nil {
+		c.Error = err.Error()
+		return c
+	}
+	c.ASN = asn
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		if details, err := a.lookupASNDetails(ctx, asn); err == nil {
+			c.Details = details
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		prefixes, err := a.lookupIPv6(ctx, asn)
+		if err != nil {
+			c.Error = err.Error()
+			return
+		}
+		c.IPv6Count = len(prefixes)
+		c.Readiness = ipv6Readiness(prefixes)
+
+		// Both families come from the same upstream call, so this is
+		// normally a cache hit
+		if ipv4, err := a.lookupIPv4(ctx, asn); err == nil {
+			c.IPv4Count = len(ipv4)
+			c.HasIPv4 = true
+		}
+	}()
+	wg.Wait()
+	return c
+}
+
+// compareTemplate renders two ASNs side by side.
+var compareTemplate = template.Must(template.New("compare").Parse(`
+<!DOCTYPE html>
+<html lang="en">
+<head>
+    <meta charset="utf-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1">
+    <title>Compare IPv6 support</title>
+    <link rel="stylesheet" href="/static/style.css">
+</head>
+<body>
+    <main class="container">
+        <h1>Compare IPv6 support</h1>
+        <form method="GET" action="/compare" class="compare-form" aria-label="Compare two ASNs">
+            <label for="compare-a">First ASN:</label>
+            <input type="text" id="compare-a" name="a" value="{{.A.Input}}" required autocomplete="off">
+            <label for="compare-b">Second ASN:</label>
+            <input type="text" id="compare-b" name="b" value="{{.B.Input}}" required autocomplete="off">
+            <input type="submit" value="Compare">
+        </form>
+
+        {{if .Compared}}
+        <table class="compare">
+            <tr><th scope="col"></th>{{range .Columns}}<th scope="col">{{if .ASN}}<a href="/?asn={{.ASN}}">AS{{.ASN}}</a>{{else}}{{.Input}}{{end}}</th>{{end}}</tr>
+            <tr><th scope="row">IPv6</th>{{range .Columns}}<td>{{if .Error}}<span class="error-note" role="alert">{{.Error}}</span>{{else}}<span class="badge {{if eq .Readiness "Full"}}badge-full{{else}}badge-none{{end}}">{{if eq .Readiness "Full"}}<span aria-hidden="true">✅</span> Yes{{else}}<span aria-hidden="true">❌</span> No{{end}}</span>{{end}}</td>{{end}}</tr>
+            <tr><th scope="row">IPv6 prefixes</th>{{range .Columns}}<td>{{if .Readiness}}{{.IPv6Count}}{{end}}</td>{{end}}</tr>
+            <tr><th scope="row">IPv4 prefixes</th>{{range .Columns}}<td>{{if .HasIPv4}}{{.IPv4Count}}{{end}}</td>{{end}}</tr>
+            <tr><th scope="row">Name</th>{{range .Columns}}<td>{{with .Details}}{{.Name}}{{end}}</td>{{end}}</tr>
+            <tr><th scope="row">Description</th>{{range .Columns}}<td>{{with .Details}}{{.DescriptionShort}}{{end}}</td>{{end}}</tr>
+            <tr><th scope="row">Country</th>{{range .Columns}}<td>{{with .Details}}{{with .CountryFlag}}<span aria-hidden="true">{{.}}</span> {{end}}{{with .CountryName}}{{.}}{{else}}{{.CountryCode}}{{end}}{{end}}</td>{{end}}</tr>
+            <tr><th scope="row">RIR</th>{{range .Columns}}<td>{{with .Details}}{{.RIRAllocation}}{{end}}</td>{{end}}</tr>
+            <tr><th scope="row">Website</th>{{range .Columns}}<td>{{with .Details}}{{with .Website}}<a href="{{.}}" rel="noopener noreferrer" target="_blank">{{.}}</a>{{end}}{{end}}</td>{{end}}</tr>
+        </table>
+        {{end}}
+        <p class="footnote"><a href="/">Look up a single ASN</a></p>
+    </main>
+</body>
+</html>
+`))
+
+// compareHandler serves /compare?a=N&b=M, looking up both ASNs concurrently
+// and showing them side by side. Without both parameters it shows the form.
+func (a *App) compareHandler(w http.ResponseWriter, r *http.Request) {
+	inputA, inputB := r.URL.Query().Get("a"), r.URL.Query().Get("b")
+	data := struct {
+		A, B     comparedASN
+		Columns  []comparedASN
+		Compared bool
+	}{A: comparedASN{Input: inputA}, B: comparedASN{Input: inputB}}
+
+	status := http.StatusOK
+	if inputA != "" && inputB != "" {
+		var wg sync.WaitGroup
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			data.A = a.compareASN(r.Context(), inputA)
+		}()
+		go func() {
+			defer wg.Done()
+			data.B = a.compareASN(r.Context(), inputB)
+		}()
+		wg.Wait()
+		data.Columns = []comparedASN{data.A, data.B}
+		data.Compared = true
+
+		// Report an error status only when neither side could be shown
+		if data.A.Readiness == "" && data.B.Readiness == "" {
+			status = http.StatusBadRequest
+			if data.A.ASN != "" && data.B.ASN != "" {
+				status = http.StatusBadGateway
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := compareTemplate.Execute(&buf, data); err != nil {
+		log.Printf("Failed to render comparison: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	buf.WriteTo(w)
+}
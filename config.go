@@ -0,0 +1,235 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// envPrefix starts the name of every environment variable that sets an
+// option: -cache-backend is IPV6REQUEST_CACHE_BACKEND.
+const envPrefix = "IPV6REQUEST_"
+
+// Config holds every setting of the server. Each field is set by the flag of
+// the same name, the matching environment variable or the -config file, in
+// that order of precedence, falling back to its default.
+type Config struct {
+	ConfigFile string
+
+	Daemon            bool
+	DaemonChild       bool
+	ShowVersion       bool
+	Port              string
+	IPv6Only          bool
+	BGPViewBase       string
+	Contact           string
+	FixturesDir       string
+	MaxUpstream       int
+	TemplateFile      string
+	Dev               bool
+	Batch             bool
+	FromFile          string
+	BatchFormat       string
+	BatchWorkers      int
+	BatchDelay        time.Duration
+	EnablePing        bool
+	MaxPrefixes       int
+	CacheBackend      string
+	RedisAddr         string
+	DBFile            string
+	RIRLinksFile      string
+	Lang              string
+	NegativeCacheTTL  time.Duration
+	ASNAllowlist      string
+	ASNBlocklist      string
+	StartupCheck      bool
+	StartupCheckFatal bool
+	Quiet             bool
+	Verbose           bool
+	RequestTimeout    time.Duration
+	Watch             string
+	WatchInterval     time.Duration
+	WatchStateFile    string
+	WebhookURL        string
+	AdminToken        string
+	IRRServer         string
+	MaxBodySize       int64
+	ReadHeaderTimeout time.Duration
+	ReadTimeout       time.Duration
+	WriteTimeout      time.Duration
+	IdleTimeout       time.Duration
+	DisableAutodetect bool
+	SupportFormsFile  string
+	TrustedProxies    string
+
+	UpstreamMinInterval time.Duration
+	UpstreamBurst       int
+	Source              string
+	BGPToolsBase        string
+	RPKI                bool
+	RIPEstatBase        string
+	ReverseDNS          bool
+	PublicURL           string
+	RIRSources          string
+}
+
+// defineFlags registers a flag for every field of cfg on fs, with the
+// field's current value as the default.
+func defineFlags(fs *flag.FlagSet, cfg *Config) {
+	fs.StringVar(&cfg.ConfigFile, "config", "", "Read settings from this file of `name = value` lines, named like the flags")
+	fs.BoolVar(&cfg.Daemon, "d", false, "Run as daemon (background process on IPv6 localhost)")
+	fs.StringVar(&cfg.Port, "port", "8080", "Port to listen on")
+	fs.StringVar(&cfg.PublicURL, "public-url", "", "URL the site is served at, like https://example.org, for link previews of lookups (default: the scheme and host of each request)")
+	fs.BoolVar(&cfg.IPv6Only, "ipv6-only", false, "Listen on IPv6 only, refusing IPv4 connections, rather than on all addresses")
+	fs.StringVar(&cfg.BGPViewBase, "bgpview-base", defaultBGPViewBase, "Base URL of the BGPView API or a compatible mirror")
+	fs.StringVar(&cfg.Source, "source", sourceBGPView, "Where to look up announced prefixes and AS details: bgpview, ripestat, or bgptools to use the bgp.tools routing table (needs -contact with an email address)")
+	fs.StringVar(&cfg.RIRSources, "rir-sources", "", "Sources to look up the ASNs of each RIR in, in order of preference, like \"RIPE=ripestat,bgpview; ARIN=bgpview,bgptools\"; other ASNs use -source")
+	fs.StringVar(&cfg.BGPToolsBase, "bgptools-base", defaultBGPToolsBase, "Base URL of bgp.tools or a mirror of its table.jsonl and asns.csv, for -source bgptools")
+	fs.StringVar(&cfg.Contact, "contact", defaultContactURL, "Contact URL or mailto: address for this instance, sent to BGPView in the User-Agent")
+	fs.StringVar(&cfg.FixturesDir, "fixtures-dir", "", "Serve BGPView lookups from canned JSON files in this directory instead of the network (offline mode)")
+	fs.BoolVar(&cfg.DaemonChild, "daemon-child", false, "Internal: set on the re-executed daemon process")
+	fs.BoolVar(&cfg.ShowVersion, "version", false, "Print version information and exit")
+	fs.IntVar(&cfg.MaxUpstream, "max-upstream-concurrency", defaultMaxUpstream, "Maximum number of simultaneous requests to BGPView")
+	fs.DurationVar(&cfg.UpstreamMinInterval, "upstream-min-interval", defaultUpstreamMinInterval, "Average time between requests to BGPView, across all lookups; requests queue for their turn (0 to disable)")
+	fs.IntVar(&cfg.UpstreamBurst, "upstream-burst", defaultUpstreamBurst, "Number of requests to BGPView that may go out at once before -upstream-min-interval applies")
+	fs.StringVar(&cfg.TemplateFile, "template-file", "", "Load the HTML template from this file instead of the built-in one")
+	fs.BoolVar(&cfg.Dev, "dev", false, "Re-read -template-file on every request")
+	fs.BoolVar(&cfg.Batch, "batch", false, "Look up ASNs read from stdin (one per line) and print the results instead of serving")
+	fs.StringVar(&cfg.FromFile, "from-file", "", "Like -batch, but read the ASNs from this file")
+	fs.StringVar(&cfg.BatchFormat, "format", "csv", "Batch output format: csv or json")
+	fs.IntVar(&cfg.BatchWorkers, "batch-workers", 2, "Number of concurrent lookups in batch mode")
+	fs.DurationVar(&cfg.BatchDelay, "batch-delay", time.Second, "Minimum delay between starting lookups in batch mode")
+	fs.BoolVar(&cfg.RPKI, "rpki", false, "Show the RPKI validation status of the first prefixes of a lookup, checked with RIPEstat")
+	fs.StringVar(&cfg.RIPEstatBase, "ripestat-base", defaultRIPEstatBase, "Base URL of the RIPEstat API, for -rpki and the ripestat source")
+	fs.BoolVar(&cfg.ReverseDNS, "rdns", false, "Check whether reverse DNS (ip6.arpa) is delegated for the first prefixes of a lookup")
+	fs.BoolVar(&cfg.EnablePing, "enable-ping", false, "Enable the /reachability endpoint, which pings the prefixes an ASN announces over ICMPv6 (needs raw socket privileges)")
+	fs.IntVar(&cfg.MaxPrefixes, "max-prefixes", defaultMaxRenderedPrefixes, "Number of prefixes listed before the rest are folded behind a \"show all\" toggle (0 for no limit)")
+	fs.StringVar(&cfg.CacheBackend, "cache-backend", "memory", "Where to cache lookups: memory, or redis to share the cache between instances")
+	fs.StringVar(&cfg.RedisAddr, "redis-addr", "localhost:6379", "Address of the Redis server used by -cache-backend redis")
+	fs.StringVar(&cfg.DBFile, "db-file", "", "Record IPv6 prefix counts per ASN in this file to show adoption trends")
+	fs.StringVar(&cfg.RIRLinksFile, "rir-links-file", "", "Load the RIR links for the no-IPv6 message from this JSON file instead of the built-in list")
+	fs.StringVar(&cfg.SupportFormsFile, "support-forms-file", "", "Offer the web support forms of the providers listed in this JSON file, in place of email")
+	fs.StringVar(&cfg.Lang, "lang", defaultLang, "Default language for the generated message (en, es, fr, de, ja)")
+	fs.DurationVar(&cfg.NegativeCacheTTL, "negative-cache-ttl", defaultNegativeCacheTTL, "How long to cache empty and not-found lookup results")
+	fs.StringVar(&cfg.ASNAllowlist, "asn-allowlist", "", "Only serve these comma-separated ASNs and ranges (e.g. 64500,65000-65100)")
+	fs.StringVar(&cfg.ASNBlocklist, "asn-blocklist", "", "Refuse to serve these comma-separated ASNs and ranges")
+	fs.BoolVar(&cfg.StartupCheck, "startup-check", false, "Look up a known ASN at startup and warn if BGPView is unreachable")
+	fs.BoolVar(&cfg.StartupCheckFatal, "startup-check-fatal", false, "With -startup-check, exit instead of warning if BGPView is unreachable")
+	fs.BoolVar(&cfg.Quiet, "quiet", false, "Log errors only")
+	fs.BoolVar(&cfg.Verbose, "verbose", false, "Also log every request and cache access")
+	fs.DurationVar(&cfg.RequestTimeout, "request-timeout", defaultRequestTimeout, "Maximum time to spend serving a single request, including upstream lookups")
+	fs.DurationVar(&cfg.ReadHeaderTimeout, "read-header-timeout", defaultReadHeaderTimeout, "Maximum time for a client to send its request headers")
+	fs.DurationVar(&cfg.ReadTimeout, "read-timeout", defaultReadTimeout, "Maximum time for a client to send its whole request")
+	fs.DurationVar(&cfg.WriteTimeout, "write-timeout", defaultWriteTimeout, "Maximum time from the end of the request headers to the end of the response; keep it above -request-timeout")
+	fs.DurationVar(&cfg.IdleTimeout, "idle-timeout", defaultIdleTimeout, "How long to keep an idle keep-alive connection open")
+	fs.BoolVar(&cfg.DisableAutodetect, "disable-autodetect", false, "Don't look up the visitor's ASN from their IP address, or show the address")
+	fs.StringVar(&cfg.TrustedProxies, "trusted-proxies", "", "Comma-separated addresses and prefixes of reverse proxies whose X-Forwarded-For header is trusted to name the client, for per-client limits")
+	fs.StringVar(&cfg.Watch, "watch", "", "Show these comma-separated ASNs on /dashboard, keeping their status fresh in the background")
+	fs.DurationVar(&cfg.WatchInterval, "watch-interval", 30*time.Minute, "How often to re-check the -watch ASNs")
+	fs.StringVar(&cfg.WatchStateFile, "watch-state-file", "", "Remember the -watch ASNs' IPv6 status in this file, so -webhook-url doesn't fire again after a restart")
+	fs.StringVar(&cfg.WebhookURL, "webhook-url", "", "POST a JSON notification to this URL when a -watch ASN starts announcing IPv6")
+	fs.Int64Var(&cfg.MaxBodySize, "max-body-size", defaultMaxBodySize, "Maximum size in bytes of an upstream response")
+	fs.StringVar(&cfg.IRRServer, "irr-server", defaultIRRServer, "IRRd whois server (host:port) used to expand AS-SETs into their member ASNs")
+	fs.StringVar(&cfg.AdminToken, "admin-token", "", "Enable the /admin endpoints for requests carrying this bearer token")
+}
+
+// notConfigurable lists the flags that only make sense on the command line.
+var notConfigurable = map[string]bool{
+	"config":       true,
+	"daemon-child": true,
+	"version":      true,
+}
+
+// loadConfig parses the command-line args and fills in every option not
+// given there from its environment variable, then from the -config file.
+func loadConfig(args []string) (*Config, error) {
+	cfg := &Config{}
+	fs := flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+	defineFlags(fs, cfg)
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	onCommandLine := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { onCommandLine[f.Name] = true })
+
+	var fileValues map[string]string
+	if cfg.ConfigFile != "" {
+		var err error
+		if fileValues, err = readConfigFile(cfg.ConfigFile); err != nil {
+			return nil, err
+		}
+		for name := range fileValues {
+			if fs.Lookup(name) == nil || notConfigurable[name] {
+				return nil, fmt.Errorf("%s: unknown setting %q", cfg.ConfigFile, name)
+			}
+		}
+	}
+
+	var err error
+	fs.VisitAll(func(f *flag.Flag) {
+		if err != nil || onCommandLine[f.Name] || notConfigurable[f.Name] {
+			return
+		}
+		env := envPrefix + strings.ToUpper(strings.ReplaceAll(f.Name, "-", "_"))
+		if value, ok := os.LookupEnv(env); ok {
+			if setErr := fs.Set(f.Name, value); setErr != nil {
+				err = fmt.Errorf("invalid %s: %w", env, setErr)
+			}
+			return
+		}
+		if value, ok := fileValues[f.Name]; ok {
+			if setErr := fs.Set(f.Name, value); setErr != nil {
+				err = fmt.Errorf("%s: invalid %s: %w", cfg.ConfigFile, f.Name, setErr)
+			}
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// readConfigFile reads a config file of "name = value" lines, a flat subset
+// of TOML. Names are the flag names, with "_" accepted for "-". Values may
+// be quoted. Blank lines and lines starting with '#' are ignored.
+func readConfigFile(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open config file: %w", err)
+	}
+	defer f.Close()
+
+	values := make(map[string]string)
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		name, value, ok := strings.Cut(text, "=")
+		if !ok {
+			return nil, fmt.Errorf("%s:%d: expected name = value", path, line)
+		}
+		name = strings.ReplaceAll(strings.TrimSpace(name), "_", "-")
+		value = strings.TrimSpace(value)
+		if strings.HasPrefix(value, `"`) {
+			unquoted, err := strconv.Unquote(value)
+			if err != nil {
+				return nil, fmt.Errorf("%s:%d: badly quoted value for %s", path, line, name)
+			}
+			value = unquoted
+		} else if comment := strings.Index(value, " #"); comment >= 0 {
+			value = strings.TrimSpace(value[:comment])
+		}
+		values[name] = value
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+	return values, nil
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/netip"
+	"time"
+)
+
+// detectCookie remembers a browser's auto-detected ASN, so that repeat
+// visits from the same network skip the IP lookup.
+const detectCookie = "ipv6request_detect"
+
+// detectCookieTTL is how long a detected ASN is remembered, as long as the
+// IP to ASN lookup is cached.
+const detectCookieTTL = 30 * time.Minute
+
+// maxDetectCookieMatches bounds how many matched ASNs are kept in the
+// cookie, keeping it well under browsers' size limit.
+const maxDetectCookieMatches = 5
+
+// errDetectionSkipped is returned by detectASN when it was asked not to look
+// the client's network up and hasn't got it cached.
+var errDetectionSkipped = errors.New("auto-detection skipped")
+
+// detectedASN is the content of the detectCookie.
+type detectedASN struct {
+	Network    string       `json:"n"`
+	Matches    []MatchedASN `json:"m"`
+	DetectedAt int64        `json:"t"` // Unix seconds
+}
+
+// detectionNetwork returns the network ip is looked up by for
+// auto-detection: its /48 for IPv6 and /24 for IPv4, the longest prefixes
+// accepted in the global routing table. Every address in it has the same
+// origin ASN, so clients whose address varies within it, such as with IPv6
+// privacy addresses, share one cached lookup.
+func detectionNetwork(ip string) (string, bool) {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return "", false
+	}
+	addr = addr.Unmap()
+	bits := 48
+	if addr.Is4() {
+		bits = 24
+	}
+	prefix, err := addr.Prefix(bits)
+	if err != nil {
+		return "", false
+	}
+	return prefix.Addr().String(), true
+}
+
+// detectASN finds the ASNs originating the network of clientIP, which must be
+// a public address. A result remembered in the client's cookie for the same
+// network is used without a lookup; otherwise the lookup's result is stored
+// in the cookie. With cachedOnly, when the detection is only a nicety, a
+// result that isn't in the cookie or the cache isn't looked up, and
+// errDetectionSkipped is returned.
+func (a *App) detectASN(ctx context.Context, w http.ResponseWriter, r *http.Request, clientIP string, cachedOnly bool) ([]MatchedASN, Freshness, error) {
+	network, ok := detectionNetwork(clientIP)
+	if !ok {
+		network = clientIP
+	}
+
+	if detected, ok := readDetectCookie(r); ok && detected.Network == network {
+		age := time.Since(time.Unix(detected.DetectedAt, 0))
+		return detected.Matches, newFreshness(age), nil
+	}
+	if cachedOnly {
+		matches, age, found := a.cacheGetIPASN(sourceBGPView, network)
+		if !found || len(matches) == 0 {
+			return nil, Freshness{}, errDetectionSkipped
+		}
+		return matches, newFreshness(age), nil
+	}
+
+	matches, freshness, err := a.lookupASNByIP(ctx, network)
+	if err != nil {
+		return nil, Freshness{}, err
+	}
+	writeDetectCookie(w, r, detectedASN{
+		Network:    network,
+		Matches:    matches[:min(len(matches), maxDetectCookieMatches)],
+		DetectedAt: time.Now().Add(-time.Duration(freshness.AgeSeconds) * time.Second).Unix(),
+	})
+	return matches, freshness, nil
+}
+
+// readDetectCookie returns the detection remembered in r's cookie, if it is
+// present, well-formed and not expired. The cookie is only ever shown back
+// to the client that sent it, but its ASNs are still validated.
+func readDetectCookie(r *http.Request) (detectedASN, bool) {
+	var detected detectedASN
+	cookie, err := r.Cookie(detectCookie)
+	if err != nil {
+		return detected, false
+	}
+	data, err := base64.RawURLEncoding.DecodeString(cookie.Value)
+	if err != nil || json.Unmarshal(data, &detected) != nil {
+		return detected, false
+	}
+	if len(detected.Matches) == 0 || time.Since(time.Unix(detected.DetectedAt, 0)) > detectCookieTTL {
+		return detected, false
+	}
+	for _, m := range detected.Matches {
+		if asn, err := normalizeASN(m.ASN); err != nil || asn != m.ASN {
+			return detected, false
+		}
+	}
+	return detected, true
+}
+
+// writeDetectCookie stores detected in the client's cookie for
+// detectCookieTTL.
+func writeDetectCookie(w http.ResponseWriter, r *http.Request, detected detectedASN) {
+	data, err := json.Marshal(detected)
+	if err != nil {
+		return
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     detectCookie,
+		Value:    base64.RawURLEncoding.EncodeToString(data),
+		Path:     "/",
+		MaxAge:   int(detectCookieTTL / time.Second),
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
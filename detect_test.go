@@ -0,0 +1,57 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestSubmittedLookupSkipsDetection(t *testing.T) {
+	var ipLookups atomic.Int32
+	stub := bgpViewStub(map[string]string{
+		"/asn/19625":           bgpViewASN19625,
+		"/asn/19625/prefixes":  bgpViewPrefixes19625,
+		"/ip/2a00:1450:4001::": `{"status":"ok","data":{"ip":"2a00:1450:4001::","prefixes":[{"prefix":"2a00:1450::/32","asn":{"asn":15169,"name":"GOOGLE"}}]}}`,
+	})
+	a := newTestApp(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/ip/") {
+			ipLookups.Add(1)
+		}
+		stub.ServeHTTP(w, r)
+	}))
+	router := a.newRouter()
+
+	steps := []struct {
+		name      string
+		method    string
+		form      string
+		ipLookups int32
+		detected  bool
+	}{
+		{"submitted ASN", http.MethodPost, "asn=19625", 0, false},
+		{"plain visit", http.MethodGet, "", 1, true},
+		// The detection is shown once it is known, at no extra cost
+		{"submitted ASN, detection cached", http.MethodPost, "asn=19625", 1, true},
+	}
+	for _, step := range steps {
+		r := httptest.NewRequest(step.method, "/", strings.NewReader(step.form))
+		if step.method == http.MethodPost {
+			r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		}
+		r.RemoteAddr = "[2a00:1450:4001::200e]:443"
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+
+		if w.Code != http.StatusOK {
+			t.Errorf("%s: status = %d, want %d", step.name, w.Code, http.StatusOK)
+		}
+		if got := ipLookups.Load(); got != step.ipLookups {
+			t.Errorf("%s: %d IP lookups in all, want %d", step.name, got, step.ipLookups)
+		}
+		if got := strings.Contains(w.Body.String(), "15169 (GOOGLE)"); got != step.detected {
+			t.Errorf("%s: detected network shown = %v, want %v", step.name, got, step.detected)
+		}
+	}
+}
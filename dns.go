@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"time"
+)
+
+// dialTimeout bounds connecting to an upstream, including resolving its
+// hostname, even when the request's own context has a later deadline.
+const dialTimeout = 5 * time.Second
+
+// resolver resolves the hostnames of upstream services. Lookups through it
+// are always made with the context of the request that needs them, so they
+// are abandoned when the request times out or the client goes away.
+var resolver = &net.Resolver{}
+
+// upstreamDialer connects to upstream services using resolver.
+var upstreamDialer = &net.Dialer{
+	Timeout:  dialTimeout,
+	Resolver: resolver,
+}
+
+// dialUpstream opens a TCP connection to addr for a plain-text protocol such
+// as whois, with a deadline of upstreamTimeout or ctx's deadline, whichever
+// comes first.
+func dialUpstream(ctx context.Context, addr string) (net.Conn, error) {
+	conn, err := upstreamDialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	deadline := time.Now().Add(upstreamTimeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	conn.SetDeadline(deadline)
+	return conn, nil
+}
+
+// newUpstreamTransport returns the transport for outbound HTTP requests. It
+// dials with upstreamDialer, passing each request's context through to the
+// DNS lookup.
+func newUpstreamTransport() *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = upstreamDialer.DialContext
+	return transport
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// maxDomainLength is the longest domain name DNS allows.
+const maxDomainLength = 253
+
+// domainPattern matches a fully qualified hostname with an alphabetic top
+// level domain, which keeps asdot ASNs like "65000.1" from matching.
+var domainPattern = regexp.MustCompile(`^(?i:([a-z0-9]([a-z0-9-]*[a-z0-9])?\.)+[a-z]{2,63}\.?)$`)
+
+// errUnresolvableDomain marks the errors of resolveDomain that are due to
+// the name itself rather than a DNS failure.
+var errUnresolvableDomain = errors.New("domain can't be resolved")
+
+// normalizeDomain recognizes input naming a website, either as a bare
+// hostname like "example.com" or as a URL like "https://www.example.com/",
+// and returns the hostname in lower case.
+func normalizeDomain(input string) (string, bool) {
+	host := strings.TrimSpace(input)
+	if strings.Contains(host, "://") {
+		u, err := url.Parse(host)
+		if err != nil {
+			return "", false
+		}
+		host = u.Hostname()
+	} else if i := strings.IndexAny(host, "/:"); i >= 0 {
+		host = host[:i]
+	}
+	if len(host) > maxDomainLength || !domainPattern.MatchString(host) {
+		return "", false
+	}
+	return strings.TrimSuffix(strings.ToLower(host), "."), true
+}
+
+// resolveDomain returns an address of domain, preferring IPv6: fittingly, a
+// site reachable over IPv6 is looked up by its IPv6 address. Addresses that
+// aren't publicly routed are skipped.
+func resolveDomain(ctx context.Context, domain string) (string, error) {
+	ips, err := resolver.LookupIP(ctx, "ip", domain)
+	if err != nil {
+		var dnsErr *net.DNSError
+		if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+			return "", markError(errUnresolvableDomain, fmt.Errorf("%s doesn't exist or has no addresses", domain))
+		}
+		return "", fmt.Errorf("couldn't resolve %s: %w", domain, err)
+	}
+
+	var ipv4 string
+	for _, ip := range ips {
+		addr, ok := netip.AddrFromSlice(ip)
+		addr = addr.Unmap()
+		if !ok || isNonPublicIP(addr.String()) {
+			continue
+		}
+		if addr.Is6() {
+			return addr.String(), nil
+		}
+		if ipv4 == "" {
+			ipv4 = addr.String()
+		}
+	}
+	if ipv4 == "" {
+		return "", markError(errUnresolvableDomain, fmt.Errorf("%s has no public addresses", domain))
+	}
+	return ipv4, nil
+}
+
+// resolveDomainASN finds the ASN announcing the network that hosts domain,
+// and the address it was found by.
+func (a *App) resolveDomainASN(ctx context.Context, domain string) (asn, ip string, err error) {
+	ip, err = resolveDomain(ctx, domain)
+	if err != nil {
+		return "", "", err
+	}
+	matches, _, err := a.lookupASNByIP(ctx, ip)
+	if err != nil {
+		return "", ip, fmt.Errorf("couldn't find the network of %s (%s): %w", domain, ip, err)
+	}
+	return matches[0].ASN, ip, nil
+}
+
+// domainErrorStatus returns the HTTP status for a failure to find a
+// domain's ASN: 422 when the name itself is the problem, otherwise that of
+// the failed lookup.
+func domainErrorStatus(err error) int {
+	if errors.Is(err, errUnresolvableDomain) {
+		return http.StatusUnprocessableEntity
+	}
+	return lookupErrorStatus(err)
+}
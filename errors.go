@@ -0,0 +1,118 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+)
+
+// Lookup functions mark their errors with one of these, so that handlers can
+// tell the user what to do about a failure with errors.Is.
+var (
+	// ErrUpstreamUnavailable means the source looked up, such as BGPView,
+	// could not be reached or failed.
+	ErrUpstreamUnavailable = errors.New("upstream source is unavailable")
+	// ErrASNNotFound means the source has no record of the ASN.
+	ErrASNNotFound = errors.New("ASN not found")
+	// ErrRateLimited means the source is rate limiting our requests.
+	ErrRateLimited = errors.New("rate limited by upstream source")
+)
+
+// kindError attaches one of the sentinel errors to a detailed error without
+// changing its message.
+type kindError struct {
+	kind error
+	err  error
+}
+
+func (e *kindError) Error() string   { return e.err.Error() }
+func (e *kindError) Unwrap() []error { return []error{e.kind, e.err} }
+
+// markError returns err marked as being of the given kind.
+func markError(kind, err error) error {
+	return &kindError{kind: kind, err: err}
+}
+
+// statusError marks the error for an unexpected upstream HTTP status with
+// the matching sentinel: 404 is ErrASNNotFound, 429 ErrRateLimited and 5xx
+// ErrUpstreamUnavailable. Other statuses are left unmarked.
+func statusError(status int, err error) error {
+	switch {
+	case status == http.StatusNotFound:
+		return markError(ErrASNNotFound, err)
+	case status == http.StatusTooManyRequests:
+		return markError(ErrRateLimited, err)
+	case status >= 500:
+		return markError(ErrUpstreamUnavailable, err)
+	}
+	return err
+}
+
+// errorKind names the kind of a lookup error for the template, which shows
+// advice to match: "not-found", "rate-limited", "unavailable" or "" when the
+// error is none of these.
+func errorKind(err error) string {
+	switch {
+	case errors.Is(err, ErrASNNotFound):
+		return "not-found"
+	case errors.Is(err, ErrRateLimited):
+		return "rate-limited"
+	case errors.Is(err, ErrUpstreamUnavailable):
+		return "unavailable"
+	}
+	return ""
+}
+
+// Error codes of the JSON API, which clients can branch on instead of
+// matching messages.
+const (
+	codeInvalidInput  = "invalid_input"
+	codeNotFound      = "not_found"
+	codeRateLimited   = "rate_limited"
+	codeUpstreamError = "upstream_error"
+)
+
+// errorCode returns the JSON API error code for a lookup error: reserved
+// ASNs are invalid input, and anything else not marked as not found or rate
+// limited is a failure upstream.
+func errorCode(err error) string {
+	var reserved *ReservedASNError
+	switch {
+	case errors.As(err, &reserved):
+		return codeInvalidInput
+	case errors.Is(err, ErrASNNotFound):
+		return codeNotFound
+	case errors.Is(err, ErrRateLimited):
+		return codeRateLimited
+	}
+	return codeUpstreamError
+}
+
+// apiError is the body of every JSON API error response.
+type apiError struct {
+	Error struct {
+		Code              string `json:"code"`
+		Message           string `json:"message"`
+		RetryAfterSeconds int    `json:"retry_after_seconds,omitempty"`
+	} `json:"error"`
+}
+
+// writeAPIError answers a JSON API request with status and an apiError
+// carrying code and err's message.
+func writeAPIError(w http.ResponseWriter, status int, code string, err error) {
+	var body apiError
+	body.Error.Code = code
+	body.Error.Message = err.Error()
+	body.Error.RetryAfterSeconds = retryAfterSeconds(err)
+	setRetryAfter(w, err)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+// writeLookupAPIError answers a JSON API request whose lookup failed with
+// err, with the status and code matching the error.
+func writeLookupAPIError(w http.ResponseWriter, err error) {
+	writeAPIError(w, lookupErrorStatus(err), errorCode(err), err)
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"net/http"
+	"sync"
+	"time"
+)
+
+// recentEventsSize is how many events of each kind are kept for /admin.
+const recentEventsSize = 50
+
+// eventRing keeps the last events of one kind in memory, overwriting the
+// oldest once full.
+type eventRing[T any] struct {
+	mu     sync.Mutex
+	events []T
+	next   int // where the next event goes once events is full
+}
+
+// newEventRing returns a ring keeping the last size events.
+func newEventRing[T any](size int) *eventRing[T] {
+	return &eventRing[T]{events: make([]T, 0, size)}
+}
+
+// add records e, dropping the oldest event if the ring is full.
+func (r *eventRing[T]) add(e T) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.events) < cap(r.events) {
+		r.events = append(r.events, e)
+		return
+	}
+	r.events[r.next] = e
+	r.next = (r.next + 1) % len(r.events)
+}
+
+// recent returns the kept events, newest first.
+func (r *eventRing[T]) recent() []T {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	recent := make([]T, 0, len(r.events))
+	for i := len(r.events) - 1; i >= 0; i-- {
+		recent = append(recent, r.events[(r.next+i)%len(r.events)])
+	}
+	return recent
+}
+
+// lookupEvent is an ASN looked up on /.
+type lookupEvent struct {
+	Time     time.Time
+	ASN      string
+	Prefixes int    // IPv6 prefixes found
+	Cached   bool   // whether the prefixes came from the cache
+	Error    string // if the lookup failed
+	Duration time.Duration
+}
+
+// upstreamEvent is one attempt at a BGPView request.
+type upstreamEvent struct {
+	Time     time.Time
+	Path     string
+	Status   int    // of the response, or 0 if there was none
+	Error    string // if there was no response
+	Duration time.Duration
+}
+
+// upstreamEvents are the latest BGPView requests made by the process. Like
+// the circuit breaker, it is shared by every App.
+var upstreamEvents = newEventRing[upstreamEvent](recentEventsSize)
+
+// recordUpstreamAttempt records a BGPView request started at start, which
+// got resp or else failed with err.
+func recordUpstreamAttempt(start time.Time, resp *http.Response, err error) {
+	e := upstreamEvent{Time: start, Duration: time.Since(start).Round(time.Millisecond)}
+	switch {
+	case err != nil:
+		e.Error = err.Error()
+	case resp != nil:
+		e.Status = resp.StatusCode
+		if resp.Request != nil {
+			e.Path = resp.Request.URL.Path
+		}
+	}
+	upstreamEvents.add(e)
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// fixtureTransport is an http.RoundTripper that answers BGPView requests from
+// canned JSON files on disk instead of the network. The file for a request is
+// found by appending ".json" to the URL path, so the responses for ASN 19625
+// live at:
+//
+//	<dir>/asn/19625.json           (bgpViewASNData)
+//	<dir>/asn/19625/prefixes.json  (bgpViewData)
+//	<dir>/ip/192.0.2.1.json        (bgpViewIPData)
+//
+// A missing file is answered with a 404, just as BGPView would for an unknown
+// resource.
+type fixtureTransport struct {
+	dir string
+}
+
+func (t fixtureTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	name := strings.Trim(req.URL.Path, "/")
+	if name == "" || strings.Contains(name, "..") {
+		return fixtureResponse(req, http.StatusBadRequest, nil), nil
+	}
+
+	body, err := os.ReadFile(filepath.Join(t.dir, filepath.FromSlash(name)+".json"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return fixtureResponse(req, http.StatusNotFound, nil), nil
+		}
+		return nil, fmt.Errorf("failed to read fixture for %s: %w", req.URL.Path, err)
+	}
+
+	return fixtureResponse(req, http.StatusOK, body), nil
+}
+
+// fixtureResponse builds a minimal JSON response for the given request.
+func fixtureResponse(req *http.Request, status int, body []byte) *http.Response {
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		StatusCode:    status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": []string{"application/json"}},
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}
+}
+
+// useFixtures switches all of a's BGPView lookups to read from dir.
+func (a *App) useFixtures(dir string) {
+	a.logInfof("Offline mode: serving BGPView lookups from fixtures in %s", dir)
+	a.client.Transport = fixtureTransport{dir: dir}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"net/netip"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// GeoPrefix is a prefix with the country it is registered in, as recorded by
+// its RIR. Prefixes registered to a region rather than a country, such as
+// "EU" or "AP", carry the region's code. With -rpki and -rdns, it also
+// carries the prefix's RPKI validation and reverse DNS delegation statuses.
+// It prints as the bare prefix.
+type GeoPrefix struct {
+	Prefix      string
+	CountryCode string // "" if the RIR data has no country
+	RPKIStatus  string // rpkiValid, rpkiInvalid, rpkiNotFound or "" if unchecked
+	ReverseDNS  string // reverseDNSDelegated, reverseDNSMissing or "" if unchecked
+}
+
+// RPKIClass returns the CSS class coloring the prefix's RPKI status.
+func (p GeoPrefix) RPKIClass() string { return "rpki-" + strings.ToLower(p.RPKIStatus) }
+
+func (p GeoPrefix) String() string { return p.Prefix }
+
+// Expanded returns the prefix with its address written out in full, such as
+// "2001:0db8:0000:0000:0000:0000:0000:0000/32", or the prefix unchanged if
+// it doesn't parse.
+func (p GeoPrefix) Expanded() string {
+	prefix, err := netip.ParsePrefix(p.Prefix)
+	if err != nil {
+		return p.Prefix
+	}
+	return prefix.Addr().StringExpanded() + "/" + strconv.Itoa(prefix.Bits())
+}
+
+// CountryName returns the English name of the prefix's country or region,
+// or "".
+func (p GeoPrefix) CountryName() string { return countryName(p.CountryCode) }
+
+// CountryFlag returns the flag emoji of the prefix's country, or "".
+func (p GeoPrefix) CountryFlag() string { return countryFlag(p.CountryCode) }
+
+// annotatePrefixes pairs each prefix with its country from countries, which
+// may be nil.
+func annotatePrefixes(prefixes []string, countries map[string]string) []GeoPrefix {
+	annotated := make([]GeoPrefix, len(prefixes))
+	for i, prefix := range prefixes {
+		annotated[i] = GeoPrefix{Prefix: prefix, CountryCode: countries[prefix]}
+	}
+	return annotated
+}
+
+// cacheGetPrefixCountries returns the cached countries of an ASN's IPv6
+// prefixes from source, and their age.
+func (a *App) cacheGetPrefixCountries(source, asn string) (map[string]string, time.Duration, bool) {
+	return cacheGetAs[map[string]string](a.cache, cacheKey(source, "prefix_countries", asn))
+}
+
+// cacheSetPrefixCountries caches the countries of an ASN's IPv6 prefixes
+// from source.
+func (a *App) cacheSetPrefixCountries(source, asn string, countries map[string]string, ttl time.Duration) {
+	a.cache.Set(cacheKey(source, "prefix_countries", asn), countries, ttl)
+}
+
+// lookupPrefixCountries returns the registered country of each IPv6 prefix
+// of asn, keyed by prefix. BGPView reports them alongside the prefixes, so
+// they are cached together and a lookup right after lookupIPv6 costs no
+// extra upstream call.
+func (a *App) lookupPrefixCountries(ctx context.Context, asn string) (map[string]string, error) {
+	if !cacheBypassed(ctx) {
+		if countries, _, found := a.cacheGetPrefixCountries(a.source.Name(), asn); found {
+			return countries, nil
+		}
+	}
+
+	v, err := a.lookups.Do(ctx, cacheKey(a.source.Name(), "all_prefixes", asn), func(ctx context.Context) (interface{}, error) {
+		return a.fetchAllPrefixes(ctx, asn)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.(allPrefixes).IPv6Countries, nil
+}
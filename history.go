@@ -0,0 +1,230 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// historyInterval is how often an ASN's prefix count is recorded at
+	// most, however often it is looked up.
+	historyInterval = 24 * time.Hour
+	// historyMaxRecords is how many records are kept per ASN, the oldest
+	// being dropped first: a year of daily records.
+	historyMaxRecords = 366
+)
+
+// historyRecord is one observation of an ASN's IPv6 prefix count. Records are
+// stored one JSON object per line.
+type historyRecord struct {
+	ASN             string    `json:"asn"`
+	Timestamp       time.Time `json:"timestamp"`
+	IPv6PrefixCount int       `json:"ipv6_prefix_count"`
+}
+
+// historyStore is an append-only log of historyRecords, kept in memory and
+// mirrored to a file so it survives restarts. Once the file holds twice as
+// many records as are kept, it is rewritten without the dropped ones.
+type historyStore struct {
+	path string
+
+	mu      sync.Mutex
+	file    *os.File
+	records map[string][]historyRecord
+	kept    int // records in records
+	written int // records in file, including dropped ones
+}
+
+// prefixTrend summarises how an ASN's IPv6 prefix count has changed.
+type prefixTrend struct {
+	FirstCount int
+	LastCount  int
+	Days       int
+	Sparkline  string
+}
+
+// openHistory loads existing records from path, creating the file if needed.
+func openHistory(path string) (*historyStore, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open history file %s: %w", path, err)
+	}
+
+	h := &historyStore{
+		path:    path,
+		file:    f,
+		records: make(map[string][]historyRecord),
+	}
+
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		h.written++
+		var rec historyRecord
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			log.Printf("Skipping malformed history record at %s:%d: %v", path, line, err)
+			continue
+		}
+		h.add(rec)
+	}
+	if err := scanner.Err(); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to read history file %s: %w", path, err)
+	}
+	if h.written > h.kept {
+		if err := h.compact(); err != nil {
+			f.Close()
+			return nil, err
+		}
+	}
+
+	return h, nil
+}
+
+// add keeps rec, dropping the oldest record of its ASN if it has
+// historyMaxRecords already. The caller must hold h.mu, if h is shared.
+func (h *historyStore) add(rec historyRecord) {
+	records := append(h.records[rec.ASN], rec)
+	h.kept++
+	if len(records) > historyMaxRecords {
+		records = append(records[:0:0], records[len(records)-historyMaxRecords:]...)
+		h.kept -= len(h.records[rec.ASN]) + 1 - historyMaxRecords
+	}
+	h.records[rec.ASN] = records
+}
+
+// Record appends an observation of asn's IPv6 prefix count, unless asn
+// was already recorded within historyInterval.
+func (h *historyStore) Record(asn string, count int) error {
+	rec := historyRecord{ASN: asn, Timestamp: time.Now().UTC(), IPv6PrefixCount: count}
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if records := h.records[asn]; len(records) > 0 && rec.Timestamp.Sub(records[len(records)-1].Timestamp) < historyInterval {
+		return nil
+	}
+	if _, err := h.file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to write history record: %w", err)
+	}
+	h.written++
+	h.add(rec)
+	if h.written > 2*h.kept {
+		return h.compact()
+	}
+	return nil
+}
+
+// compact rewrites the history file with only the kept records, replacing
+// it atomically so a crash can't lose the history. The caller must hold
+// h.mu, if h is shared.
+func (h *historyStore) compact() error {
+	asns := make([]string, 0, len(h.records))
+	for asn := range h.records {
+		asns = append(asns, asn)
+	}
+	sort.Strings(asns)
+
+	tmp, err := os.CreateTemp(filepath.Dir(h.path), ".history-*")
+	if err != nil {
+		return fmt.Errorf("failed to compact history file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	w := bufio.NewWriter(tmp)
+	enc := json.NewEncoder(w)
+	for _, asn := range asns {
+		for _, rec := range h.records[asn] {
+			if err := enc.Encode(rec); err != nil {
+				tmp.Close()
+				return fmt.Errorf("failed to compact history file: %w", err)
+			}
+		}
+	}
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to compact history file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to compact history file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), h.path); err != nil {
+		return fmt.Errorf("failed to compact history file: %w", err)
+	}
+
+	f, err := os.OpenFile(h.path, os.O_RDWR|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to reopen history file %s: %w", h.path, err)
+	}
+	h.file.Close()
+	h.file = f
+	h.written = h.kept
+	return nil
+}
+
+// Trend compares the earliest recorded count for asn with current. It returns
+// nil when there is no record at least a day old to compare against, since a
+// trend over zero days says nothing.
+func (h *historyStore) Trend(asn string, current int) *prefixTrend {
+	h.mu.Lock()
+	records := append([]historyRecord(nil), h.records[asn]...)
+	h.mu.Unlock()
+
+	if len(records) == 0 || time.Since(records[0].Timestamp) < 24*time.Hour {
+		return nil
+	}
+
+	counts := make([]int, 0, len(records)+1)
+	for _, rec := range records {
+		counts = append(counts, rec.IPv6PrefixCount)
+	}
+	counts = append(counts, current)
+
+	return &prefixTrend{
+		FirstCount: records[0].IPv6PrefixCount,
+		LastCount:  current,
+		Days:       int(time.Since(records[0].Timestamp).Hours() / 24),
+		Sparkline:  sparkline(counts),
+	}
+}
+
+// sparklineLevels are the block characters used to draw a sparkline, from
+// lowest to highest.
+var sparklineLevels = []rune("▁▂▃▄▅▆▇█")
+
+// sparkline renders values as a string of block characters scaled between
+// their minimum and maximum. Only the most recent 30 values are drawn.
+func sparkline(values []int) string {
+	if len(values) > 30 {
+		values = values[len(values)-30:]
+	}
+	if len(values) == 0 {
+		return ""
+	}
+
+	lo, hi := values[0], values[0]
+	for _, v := range values {
+		lo = min(lo, v)
+		hi = max(hi, v)
+	}
+
+	var b strings.Builder
+	for _, v := range values {
+		level := 0
+		if hi > lo {
+			level = (v - lo) * (len(sparklineLevels) - 1) / (hi - lo)
+		}
+		b.WriteRune(sparklineLevels[level])
+	}
+	return b.String()
+}
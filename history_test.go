@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHistoryStoreBounded(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.jsonl")
+
+	// A file written before records were limited: one per lookup for years
+	var old bytes.Buffer
+	enc := json.NewEncoder(&old)
+	start := time.Now().UTC().AddDate(-2, 0, 0)
+	for i := 0; i < 2*historyMaxRecords; i++ {
+		enc.Encode(historyRecord{ASN: "19625", Timestamp: start.Add(time.Duration(i) * time.Hour), IPv6PrefixCount: i})
+	}
+	enc.Encode(historyRecord{ASN: "64500", Timestamp: start, IPv6PrefixCount: 1})
+	if err := os.WriteFile(path, old.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	h, err := openHistory(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := len(h.records["19625"]); got != historyMaxRecords {
+		t.Errorf("kept %d records of AS19625, want %d", got, historyMaxRecords)
+	}
+	if got := h.records["19625"][0].IPv6PrefixCount; got != historyMaxRecords {
+		t.Errorf("oldest kept record has count %d, want %d", got, historyMaxRecords)
+	}
+	if got := countLines(t, path); got != historyMaxRecords+1 {
+		t.Errorf("compacted file has %d records, want %d", got, historyMaxRecords+1)
+	}
+
+	// Only the first of several lookups within historyInterval is recorded
+	for i := 0; i < 3; i++ {
+		if err := h.Record("64500", 5); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := len(h.records["64500"]); got != 2 {
+		t.Errorf("%d records of AS64500 after repeated lookups, want 2", got)
+	}
+	if got := countLines(t, path); got != historyMaxRecords+2 {
+		t.Errorf("file has %d records, want %d", got, historyMaxRecords+2)
+	}
+	if trend := h.Trend("64500", 5); trend == nil || trend.FirstCount != 1 || trend.LastCount != 5 {
+		t.Errorf("Trend = %+v, want from 1 to 5", trend)
+	}
+}
+
+func TestHistoryTrendNeedsADay(t *testing.T) {
+	h, err := openHistory(filepath.Join(t.TempDir(), "history.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if trend := h.Trend("19625", 2); trend != nil {
+		t.Errorf("Trend with no records = %+v, want nil", trend)
+	}
+	if err := h.Record("19625", 2); err != nil {
+		t.Fatal(err)
+	}
+	if trend := h.Trend("19625", 2); trend != nil {
+		t.Errorf("Trend over the same day = %+v, want nil", trend)
+	}
+
+	h.records["19625"][0].Timestamp = time.Now().Add(-25 * time.Hour)
+	if trend := h.Trend("19625", 3); trend == nil || trend.Days != 1 || trend.FirstCount != 2 || trend.LastCount != 3 {
+		t.Errorf("Trend = %+v, want from 2 to 3 over 1 day", trend)
+	}
+}
+
+func TestLookupRecordsHistory(t *testing.T) {
+	for _, path := range []string{"/", "/?format=md"} {
+		t.Run(path, func(t *testing.T) {
+			a := newTestApp(t, bgpViewStub(map[string]string{
+				"/asn/19625":          bgpViewASN19625,
+				"/asn/19625/prefixes": bgpViewPrefixes19625,
+			}), "-db-file", filepath.Join(t.TempDir(), "history.jsonl"))
+
+			r := httptest.NewRequest(http.MethodPost, path, strings.NewReader("asn=19625"))
+			r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			w := httptest.NewRecorder()
+			a.newRouter().ServeHTTP(w, r)
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, want %d", w.Code, http.StatusOK)
+			}
+			if records := a.history.records["19625"]; len(records) != 1 || records[0].IPv6PrefixCount != 2 {
+				t.Errorf("history of AS19625 = %+v, want one record of 2 prefixes", records)
+			}
+		})
+	}
+}
+
+func countLines(t *testing.T, path string) int {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return bytes.Count(data, []byte("\n"))
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"net/netip"
+	"sort"
+	"strings"
+	"time"
+)
+
+// cacheGetIPv4Prefixes returns the cached IPv4 prefixes for an ASN from
+// source, and their age.
+func (a *App) cacheGetIPv4Prefixes(source, asn string) ([]string, time.Duration, bool) {
+	return cacheGetAs[[]string](a.cache, cacheKey(source, "ipv4_prefixes", asn))
+}
+
+// cacheSetIPv4Prefixes caches the IPv4 prefixes for an ASN from source.
+func (a *App) cacheSetIPv4Prefixes(source, asn string, prefixes []string, ttl time.Duration) {
+	a.cache.Set(cacheKey(source, "ipv4_prefixes", asn), prefixes, ttl)
+}
+
+// lookupIPv4 looks up the IPv4 prefixes associated with an ASN in the -source.
+func (a *App) lookupIPv4(ctx context.Context, asn string) ([]string, error) {
+	// Check cache first
+	if !cacheBypassed(ctx) {
+		if prefixes, _, found := a.cacheGetIPv4Prefixes(a.source.Name(), asn); found {
+			return prefixes, nil
+		}
+	}
+
+	all, err := a.lookupAllPrefixes(ctx, asn)
+	return all.IPv4, err
+}
+
+// ipv4AddressCount returns the number of distinct addresses in prefixes.
+// Prefixes covered by another one in the list, such as more-specifics of an
+// aggregate, are only counted once; unparseable and IPv6 prefixes are
+// skipped.
+func ipv4AddressCount(prefixes []string) uint64 {
+	var parsed []netip.Prefix
+	for _, p := range prefixes {
+		prefix, err := netip.ParsePrefix(strings.TrimSpace(p))
+		if err != nil || !prefix.Addr().Is4() {
+			continue
+		}
+		parsed = append(parsed, prefix.Masked())
+	}
+
+	// Shortest first, so that an aggregate is kept before the prefixes it
+	// covers are considered
+	sort.Slice(parsed, func(i, j int) bool { return parsed[i].Bits() < parsed[j].Bits() })
+
+	var kept []netip.Prefix
+	var total uint64
+	for _, prefix := range parsed {
+		covered := false
+		for _, k := range kept {
+			if k.Contains(prefix.Addr()) {
+				covered = true
+				break
+			}
+		}
+		if !covered {
+			kept = append(kept, prefix)
+			total += 1 << (32 - prefix.Bits())
+		}
+	}
+	return total
+}
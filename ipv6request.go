@@ -1,31 +1,127 @@
 package main
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
-	"flag"
+	"errors"
 	"fmt"
-	"html/template"
+	"io"
 	"log"
-	"math"
 	"net"
 	"net/http"
+	"net/netip"
+	"net/url"
 	"os"
 	"os/exec"
 	"os/signal"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 )
 
-// httpClient is used for making HTTP requests with a timeout.
-var httpClient = &http.Client{Timeout: 8 * time.Second}
+// upstreamTimeout bounds a single request to BGPView.
+const upstreamTimeout = 8 * time.Second
 
-// Simple cache to reduce API calls
+// defaultBGPViewBase is the base URL of the BGPView API. -bgpview-base can
+// point at a BGPView-compatible mirror or a mock server instead.
+const defaultBGPViewBase = "https://api.bgpview.io"
+
+// defaultContactURL is included in the User-Agent of outbound requests so
+// that upstream operators can reach whoever runs this instance, unless
+// -contact gives another.
+const defaultContactURL = "https://github.com/buraglio/ipv6request"
+
+// userAgent returns the User-Agent sent with outbound requests, e.g.
+// "ipv6request/1.2.0 (+https://example.net/contact)".
+func (a *App) userAgent() string {
+	ua := "ipv6request/" + version
+	if a.cfg.Contact != "" {
+		ua += " (+" + a.cfg.Contact + ")"
+	}
+	return ua
+}
+
+// defaultRequestTimeout bounds the time spent serving a single incoming
+// request, including all upstream lookups and retries.
+const defaultRequestTimeout = 15 * time.Second
+
+// Default connection timeouts of the HTTP server, so that slow or idle
+// clients can't hold connections open indefinitely. The write timeout
+// covers the whole handler, so it is longer than defaultRequestTimeout.
+const (
+	defaultReadHeaderTimeout = 5 * time.Second
+	defaultReadTimeout       = 10 * time.Second
+	defaultWriteTimeout      = 30 * time.Second
+	defaultIdleTimeout       = 2 * time.Minute
+)
+
+// withRequestTimeout attaches a deadline of d to every request's context so
+// that upstream lookups are abandoned once it passes.
+func withRequestTimeout(h http.Handler, d time.Duration) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), d)
+		defer cancel()
+		h.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// CacheBackend stores lookup results for a limited time. The in-memory Cache
+// is the default; RedisCache lets several instances share one cache. Get
+// also returns how long ago the value was stored. Keys, TTL, Len and Flush
+// let operators inspect and clear the cache through /admin/cache.
+type CacheBackend interface {
+	Get(key string) (interface{}, time.Duration, bool)
+	Set(key string, value interface{}, ttl time.Duration)
+
+	// Keys returns the keys of all unexpired entries, in no particular
+	// order.
+	Keys() []string
+	// TTL returns how much longer the entry under key will be kept.
+	TTL(key string) (time.Duration, bool)
+	// Len returns the number of unexpired entries.
+	Len() int
+	// Flush removes every entry.
+	Flush()
+	// Stats returns the backend's hit, miss, store and eviction counts.
+	Stats() CacheStats
+}
+
+// CacheStats counts cache accesses since the backend was created.
+type CacheStats struct {
+	Hits      int64 `json:"hits"`
+	Misses    int64 `json:"misses"`
+	Sets      int64 `json:"sets"`
+	Evictions int64 `json:"evictions"`
+}
+
+// cacheCounters keeps CacheStats for a backend. Its counters are atomic, so
+// they can be updated without holding the backend's lock.
+type cacheCounters struct {
+	hits, misses, sets, evictions atomic.Int64
+}
+
+// Stats returns a snapshot of the counters.
+func (c *cacheCounters) Stats() CacheStats {
+	return CacheStats{
+		Hits:      c.hits.Load(),
+		Misses:    c.misses.Load(),
+		Sets:      c.sets.Load(),
+		Evictions: c.evictions.Load(),
+	}
+}
+
+// Simple cache to reduce API calls. Expired entries are evicted when they
+// are next looked up.
 type Cache struct {
 	data map[string]CacheEntry
 	mu   sync.RWMutex
+	cacheCounters
 }
 
 type CacheEntry struct {
@@ -34,24 +130,41 @@ type CacheEntry struct {
 	ttl       time.Duration
 }
 
-var cache = &Cache{
-	data: make(map[string]CacheEntry),
+// newCache returns an empty in-memory cache.
+func newCache() *Cache {
+	return &Cache{data: make(map[string]CacheEntry)}
 }
 
-func (c *Cache) Get(key string) (interface{}, bool) {
+func (c *Cache) Get(key string) (interface{}, time.Duration, bool) {
 	c.mu.RLock()
-	defer c.mu.RUnlock()
-
 	entry, exists := c.data[key]
+	c.mu.RUnlock()
 	if !exists {
-		return nil, false
+		c.misses.Add(1)
+		return nil, 0, false
 	}
 
-	if time.Since(entry.timestamp) > entry.ttl {
-		return nil, false
+	age := time.Since(entry.timestamp)
+	if age > entry.ttl {
+		c.misses.Add(1)
+		c.evict(key)
+		return nil, 0, false
 	}
 
-	return entry.value, true
+	c.hits.Add(1)
+	return entry.value, age, true
+}
+
+// evict removes the entry under key if it is still expired; it may have
+// been replaced since it was found to be.
+func (c *Cache) evict(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if entry, exists := c.data[key]; exists && time.Since(entry.timestamp) > entry.ttl {
+		delete(c.data, key)
+		c.evictions.Add(1)
+	}
 }
 
 func (c *Cache) Set(key string, value interface{}, ttl time.Duration) {
@@ -63,14 +176,184 @@ func (c *Cache) Set(key string, value interface{}, ttl time.Duration) {
 		timestamp: time.Now(),
 		ttl:       ttl,
 	}
+	c.sets.Add(1)
+}
+
+func (c *Cache) Keys() []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	keys := make([]string, 0, len(c.data))
+	for key, entry := range c.data {
+		if time.Since(entry.timestamp) <= entry.ttl {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+func (c *Cache) TTL(key string) (time.Duration, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	entry, exists := c.data[key]
+	if !exists {
+		return 0, false
+	}
+	left := entry.ttl - time.Since(entry.timestamp)
+	if left < 0 {
+		return 0, false
+	}
+	return left, true
+}
+
+func (c *Cache) Len() int {
+	return len(c.Keys())
+}
+
+func (c *Cache) Flush() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.data = make(map[string]CacheEntry)
+}
+
+// cacheGetAs returns the value cached in c under key as a T, and its age. Backends
+// that store serialized values hand back a json.RawMessage, which is decoded
+// into T.
+func cacheGetAs[T any](c CacheBackend, key string) (T, time.Duration, bool) {
+	var value T
+	cached, age, found := c.Get(key)
+	if !found {
+		return value, 0, false
+	}
+	if raw, ok := cached.(json.RawMessage); ok {
+		if err := json.Unmarshal(raw, &value); err != nil {
+			log.Printf("Discarding undecodable cache entry %s: %v", key, err)
+			return value, 0, false
+		}
+		return value, age, true
+	}
+	value, ok := cached.(T)
+	return value, age, ok
+}
+
+// sourceBGPView is the cache namespace for data fetched from the BGPView API.
+// Every data source gets its own namespace so that identical lookups against
+// different providers never share cache entries.
+const sourceBGPView = "bgpview"
+
+// PrefixLookup is a source of the prefixes ASNs announce and of their
+// details, selected with -source and -rir-sources. Its results are cached by
+// the lookup functions, under its Name. Detection, upstreams and search
+// always use BGPView.
+type PrefixLookup interface {
+	// Name is the source's name for -source and its cache namespace.
+	Name() string
+	// Label is the source's name as shown to users, like "BGPView".
+	Label() string
+	// FetchPrefixes returns the IPv4 and IPv6 prefixes asn announces. The
+	// countries of the IPv6 prefixes may be left out.
+	FetchPrefixes(ctx context.Context, asn string) (allPrefixes, error)
+	// FetchASNDetails returns what the source knows about asn, marking
+	// the error with ErrASNNotFound if it has no record of it.
+	FetchASNDetails(ctx context.Context, asn string) (*ASNDetails, error)
+}
+
+// bgpViewSource is the PrefixLookup backed by the BGPView API.
+type bgpViewSource struct {
+	app *App
+}
+
+func (bgpViewSource) Name() string  { return sourceBGPView }
+func (bgpViewSource) Label() string { return "BGPView" }
+
+// cacheKey builds a namespaced cache key of the form "source:kind:id".
+func cacheKey(source, kind, id string) string {
+	return source + ":" + kind + ":" + id
+}
+
+// MatchedASN is an ASN originating a prefix that covers an IP address.
+type MatchedASN struct {
+	ASN    string
+	Name   string
+	Prefix string
+}
+
+// cacheGetPrefixes returns the cached IPv6 prefixes for an ASN from source,
+// and their age.
+func (a *App) cacheGetPrefixes(source, asn string) ([]string, time.Duration, bool) {
+	return cacheGetAs[[]string](a.cache, cacheKey(source, "prefixes", asn))
+}
+
+// cacheSetPrefixes caches the IPv6 prefixes for an ASN from source.
+func (a *App) cacheSetPrefixes(source, asn string, prefixes []string, ttl time.Duration) {
+	a.cache.Set(cacheKey(source, "prefixes", asn), prefixes, ttl)
+}
+
+// cacheGetASNDetails returns the cached details for an ASN from source, and
+// their age.
+func (a *App) cacheGetASNDetails(source, asn string) (*ASNDetails, time.Duration, bool) {
+	return cacheGetAs[*ASNDetails](a.cache, cacheKey(source, "details", asn))
+}
+
+// cacheSetASNDetails caches the details for an ASN from source.
+func (a *App) cacheSetASNDetails(source, asn string, details *ASNDetails, ttl time.Duration) {
+	a.cache.Set(cacheKey(source, "details", asn), details, ttl)
+}
+
+// cacheGetIPASN returns the cached ASN lookup for an IP from source, and its
+// age.
+func (a *App) cacheGetIPASN(source, ip string) ([]MatchedASN, time.Duration, bool) {
+	return cacheGetAs[[]MatchedASN](a.cache, cacheKey(source, "ip", ip))
+}
+
+// cacheSetIPASN caches the ASN lookup for an IP from source.
+func (a *App) cacheSetIPASN(source, ip string, matches []MatchedASN, ttl time.Duration) {
+	a.cache.Set(cacheKey(source, "ip", ip), matches, ttl)
+}
+
+// defaultNegativeCacheTTL is how long empty and not-found results are cached
+// unless -negative-cache-ttl says otherwise. It is much shorter than for real
+// data, so that an ASN which starts announcing IPv6 shows up soon, but long
+// enough that repeated lookups of bad input don't each cost an upstream call.
+const defaultNegativeCacheTTL = 5 * time.Minute
+
+// prefixCacheTTL returns how long to cache a prefix list: an hour, or the
+// negative cache TTL if it is empty.
+func (a *App) prefixCacheTTL(prefixes []string) time.Duration {
+	if len(prefixes) == 0 {
+		return a.cfg.NegativeCacheTTL
+	}
+	return 1 * time.Hour
+}
+
+// cacheGetNotFound returns the cached "not found" error for a lookup of kind
+// for id from source, marked as ErrASNNotFound.
+func (a *App) cacheGetNotFound(source, kind, id string) (error, bool) {
+	msg, _, found := cacheGetAs[string](a.cache, cacheKey(source, kind+"-notfound", id))
+	if !found {
+		return nil, false
+	}
+	return markError(ErrASNNotFound, errors.New(msg)), true
+}
+
+// cacheSetNotFound caches err as the "not found" result for a lookup of kind
+// for id from source, for the negative cache TTL.
+func (a *App) cacheSetNotFound(source, kind, id string, err error) {
+	a.cache.Set(cacheKey(source, kind+"-notfound", id), err.Error(), a.cfg.NegativeCacheTTL)
 }
 
 // bgpViewData represents the structure of the JSON response from BGPView API
-// for ASN IPv6 prefixes.
+// for ASN prefixes.
 type bgpViewData struct {
 	Data struct {
-		IPv6Prefixes []struct {
+		IPv4Prefixes []struct {
 			Prefix string `json:"prefix"`
+		} `json:"ipv4_prefixes"`
+		IPv6Prefixes []struct {
+			Prefix      string `json:"prefix"`
+			CountryCode string `json:"country_code"`
 		} `json:"ipv6_prefixes"`
 	} `json:"data"`
 }
@@ -81,7 +364,8 @@ type bgpViewIPData struct {
 	Data struct {
 		IP       string `json:"ip"`
 		Prefixes []struct {
-			ASN struct {
+			Prefix string `json:"prefix"`
+			ASN    struct {
 				ASN         int    `json:"asn"`
 				Name        string `json:"name"`
 				Description string `json:"description"`
@@ -137,102 +421,276 @@ type ASNDetails struct {
 	IANAAssignment   string
 	WhoisServer      string
 	DateUpdated      string
+	// Source is the Label of the source the details came from.
+	Source string
 }
 
 // pageData holds the data to be rendered in the HTML template.
 type pageData struct {
-	ASN          string
-	Prefixes     []string
-	Error        string
-	SourceIP     string
-	DetectedASN  string
-	ASNName      string
-	AutoDetected bool
-	ASNDetails   *ASNDetails
-}
-
-// indexTemplate is the HTML template for the web interface.
-var indexTemplate = template.Must(template.New("index").Parse(`
+	ASN      string
+	Prefixes []string
+	// VisiblePrefixes are rendered directly and HiddenPrefixes behind a
+	// "show all" toggle, so huge prefix lists stay readable.
+	VisiblePrefixes []GeoPrefix
+	HiddenPrefixes  []GeoPrefix
+	// ExpandedPrefixes lists the prefixes in fully expanded notation, as
+	// asked for with ?notation=expanded.
+	ExpandedPrefixes   bool
+	Error              string
+	ErrorKind          string // see errorKind
+	SourceIP           string
+	DetectedASN        string
+	ASNName            string
+	DetectedPrefix     string
+	MatchedASNs        []MatchedASN
+	Freshness          *Freshness // of Prefixes
+	DetailsFreshness   *Freshness
+	DetectionFreshness *Freshness
+	PeersFreshness     *Freshness
+	Refreshed          bool
+	Source             string // Label of the -source, for the advice shown with lookups
+	RetryAfter         int    // seconds until a rate-limited lookup is worth retrying
+	RefreshWait        int    // seconds until the client may refresh again
+	SearchQuery        string
+	SearchResults      []ASNSearchResult
+	AutoDetected       bool
+	ASNDetails         *ASNDetails
+	Readiness          string
+	PrefixAnalysis     *PrefixAnalysis
+	Message            string
+	MessageOptions     MessageOptions
+	MessageTones       []string
+	Peers              *ASNPeers
+	Trend              *prefixTrend
+	MailtoURL          string
+	SupportForm        *SupportFormLink
+	// ShowMessage renders the message expanded, for clients without
+	// JavaScript that submitted the Generate button.
+	ShowMessage bool
+	// AnnouncesNothing is set when the ASN announces neither IPv6 nor
+	// IPv4 prefixes.
+	AnnouncesNothing bool
+	// PrivateNetwork is set when the client address is private or reserved
+	// and auto-detection was skipped.
+	PrivateNetwork bool
+	// Domain is the website the ASN was looked up for, found by resolving
+	// it to DomainIP.
+	Domain   string
+	DomainIP string
+	// ASSet is the expanded AS-SET when one was looked up instead of an ASN.
+	ASSet *ASSetResult
+	// ConnectedOver is "IPv6" or "IPv4", the address family of the
+	// connection the page was requested over.
+	ConnectedOver string
+	// DetailsStatus, PrefixesStatus and PeersStatus are the sectionStatus
+	// of each lookup of an ASN, so that a page missing one section while
+	// showing another can say why.
+	DetailsStatus  string
+	PrefixesStatus string
+	PeersStatus    string
+	// ReverseDNSChecked is how many prefixes were checked for reverse DNS
+	// delegation with -rdns, and ReverseDNSMissing how many lack it.
+	ReverseDNSChecked int
+	ReverseDNSMissing int
+	// Preview fills in the page's link preview tags for a lookup.
+	Preview *SharePreview
+}
+
+// Statuses of a section of the results page.
+const (
+	sectionLoaded      = ""
+	sectionMissing     = "missing"     // the source has no such data
+	sectionUnavailable = "unavailable" // the lookup failed, likely temporarily
+)
+
+// sectionStatus returns the status of a section whose lookup returned err.
+func sectionStatus(err error) string {
+	switch {
+	case err == nil:
+		return sectionLoaded
+	case errors.Is(err, ErrASNNotFound):
+		return sectionMissing
+	}
+	return sectionUnavailable
+}
+
+// ipv6Readiness returns a short verdict on an ASN's IPv6 deployment based on
+// the prefixes it announces: "Full" when any IPv6 prefix is announced and
+// "None" otherwise.
+func ipv6Readiness(prefixes []string) string {
+	if len(prefixes) > 0 {
+		return "Full"
+	}
+	return "None"
+}
+
+// indexTemplateHTML is the built-in HTML template for the web interface,
+// used unless -template-file names another.
+const indexTemplateHTML = `
 <!DOCTYPE html>
-<html>
+<html lang="en">
 <head>
+    <meta charset="utf-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1">
     <title>Does your provider Support IPv6?</title>
-    <style>
-        body { font-family: sans-serif; margin: 20px; }
-        .container { max-width: 600px; margin: auto; padding: 20px; border: 1px solid #ccc; border-radius: 8px; box-shadow: 0 2px 4px rgba(0,0,0,0.1); }
-        h1 { text-align: center; color: #333; }
-        form { display: flex; flex-direction: column; gap: 10px; margin-bottom: 20px; }
-        label { font-weight: bold; }
-        input[type="text"] { padding: 8px; border: 1px solid #ddd; border-radius: 4px; }
-        input[type="submit"] { padding: 10px 15px; background-color: #007bff; color: white; border: none; border-radius: 4px; cursor: pointer; font-size: 16px; }
-        input[type="submit"]:hover { background-color: #0056b3; }
-        .error { color: red; font-weight: bold; margin-top: 10px; }
-        .info { color: #555; margin-top: 10px; }
-        .message-box { background-color: #f9f9f9; border: 1px solid #eee; padding: 15px; border-radius: 5px; margin-top: 20px; white-space: pre-wrap; word-wrap: break-word; line-height: 1.6; }
-        .auto-detected { background-color: #e7f3ff; border: 1px solid #b3d9ff; padding: 15px; border-radius: 5px; margin-bottom: 20px; }
-        .auto-detected h3 { margin-top: 0; color: #0056b3; }
-        .ip-info { display: flex; justify-content: space-between; margin-bottom: 10px; }
-        .ip-info strong { color: #333; }
-        .asn-details { background-color: #f8f9fa; border: 1px solid #dee2e6; padding: 20px; border-radius: 5px; margin: 20px 0; }
-        .asn-details h3 { margin-top: 0; color: #495057; border-bottom: 2px solid #007bff; padding-bottom: 10px; }
-        .detail-grid { display: grid; grid-template-columns: repeat(auto-fit, minmax(300px, 1fr)); gap: 15px; margin: 15px 0; }
-        .detail-item { background: white; padding: 12px; border-radius: 4px; border-left: 4px solid #007bff; }
-        .detail-label { font-weight: bold; color: #495057; font-size: 0.9em; margin-bottom: 5px; }
-        .detail-value { color: #212529; }
-        .contact-list { margin: 5px 0; }
-        .contact-list li { background: #e9ecef; padding: 4px 8px; margin: 2px 0; border-radius: 3px; font-size: 0.9em; }
-        .address-line { margin: 2px 0; }
-        .collapsible { background-color: #007bff; color: white; cursor: pointer; padding: 12px; width: 100%; border: none; text-align: left; outline: none; font-size: 16px; border-radius: 5px; margin: 10px 0; }
-        .collapsible:hover { background-color: #0056b3; }
-        .collapsible:after { content: '\002B'; color: white; font-weight: bold; float: right; margin-left: 5px; }
-        .collapsible.active:after { content: "\2212"; }
-        .collapsible-content { max-height: 0; overflow: hidden; transition: max-height 0.2s ease-out; background-color: #f8f9fa; border: 1px solid #dee2e6; border-radius: 0 0 5px 5px; }
-        .collapsible-content.active { max-height: none; }
-        .btn-generate { background-color: #28a745; color: white; border: none; padding: 10px 20px; border-radius: 5px; cursor: pointer; font-size: 14px; margin: 10px 5px 10px 0; }
-        .btn-generate:hover { background-color: #218838; }
-        .btn-secondary { background-color: #6c757d; color: white; border: none; padding: 10px 20px; border-radius: 5px; cursor: pointer; font-size: 14px; margin: 10px 5px 10px 0; }
-        .btn-secondary:hover { background-color: #5a6268; }
-        ul { list-style-type: none; padding: 0; }
-        li { margin-bottom: 5px; }
-    </style>
+    {{with .Preview}}
+    <meta property="og:type" content="website">
+    <meta property="og:title" content="{{.Title}}">
+    <meta property="og:description" content="{{.Description}}">
+    <meta property="og:url" content="{{.URL}}">
+    <meta property="og:image" content="{{.Image}}">
+    <meta property="og:image:width" content="1200">
+    <meta property="og:image:height" content="630">
+    <meta name="twitter:card" content="summary_large_image">
+    <meta name="twitter:title" content="{{.Title}}">
+    <meta name="twitter:description" content="{{.Description}}">
+    <meta name="twitter:image" content="{{.Image}}">
+    {{else}}
+    <meta property="og:type" content="website">
+    <meta property="og:title" content="Does your provider support IPv6?">
+    <meta property="og:description" content="Look up whether a network announces IPv6, and ask your provider for it if not.">
+    <meta name="twitter:card" content="summary">
+    {{end}}
+    <link rel="stylesheet" href="/static/style.css">
 </head>
 <body>
-    <div class="container">
+    <main class="container">
         <h1>Does your provider support IPv6?</h1>
 
+        {{if eq .ConnectedOver "IPv6"}}
+        <p class="connection-banner connection-ipv6">You connected to this page over IPv6 <span aria-hidden="true">🎉</span></p>
+        {{else if eq .ConnectedOver "IPv4"}}
+        <p class="connection-banner connection-ipv4">You connected to this page over IPv4.</p>
+        {{end}}
+
         {{if .AutoDetected}}
-        <div class="auto-detected">
-            <h3>🎯 Auto-detected Information</h3>
+        <section class="auto-detected" aria-labelledby="detected-heading">
+            <h3 id="detected-heading"><span aria-hidden="true">🎯</span> Auto-detected Information</h3>
             <div class="ip-info">
                 <span><strong>Your IP:</strong> {{.SourceIP}}</span>
                 <span><strong>ASN:</strong> {{.DetectedASN}} ({{.ASNName}})</span>
             </div>
+            {{if .DetectedPrefix}}<p class="info">You're in {{.DetectedPrefix}}.</p>{{end}}
+            {{if not .Readiness}}<p class="info"><a href="/?asn={{.DetectedASN}}">Show IPv6 results for AS{{.DetectedASN}}</a></p>{{end}}
+            {{if gt (len .MatchedASNs) 1}}
+            <form method="POST" action="/" class="matched-asns">
+                <label for="matched-asn">Your address is covered by prefixes from more than one network:</label>
+                <select id="matched-asn" name="asn">
+                    {{range .MatchedASNs}}<option value="{{.ASN}}"{{if eq .ASN $.DetectedASN}} selected{{end}}>AS{{.ASN}} {{.Name}} ({{.Prefix}})</option>
+                    {{end}}
+                </select>
+                <input type="submit" value="Lookup">
+            </form>
+            {{end}}
             <p class="info">We've automatically detected your ISP's ASN based on your IP address. You can use this or enter a different ASN below.</p>
-        </div>
+            {{with .DetectionFreshness}}<p class="footnote">Detection {{.Description}}.</p>{{end}}
+        </section>
         {{else if .SourceIP}}
-        <div class="auto-detected">
-            <h3>ℹ️ Your Connection</h3>
+        <section class="auto-detected" aria-labelledby="connection-heading">
+            <h3 id="connection-heading"><span aria-hidden="true">ℹ️</span> Your Connection</h3>
             <p><strong>Your IP:</strong> {{.SourceIP}}</p>
+            {{if .PrivateNetwork}}
+            <p class="info">You appear to be on a private network, so your ISP's ASN can't be detected from this address. Please enter an ASN manually below.</p>
+            {{else}}
             <p class="info">Unable to automatically detect ASN for your IP. Please enter an ASN manually below.</p>
-        </div>
+            {{end}}
+        </section>
         {{end}}
 
-        <form method="POST" action="/">
-            <label for="asn">Enter ASN (e.g., 19625){{if .AutoDetected}} or use auto-detected{{end}}:</label>
-            <input type="text" id="asn" name="asn" value="{{.ASN}}" required>
+        <form method="POST" action="/" id="asn-form" role="search" aria-label="Look up an ASN">
+            <label for="asn">Enter ASN (e.g., 19625), AS-SET (e.g., AS-EXAMPLE) or website (e.g., example.com){{if .AutoDetected}} or use auto-detected{{end}}:</label>
+            <input type="text" id="asn" name="asn" value="{{.ASN}}" required inputmode="text" autocomplete="off"{{if .Error}} aria-invalid="true" aria-describedby="lookup-error"{{end}}>
+            <fieldset class="message-options">
+                <legend>Request message</legend>
+                <div role="radiogroup" aria-labelledby="tone-label">
+                    <span id="tone-label">Tone:</span>
+                    {{range .MessageTones}}<label><input type="radio" name="tone" value="{{.}}"{{if eq . $.MessageOptions.Tone}} checked{{end}}> {{.}}</label>
+                    {{end}}
+                </div>
+                <div role="radiogroup" aria-labelledby="framing-label">
+                    <span id="framing-label">I am:</span>
+                    <label><input type="radio" name="framing" value="customer"{{if not .MessageOptions.Prospect}} checked{{end}}> a current customer</label>
+                    <label><input type="radio" name="framing" value="prospect"{{if .MessageOptions.Prospect}} checked{{end}}> a prospective customer</label>
+                </div>
+            </fieldset>
             <input type="submit" value="Lookup IPv6 Prefixes">
         </form>
 
+        <form method="POST" action="/" class="search-form" role="search" aria-label="Search networks by name">
+            <label for="query">Don't know the ASN? Search by network name:</label>
+            <input type="text" id="query" name="query" value="{{.SearchQuery}}" placeholder="e.g. Comcast" maxlength="64">
+            <input type="submit" value="Search">
+        </form>
+
+        {{if and .SearchQuery (not .Error)}}
+        <section class="search-results" aria-labelledby="search-heading">
+            <h3 id="search-heading"><span aria-hidden="true">🔎</span> Networks matching "{{.SearchQuery}}"</h3>
+            {{if .SearchResults}}
+            <ul>
+                {{range .SearchResults}}
+                <li><form method="POST" action="/"><input type="hidden" name="asn" value="{{.ASN}}"><button type="submit" class="peer-link" aria-label="Look up AS{{.ASN}}{{with .Name}} ({{.}}){{end}}">AS{{.ASN}}</button></form> {{.Name}}{{if .Description}} - {{.Description}}{{end}}{{if .CountryCode}} ({{.CountryCode}}){{end}}</li>
+                {{end}}
+            </ul>
+            {{else}}
+            <p class="info">No networks found. Try a shorter or different name.</p>
+            {{end}}
+        </section>
+        {{end}}
+
         {{if .Error}}
-            <p class="error">Error: {{.Error}}</p>
-        {{else if .ASN}}
-            <h2>Results for ASN {{.ASN}}:</h2>
+            <p class="error" id="lookup-error" role="alert">Error: {{.Error}}</p>
+            {{if eq .ErrorKind "not-found"}}
+            <p class="info">Check the AS number: {{.Source}} has no record of it. You can search by network name below if you're not sure.</p>
+            {{else if eq .ErrorKind "rate-limited"}}
+            {{if .RetryAfter}}
+            <p class="info" role="status">We're being rate-limited by the data provider; please try again in ~<span class="retry-countdown" data-seconds="{{.RetryAfter}}">{{.RetryAfter}}</span> seconds.</p>
+            {{else}}
+            <p class="info">The data provider is limiting how often we can ask it. Try again in a few minutes.</p>
+            {{end}}
+            {{else if eq .ErrorKind "unavailable"}}
+            <p class="info">The data provider couldn't be reached. This is usually temporary, so try again shortly.</p>
+            {{end}}
+            {{if eq .PrefixesStatus "unavailable"}}{{with .ASNDetails}}
+            <p class="info section-note" role="status">ASN {{.ASN}}{{with .Name}} ({{.}}){{end}} was found, but its prefixes are temporarily unavailable, so its IPv6 readiness can't be shown yet.</p>
+            {{end}}{{end}}
+        {{else if .ASSet}}
+        {{with .ASSet}}
+        <section class="as-set" aria-labelledby="as-set-heading">
+            <h2 id="as-set-heading">Results for {{.Name}}: <span class="badge {{if .Prefixes}}badge-full{{else}}badge-none{{end}}">{{.MembersWithIPv6}} of {{len .Members}} members announce IPv6</span></h2>
+            <p class="footnote">Link to these results: <a href="/?asn={{.Name}}">/?asn={{.Name}}</a></p>
+            <h3>Members</h3>
+            <ul class="as-set-members">
+                {{range .Members}}
+                <li><a href="/?asn={{.ASN}}">AS{{.ASN}}</a>: {{if .Error}}<span class="error-note" title="{{.Error}}"><span aria-hidden="true">⚠️</span> lookup failed</span>{{else if .PrefixCount}}{{.PrefixCount}} IPv6 prefixes{{else}}no IPv6{{end}}</li>
+                {{end}}
+            </ul>
+            {{if .Unchecked}}<p class="info">{{.Unchecked}} more members weren't checked, to stay within BGPView's rate limit. Look them up individually or use a more specific AS-SET.</p>{{end}}
+            {{if .Prefixes}}
+            <h3>IPv6 prefixes announced by members ({{len .Prefixes}})</h3>
+            <ul>
+                {{range .Prefixes}}<li>{{.}}</li>
+                {{end}}
+            </ul>
+            {{end}}
+        </section>
+        {{end}}
+        {{else if .Readiness}}
+            <h2>Results for ASN {{.ASN}}: <span class="badge {{if eq .Readiness "Full"}}badge-full{{else}}badge-none{{end}}">IPv6 readiness: {{.Readiness}}</span></h2>
+            {{if .Domain}}<p class="info">{{.Domain}} resolves to {{.DomainIP}}, which is in a network announced by AS{{.ASN}}.</p>{{end}}
+            {{if .Refreshed}}<p class="info" role="status"><span aria-hidden="true">✅</span> Fetched fresh data{{with .Freshness}}{{with .Source}} from {{.}}{{end}}{{end}}, bypassing the cache.</p>{{end}}
+            <p class="footnote">Link to these results: <a href="/?asn={{.ASN}}">/?asn={{.ASN}}</a></p>
+            <form method="POST" action="/" class="refresh-form">
+                <input type="hidden" name="asn" value="{{.ASN}}">
+                <input type="hidden" name="refresh" value="1">
+                <button type="submit" class="btn-secondary"><span aria-hidden="true">🔄</span> Refresh from {{.Source}}</button>
+                {{if .RefreshWait}}<span class="footnote" role="status">Refreshed too recently; showing cached data. You can refresh again in {{.RefreshWait}} seconds.</span>{{end}}
+            </form>
 
             {{if .ASNDetails}}
-            <button class="collapsible" onclick="toggleCollapsible(this)">📋 View Detailed AS Organization Information</button>
-            <div class="collapsible-content">
-                <div class="asn-details" style="margin: 0; border: none; background: transparent;">
-                    <h3 style="border-bottom: none;">AS Organization Details</h3>
+            <button type="button" class="collapsible" id="asn-details-toggle" aria-expanded="false" aria-controls="asn-details-panel"><span aria-hidden="true">📋</span> View Detailed AS Organization Information</button>
+            <div class="collapsible-content" id="asn-details-panel" role="region" aria-labelledby="asn-details-toggle">
+                <div class="asn-details asn-details-embedded">
+                    <h3>AS Organization Details</h3>
                 <div class="detail-grid">
                     <div class="detail-item">
                         <div class="detail-label">ASN</div>
@@ -242,60 +700,61 @@ var indexTemplate = template.Must(template.New("index").Parse(`
                         <div class="detail-label">Organization Name</div>
                         <div class="detail-value">{{.ASNDetails.Name}}</div>
                     </div>
-                    {{if .ASNDetails.DescriptionShort}}
                     <div class="detail-item">
                         <div class="detail-label">Description</div>
-                        <div class="detail-value">{{.ASNDetails.DescriptionShort}}</div>
+                        <div class="detail-value">{{with .ASNDetails.DescriptionShort}}{{.}}{{else}}<span class="not-available">Not available</span>{{end}}</div>
                     </div>
-                    {{end}}
-                    {{if .ASNDetails.CountryCode}}
                     <div class="detail-item">
                         <div class="detail-label">Country</div>
-                        <div class="detail-value">{{.ASNDetails.CountryCode}}</div>
+                        <div class="detail-value">{{if .ASNDetails.CountryCode}}{{with .ASNDetails.CountryFlag}}<span aria-hidden="true">{{.}}</span> {{end}}{{with .ASNDetails.CountryName}}{{.}} ({{$.ASNDetails.CountryCode}}){{else}}{{.ASNDetails.CountryCode}}{{end}}{{else}}<span class="not-available">Not available</span>{{end}}</div>
                     </div>
-                    {{end}}
-                    {{if .ASNDetails.Website}}
                     <div class="detail-item">
                         <div class="detail-label">Website</div>
-                        <div class="detail-value"><a href="{{.ASNDetails.Website}}" target="_blank">{{.ASNDetails.Website}}</a></div>
+                        <div class="detail-value">{{with .ASNDetails.Website}}<a href="{{.}}" target="_blank" rel="noopener noreferrer">{{.}}</a>{{else}}<span class="not-available">Not available</span>{{end}}</div>
                     </div>
-                    {{end}}
                     {{if .ASNDetails.TrafficRatio}}
                     <div class="detail-item">
                         <div class="detail-label">Traffic Ratio</div>
                         <div class="detail-value">{{.ASNDetails.TrafficRatio}}</div>
                     </div>
                     {{end}}
-                    {{if .ASNDetails.RIRAllocation}}
                     <div class="detail-item">
                         <div class="detail-label">Regional Internet Registry</div>
-                        <div class="detail-value">{{.ASNDetails.RIRAllocation}}</div>
+                        <div class="detail-value">{{with .ASNDetails.RIRAllocation}}{{.}}{{else}}<span class="not-available">Not available</span>{{end}}</div>
                     </div>
-                    {{end}}
                     {{if .ASNDetails.IANAAssignment}}
                     <div class="detail-item">
                         <div class="detail-label">IANA Assignment</div>
                         <div class="detail-value">{{.ASNDetails.IANAAssignment}}</div>
                     </div>
                     {{end}}
-                    {{if .ASNDetails.WhoisServer}}
                     <div class="detail-item">
                         <div class="detail-label">WHOIS Server</div>
-                        <div class="detail-value">{{.ASNDetails.WhoisServer}}</div>
+                        <div class="detail-value">{{with .ASNDetails.WhoisServer}}{{.}}{{else}}<span class="not-available">Not available</span>{{end}}</div>
+                    </div>
+                </div>
+
+                {{if .ASNDetails.DescriptionFull}}
+                <div class="detail-item">
+                    <div class="detail-label">Full Description</div>
+                    <div class="detail-value">
+                        {{range .ASNDetails.DescriptionFull}}
+                            <div class="address-line">{{.}}</div>
+                        {{end}}
                     </div>
-                    {{end}}
                 </div>
+                {{end}}
 
-                {{if .ASNDetails.OwnerAddress}}
                 <div class="detail-item">
                     <div class="detail-label">Address</div>
                     <div class="detail-value">
                         {{range .ASNDetails.OwnerAddress}}
                             <div class="address-line">{{.}}</div>
+                        {{else}}
+                            <span class="not-available">Not available</span>
                         {{end}}
                     </div>
                 </div>
-                {{end}}
 
                 {{if .ASNDetails.EmailContacts}}
                 <div class="detail-item">
@@ -310,18 +769,20 @@ var indexTemplate = template.Must(template.New("index").Parse(`
                 </div>
                 {{end}}
 
-                {{if .ASNDetails.AbuseContacts}}
                 <div class="detail-item">
                     <div class="detail-label">Abuse Contacts</div>
                     <div class="detail-value">
+                        {{if .ASNDetails.AbuseContacts}}
                         <ul class="contact-list">
                             {{range .ASNDetails.AbuseContacts}}
                                 <li><a href="mailto:{{.}}">{{.}}</a></li>
                             {{end}}
                         </ul>
+                        {{else}}
+                        <span class="not-available">Not available</span>
+                        {{end}}
                     </div>
                 </div>
-                {{end}}
 
                 {{if .ASNDetails.DateUpdated}}
                 <div class="detail-item">
@@ -330,168 +791,368 @@ var indexTemplate = template.Must(template.New("index").Parse(`
                 </div>
                 {{end}}
                 </div>
+                {{with .DetailsFreshness}}<p class="footnote">Details {{.Description}}.</p>{{end}}
             </div>
+            {{else if eq .DetailsStatus "unavailable"}}
+            <p class="info section-note" role="status"><span aria-hidden="true">⚠️</span> Organization details are temporarily unavailable. The prefixes below are unaffected; refresh in a few minutes to load the details.</p>
+            {{else if eq .DetailsStatus "missing"}}
+            <p class="info section-note">{{.Source}} has no organization details for ASN {{.ASN}}.</p>
+            {{end}}
+
+            {{with .Trend}}
+                <p class="info trend"><span class="sparkline" aria-hidden="true">{{.Sparkline}}</span>
+                {{if eq .FirstCount .LastCount}}IPv6 prefix count unchanged at {{.LastCount}} over {{.Days}} days.{{else}}IPv6 prefix count changed from {{.FirstCount}} to {{.LastCount}} over {{.Days}} days.{{end}}</p>
             {{end}}
 
             {{if .Prefixes}}
-                <h3>📡 IPv6 Prefixes</h3>
-                <ul>
-                    {{range .Prefixes}}
-                        <li>{{.}}</li>
+                <h3 id="prefixes-heading"><span aria-hidden="true">📡</span> IPv6 Prefixes</h3>
+                <p class="footnote"><a href="/?asn={{.ASN}}{{if not .ExpandedPrefixes}}&notation=expanded{{end}}">Show {{if .ExpandedPrefixes}}compressed{{else}}expanded{{end}} notation</a></p>
+                <ul aria-labelledby="prefixes-heading"{{if .ExpandedPrefixes}} class="prefixes-expanded"{{end}}>
+                    {{range .VisiblePrefixes}}
+                        <li>{{if $.ExpandedPrefixes}}{{.Expanded}}{{else}}{{.}}{{end}}{{template "geo-tag" .}}{{template "rpki-tag" .}}{{template "rdns-tag" .}}</li>
                     {{end}}
                 </ul>
+                {{if .HiddenPrefixes}}
+                <details class="more-prefixes">
+                    <summary>Show all {{len .Prefixes}} prefixes</summary>
+                    <ul{{if .ExpandedPrefixes}} class="prefixes-expanded"{{end}}>
+                        {{range .HiddenPrefixes}}
+                            <li>{{if $.ExpandedPrefixes}}{{.Expanded}}{{else}}{{.}}{{end}}{{template "geo-tag" .}}{{template "rpki-tag" .}}{{template "rdns-tag" .}}</li>
+                        {{end}}
+                    </ul>
+                </details>
+                {{end}}
+                {{with .ReverseDNSMissing}}
+                <p class="info section-note" role="status"><span aria-hidden="true">⚠️</span> {{if eq . $.ReverseDNSChecked}}None of the {{.}} prefixes checked has{{else}}{{.}} of the {{$.ReverseDNSChecked}} prefixes checked lack{{end}} a reverse DNS delegation: their ip6.arpa zones have no NS records, so addresses in them can't have PTR records. Mail servers and many other services reject hosts without reverse DNS.</p>
+                {{end}}
+                {{with .PrefixAnalysis}}
+                <details class="prefix-analysis">
+                    <summary>Aggregation: {{.Announced}} prefixes{{if lt .Minimal .Announced}}, could be {{.Minimal}}{{else}}, fully aggregated{{end}}</summary>
+                    {{if .Covered}}
+                    <p>Covered by a less specific prefix the ASN also announces:</p>
+                    <ul>
+                        {{range .Covered}}
+                            <li>{{.Prefix}} is covered by {{.CoveredBy}}</li>
+                        {{end}}
+                    </ul>
+                    {{end}}
+                    {{if .Aggregates}}
+                    <p>Adjacent prefixes that add up to a shorter one:</p>
+                    <ul>
+                        {{range .Aggregates}}
+                            <li>{{.Prefix}} from {{range $i, $p := .Prefixes}}{{if $i}}, {{end}}{{$p}}{{end}}</li>
+                        {{end}}
+                    </ul>
+                    {{end}}
+                    {{if lt .Minimal .Announced}}
+                    <p class="footnote">More-specifics are often announced on purpose, for traffic engineering, but each adds to the global routing table.</p>
+                    {{else}}
+                    <p>No prefix overlaps another, and no adjacent prefixes could be merged.</p>
+                    {{end}}
+                </details>
+                {{end}}
             {{else}}
-                <p class="info">No IPv6 prefixes registered for ASN {{.ASN}}.</p>
+                {{if .AnnouncesNothing}}
+                <p class="info">This ASN currently announces no prefixes at all, IPv4 or IPv6.</p>
+                {{else}}
+                <p class="info">IPv4 only: no IPv6 prefixes registered for ASN {{.ASN}}.</p>
+                {{end}}
+            {{end}}
+            {{with .Freshness}}<p class="footnote">Prefix data {{.Description}}.</p>{{end}}
+
+            {{if .Peers}}
+            {{if or .Peers.IPv6Upstreams .Peers.IPv4Upstreams}}
+                <h3><span aria-hidden="true">🔗</span> Upstream Providers</h3>
+                <p class="info">Transit providers of ASN {{.ASN}}. Select one to look it up.</p>
+                {{if .Peers.IPv6Upstreams}}
+                <div class="detail-label">IPv6 upstreams</div>
+                <ul class="peer-list">
+                    {{range .Peers.IPv6Upstreams}}
+                        <li><form method="POST" action="/"><input type="hidden" name="asn" value="{{.ASN}}"><button type="submit" class="peer-link" aria-label="Look up AS{{.ASN}}{{with .Name}} ({{.}}){{end}}">AS{{.ASN}}</button></form> {{.Name}}{{if .CountryCode}} ({{.CountryCode}}){{end}}</li>
+                    {{end}}
+                </ul>
+                {{end}}
+                {{if .Peers.IPv4Upstreams}}
+                <div class="detail-label">IPv4 upstreams</div>
+                <ul class="peer-list">
+                    {{range .Peers.IPv4Upstreams}}
+                        <li><form method="POST" action="/"><input type="hidden" name="asn" value="{{.ASN}}"><button type="submit" class="peer-link" aria-label="Look up AS{{.ASN}}{{with .Name}} ({{.}}){{end}}">AS{{.ASN}}</button></form> {{.Name}}{{if .CountryCode}} ({{.CountryCode}}){{end}}</li>
+                    {{end}}
+                </ul>
+                {{end}}
+                {{with .PeersFreshness}}<p class="footnote">Upstreams {{.Description}}.</p>{{end}}
+            {{end}}
+            {{else if eq .PeersStatus "unavailable"}}
+            <p class="info section-note" role="status"><span aria-hidden="true">⚠️</span> Upstream providers are temporarily unavailable.</p>
             {{end}}
 
-            <div style="margin: 20px 0;">
-                <button class="btn-generate" onclick="generateMessage('{{.ASN}}')">✉️ Generate IPv6 Request Message</button>
-                <button class="btn-secondary" onclick="copyToClipboard()">📋 Copy Message</button>
+            <div class="message-actions" role="group" aria-label="Request message actions">
+                {{with .SupportForm}}
+                <a class="btn-generate btn-link" id="support-form-link" href="{{.URL}}" target="_blank" rel="noopener noreferrer"><span aria-hidden="true">📝</span> Submit to {{.Provider}}'s support form</a>
+                {{end}}
+                <button type="submit" class="btn-generate" id="generate-message" form="asn-form" name="show_message" value="1" aria-controls="message-container" aria-expanded="{{if .ShowMessage}}true{{else}}false{{end}}"><span aria-hidden="true">✉️</span> Generate IPv6 Request Message</button>
+                <button type="button" class="btn-secondary" id="copy-message" hidden><span aria-hidden="true">📋</span> Copy Message</button>
+                <button type="submit" class="btn-secondary" form="asn-form" formaction="/?format=md" formtarget="_blank"><span aria-hidden="true">📝</span> Export as Markdown</button>
+                {{if .MailtoURL}}
+                <a class="btn-secondary btn-link" href="{{.MailtoURL}}"><span aria-hidden="true">📧</span> Open in email client</a>
+                {{else}}
+                <button type="button" class="btn-secondary" disabled title="No contact address is known for this ASN"><span aria-hidden="true">📧</span> Open in email client</button>
+                {{end}}
             </div>
 
-            <div id="message-container" style="display: none;">
-                <h3>✉️ Generated IPv6 Request Message</h3>
-                <div class="message-box" id="generated-message"></div>
-            </div>
+            <section id="message-container"{{if not .ShowMessage}} class="hidden"{{end}} aria-live="polite">
+                <h3><label for="generated-message"><span aria-hidden="true">✉️</span> Generated IPv6 Request Message</label></h3>
+                <textarea class="message-box" id="generated-message" rows="16" readonly>{{.Message}}</textarea>
+                <p class="footnote">Change the tone or framing above and generate again to reword the message.</p>
+            </section>
         {{end}}
-    </div>
-
-    <script>
-        // Toggle collapsible sections
-        function toggleCollapsible(element) {
-            element.classList.toggle("active");
-            var content = element.nextElementSibling;
-            content.classList.toggle("active");
-
-            if (content.classList.contains("active")) {
-                content.style.maxHeight = content.scrollHeight + "px";
-            } else {
-                content.style.maxHeight = "0";
-            }
-        }
-
-        // Generate IPv6 request message
-        function generateMessage(asn) {
-            // Get the IPv6 prefixes from the page
-            var prefixes = [];
-
-            // Find the IPv6 Prefixes section and get the list items
-            var h3Elements = document.querySelectorAll('h3');
-            for (var i = 0; i < h3Elements.length; i++) {
-                if (h3Elements[i].textContent.includes('IPv6 Prefixes')) {
-                    var nextElement = h3Elements[i].nextElementSibling;
-                    if (nextElement && nextElement.tagName === 'UL') {
-                        var liElements = nextElement.querySelectorAll('li');
-                        for (var j = 0; j < liElements.length; j++) {
-                            prefixes.push(liElements[j].textContent.trim());
-                        }
-                    }
-                    break;
-                }
-            }
-
-            var organizationSection;
-            var requestSection;
-
-            if (prefixes.length > 0) {
-                var blocksOrLinks = prefixes.join(', ');
-                organizationSection = 'I see that you have ' + blocksOrLinks + ' registered to your organization.';
-                requestSection = 'Because IPv4 is a legacy protocol with severely limited resources available and IPv6 is the current Internet protocol as defined by the IETF, I respectfully request IPv6 support for my current service offering. This would ensure compatibility with the modern Internet infrastructure and provide better connectivity for your customers.';
-            } else {
-                organizationSection = 'You currently have no IPv6 associated with your ASN. This represents a significant opportunity to modernize your network infrastructure.';
-                requestSection = 'As IPv4 address space becomes increasingly scarce and expensive, implementing IPv6 is essential for future growth and compatibility. I respectfully request that you prioritize IPv6 deployment for your network and customer services.\n\nTo get started with IPv6, you can request address space from your Regional Internet Registry:\n- ARIN: https://www.arin.net/resources/guide/ipv6/first_request/\n- RIPE NCC: https://www.ripe.net/manage-ips-and-asns/ipv6/request-ipv6/\n- APNIC: https://www.apnic.net/community/ipv6/get-ipv6/\n- AFRINIC: https://afrinic.net/support/resource-members/how-can-i-request-for-an-ipv6-prefix?lang=en\n- LACNIC: https://www.lacnic.net/1016/2/lacnic/get-ip-addresses_asns';
-            }
-
-            var message = 'I am a current customer of your internet service. IPv6 now results in nearly 50% of the global internet traffic (see current adoption trends: https://stats.ipv6.army/?page=Historical%20Trends), over 80% of mobile traffic, and is available on all major content providers.\n\n📊 GROWTH EVIDENCE:\nThe growth trend is clear - IPv6 adoption has been steadily increasing over the past 5 years as shown in the Global IPv6 Adoption Timeline. You can view the historical trends and adoption graphs here:\nhttps://stats.ipv6.army/?page=Historical%20Trends\n\nMajor content providers and ISPs worldwide have implemented IPv6 to future-proof their networks and meet growing demand.\n\n🌐 YOUR ORGANIZATION:\n' + organizationSection + '\n\n📋 REQUEST:\n' + requestSection;
-
-            document.getElementById('generated-message').textContent = message;
-            document.getElementById('message-container').style.display = 'block';
-
-            // Scroll to the message
-            document.getElementById('message-container').scrollIntoView({ behavior: 'smooth' });
-        }
-
-        // Copy message to clipboard
-        function copyToClipboard() {
-            var messageElement = document.getElementById('generated-message');
-            if (messageElement && messageElement.textContent) {
-                navigator.clipboard.writeText(messageElement.textContent).then(function() {
-                    // Temporarily change button text to show success
-                    var copyBtn = event.target;
-                    var originalText = copyBtn.textContent;
-                    copyBtn.textContent = '✅ Copied!';
-                    copyBtn.style.backgroundColor = '#28a745';
-
-                    setTimeout(function() {
-                        copyBtn.textContent = originalText;
-                        copyBtn.style.backgroundColor = '#6c757d';
-                    }, 2000);
-                }).catch(function(err) {
-                    alert('Failed to copy message to clipboard');
-                });
-            } else {
-                alert('Please generate a message first');
-            }
-        }
-    </script>
+    </main>
+
+    <script src="/static/app.js"></script>
 </body>
 </html>
-`))
+{{define "rdns-tag"}}{{if eq .ReverseDNS "missing"}} <span class="rdns-tag" title="No NS records for its ip6.arpa zone">no rDNS</span>{{end}}{{end}}
+{{define "rpki-tag"}}{{with .RPKIStatus}} <span class="rpki-tag {{$.RPKIClass}}" title="RPKI validation status">RPKI {{.}}</span>{{end}}{{end}}
+{{define "geo-tag"}} {{if .CountryCode}}<span class="geo-tag" title="Registered in {{with .CountryName}}{{.}}{{else}}{{$.CountryCode}}{{end}}">{{with .CountryFlag}}<span aria-hidden="true">{{.}}</span> {{end}}{{.CountryCode}}</span>{{else}}<span class="geo-tag geo-unknown" title="No registered country">?</span>{{end}}{{end}}
+`
 
 // getClientIP extracts the real client IP address from the HTTP request,
 // handling cases where the server is behind a proxy or load balancer.
 func getClientIP(r *http.Request) string {
 	// Check X-Forwarded-For header first (most common proxy header)
-	if xff := r.Header.Get("X-Forwarded-For"); xff != "" {
-		// X-Forwarded-For can contain multiple IPs, get the first one
-		ips := strings.Split(xff, ",")
-		if len(ips) > 0 {
-			return strings.TrimSpace(ips[0])
+	// The header may be repeated and each may list several addresses,
+	// possibly with ports; use the first one that is a valid IP, skipping
+	// garbage such as "unknown"
+	for _, xff := range r.Header.Values("X-Forwarded-For") {
+		for _, entry := range strings.Split(xff, ",") {
+			if ip, ok := normalizeIP(entry); ok {
+				return ip
+			}
 		}
 	}
 
 	// Check X-Real-IP header (another common proxy header)
 	if xrip := r.Header.Get("X-Real-IP"); xrip != "" {
-		return strings.TrimSpace(xrip)
+		if ip, ok := normalizeIP(xrip); ok {
+			return ip
+		}
 	}
 
 	// Fall back to RemoteAddr
-	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if ip, ok := normalizeIP(r.RemoteAddr); ok {
+		return ip
+	}
+	return r.RemoteAddr
+}
+
+// parseTrustedProxies parses the -trusted-proxies list of addresses and
+// prefixes.
+func parseTrustedProxies(list string) ([]netip.Prefix, error) {
+	var proxies []netip.Prefix
+	for _, field := range strings.Split(list, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		if addr, err := netip.ParseAddr(field); err == nil {
+			addr = addr.Unmap()
+			proxies = append(proxies, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(field)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not an address or prefix", field)
+		}
+		proxies = append(proxies, prefix.Masked())
+	}
+	return proxies, nil
+}
+
+// isTrustedProxy reports whether ip is one of the -trusted-proxies.
+func (a *App) isTrustedProxy(ip string) bool {
+	addr, err := netip.ParseAddr(ip)
 	if err != nil {
+		return false
+	}
+	for _, p := range a.trustedProxies {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// clientAddr returns the address of the client that made r, for limits on
+// what each client may do. Unlike getClientIP it can't be spoofed: proxy
+// headers are only believed from -trusted-proxies, and then the client is
+// the last address in X-Forwarded-For that isn't a trusted proxy, as
+// earlier ones were added by the client itself.
+func (a *App) clientAddr(r *http.Request) string {
+	client, ok := normalizeIP(r.RemoteAddr)
+	if !ok {
 		return r.RemoteAddr
 	}
-	return ip
+	if !a.isTrustedProxy(client) {
+		return client
+	}
+
+	var hops []string
+	for _, xff := range r.Header.Values("X-Forwarded-For") {
+		hops = append(hops, strings.Split(xff, ",")...)
+	}
+	if len(hops) == 0 {
+		if ip, ok := normalizeIP(r.Header.Get("X-Real-IP")); ok {
+			return ip
+		}
+	}
+	for i := len(hops) - 1; i >= 0; i-- {
+		ip, ok := normalizeIP(hops[i])
+		if !ok {
+			break
+		}
+		client = ip
+		if !a.isTrustedProxy(ip) {
+			break
+		}
+	}
+	return client
 }
 
-// lookupASNDetails queries the BGPView API for detailed ASN information.
-func lookupASNDetails(asn string) (*ASNDetails, error) {
-	cacheKey := "asn_details_" + asn
+// connectionFamily returns "IPv6" or "IPv4" for the address family of the
+// connection r arrived on, or "" if it can't be told. Unlike getClientIP it
+// ignores proxy headers: the point is to show how this page was reached, so
+// behind a reverse proxy it reflects the proxy's connection. IPv4 clients of
+// a dual-stack socket appear as IPv4-mapped addresses and count as IPv4.
+func connectionFamily(r *http.Request) string {
+	addrPort, err := netip.ParseAddrPort(r.RemoteAddr)
+	if err != nil {
+		return ""
+	}
+	if addrPort.Addr().Unmap().Is4() {
+		return "IPv4"
+	}
+	return "IPv6"
+}
 
+// normalizeIP parses an address as found in RemoteAddr or a proxy header and
+// returns it in canonical form, stripping any port, brackets and IPv6 zone so
+// that e.g. "[2001:db8::1]:443", "2001:db8::1" and "fe80::1%eth0" are all
+// reduced to a bare address. IPv4-mapped IPv6 addresses are unmapped.
+func normalizeIP(s string) (string, bool) {
+	s = strings.TrimSpace(s)
+
+	var addr netip.Addr
+	if addrPort, err := netip.ParseAddrPort(s); err == nil {
+		addr = addrPort.Addr()
+	} else {
+		parsed, err := netip.ParseAddr(strings.TrimSuffix(strings.TrimPrefix(s, "["), "]"))
+		if err != nil {
+			return "", false
+		}
+		addr = parsed
+	}
+
+	return addr.WithZone("").Unmap().String(), true
+}
+
+// isNonPublicIP reports whether ip is a loopback, private (RFC 1918 or ULA),
+// link-local, unspecified, multicast or other reserved address, such as
+// carrier-grade NAT space, that BGPView can never map to an ASN. Unparseable
+// addresses are not considered non-public.
+func isNonPublicIP(ip string) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, p := range reservedPrefixes {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+
+	return addr.IsLoopback() ||
+		addr.IsPrivate() ||
+		addr.IsLinkLocalUnicast() ||
+		addr.IsLinkLocalMulticast() ||
+		addr.IsInterfaceLocalMulticast() ||
+		addr.IsMulticast() ||
+		addr.IsUnspecified()
+}
+
+// lookupASNDetails looks up detailed ASN information in the -source.
+func (a *App) lookupASNDetails(ctx context.Context, asn string) (*ASNDetails, error) {
+	details, _, err := a.lookupASNDetailsFresh(ctx, asn)
+	return details, err
+}
+
+// lookupASNDetailsFresh is like lookupASNDetails but also reports whether
+// the details came from the cache.
+func (a *App) lookupASNDetailsFresh(ctx context.Context, asn string) (*ASNDetails, Freshness, error) {
 	// Check cache first
-	if cached, found := cache.Get(cacheKey); found {
-		return cached.(*ASNDetails), nil
+	if !cacheBypassed(ctx) {
+		if details, age, found := a.cacheGetASNDetails(a.source.Name(), asn); found {
+			return details, newFreshness(age), nil
+		}
+		if err, found := a.cacheGetNotFound(a.source.Name(), "details", asn); found {
+			return nil, Freshness{}, err
+		}
 	}
 
-	bgpURL := fmt.Sprintf("https://api.bgpview.io/asn/%s", asn)
+	// Collapse concurrent lookups of the same ASN into one upstream call
+	v, err := a.lookups.Do(ctx, cacheKey(a.source.Name(), "details", asn), func(ctx context.Context) (interface{}, error) {
+		return a.fetchASNDetails(ctx, asn)
+	})
+	if err != nil {
+		return nil, Freshness{}, err
+	}
+	details := v.(*ASNDetails)
+	return details, Freshness{Source: details.Source}, nil
+}
 
-	resp, err := retryWithBackoff(func() (*http.Response, error) {
-		return httpClient.Get(bgpURL)
-	}, 3)
+// fetchASNDetails fetches detailed ASN information from the -source and
+// caches it. An unknown ASN is remembered for -negative-cache-ttl.
+func (a *App) fetchASNDetails(ctx context.Context, asn string) (*ASNDetails, error) {
+	details, err := a.source.FetchASNDetails(ctx, asn)
+	if err != nil {
+		if errors.Is(err, ErrASNNotFound) {
+			a.cacheSetNotFound(a.source.Name(), "details", asn, err)
+		}
+		return nil, err
+	}
+	if details.Source == "" {
+		details.Source = a.source.Label()
+	}
+
+	// Cache the result for 2 hours (ASN details change less frequently)
+	a.cacheSetASNDetails(a.source.Name(), asn, details, 2*time.Hour)
+
+	return details, nil
+}
+
+// FetchASNDetails fetches detailed ASN information from BGPView.
+func (s bgpViewSource) FetchASNDetails(ctx context.Context, asn string) (*ASNDetails, error) {
+	a := s.app
+	bgpURL := fmt.Sprintf("%s/asn/%s", a.cfg.BGPViewBase, asn)
+
+	resp, err := a.retryWithBackoff(ctx, func(ctx context.Context) (*http.Response, error) {
+		return a.httpGet(ctx, bgpURL)
+	}, 3, upstreamRetryBudget)
 
 	if err != nil {
-		return nil, fmt.Errorf("BGPView ASN details API request failed: %w", err)
+		return nil, markError(ErrUpstreamUnavailable, fmt.Errorf("BGPView ASN details API request failed: %w", err))
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
 		if resp.StatusCode == 429 {
-			return nil, fmt.Errorf("BGPView API rate limit exceeded for ASN %s details", asn)
+			return nil, markError(ErrRateLimited, fmt.Errorf("BGPView API rate limit exceeded for ASN %s details", asn))
 		}
-		return nil, fmt.Errorf("BGPView ASN details API returned status %d for ASN %s", resp.StatusCode, asn)
+		return nil, statusError(resp.StatusCode, fmt.Errorf("BGPView ASN details API returned status %d for ASN %s", resp.StatusCode, asn))
 	}
 
 	var bgpASN bgpViewASNData
-	if err := json.NewDecoder(resp.Body).Decode(&bgpASN); err != nil {
+	if err := a.decodeJSON(resp, &bgpASN); err != nil {
 		return nil, fmt.Errorf("failed to parse BGPView ASN details response for %s: %w", asn, err)
 	}
 
@@ -516,270 +1177,1130 @@ func lookupASNDetails(asn string) (*ASNDetails, error) {
 	if bgpASN.Data.IANAAssignment.Description != "" {
 		details.IANAAssignment = bgpASN.Data.IANAAssignment.Description
 	}
+	return details, nil
+}
+
+// httpGet issues a GET request for url using a's client, bound to ctx. The
+// request occupies one of the upstream concurrency slots until the response
+// body is closed.
+func (a *App) httpGet(ctx context.Context, url string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", a.userAgent())
 
-	// Cache the result for 2 hours (ASN details change less frequently)
-	cache.Set(cacheKey, details, 2*time.Hour)
+	release, err := a.upstream.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
 
-	return details, nil
+	resp, err := a.client.Do(req)
+	if err != nil {
+		release()
+		return nil, err
+	}
+	resp.Body = releasingBody{ReadCloser: resp.Body, release: release}
+	return resp, nil
+}
+
+// defaultMaxBodySize caps how much of an upstream JSON response is read,
+// unless -max-body-size says otherwise, so that a misbehaving or hostile
+// upstream can't exhaust memory by streaming an endless body.
+// Prefix lists of the largest networks are well under it.
+const defaultMaxBodySize = 8 << 20
+
+// bodySnippetLength is how much of an undecodable body is quoted in errors.
+const bodySnippetLength = 200
+
+// errBodyTooLarge is returned for an upstream response larger than
+// -max-body-size.
+var errBodyTooLarge = errors.New("response body too large")
+
+// decodeJSON decodes the JSON body of resp into v, reading at most
+// -max-body-size bytes. When the body isn't the expected JSON, such as a
+// proxy's HTML error page, the error includes the status, content type and
+// the start of the body to make it diagnosable.
+func (a *App) decodeJSON(resp *http.Response, v interface{}) error {
+	limit := a.cfg.MaxBodySize
+	body, err := io.ReadAll(io.LimitReader(resp.Body, limit+1))
+	if err != nil {
+		return fmt.Errorf("failed to read response: %w", err)
+	}
+	if int64(len(body)) > limit {
+		return fmt.Errorf("%w: more than %d bytes (see -max-body-size)", errBodyTooLarge, limit)
+	}
+	if err := json.Unmarshal(body, v); err != nil {
+		snippet := strings.Join(strings.Fields(string(body)), " ")
+		if len(snippet) > bodySnippetLength {
+			snippet = strings.ToValidUTF8(snippet[:bodySnippetLength], "") + "..."
+		}
+		return fmt.Errorf("%w (HTTP %d, Content-Type %q, body: %q)", err, resp.StatusCode, resp.Header.Get("Content-Type"), snippet)
+	}
+	return nil
+}
+
+// sleepContext waits for d, returning early with the context's error if ctx
+// is done first.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// upstreamRetryBudget caps the total time one upstream call may take across
+// all its attempts and the waits between them, unless the request's own
+// deadline comes sooner.
+const upstreamRetryBudget = 20 * time.Second
+
+// retryBaseWait is how long the first retry of a failed upstream request
+// waits; each later retry waits twice as long as the one before.
+var retryBaseWait = time.Second
+
+// retryWithBackoff executes a function with exponential backoff retry logic,
+// passing it a context that ends when budget runs out or ctx is done,
+// whichever comes first. A retry whose wait would end past that is not
+// made. The returned response's body must be closed, as usual, which also
+// releases the context.
+func (a *App) retryWithBackoff(ctx context.Context, fn func(context.Context) (*http.Response, error), maxRetries int, budget time.Duration) (*http.Response, error) {
+	ctx, cancel := context.WithTimeout(ctx, budget)
+	resp, err := a.retryAttempts(ctx, fn, maxRetries)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	resp.Body = releasingBody{ReadCloser: resp.Body, release: cancel}
+	return resp, nil
+}
+
+// budgetAllows reports whether waiting d before another attempt still
+// leaves time before ctx's deadline.
+func budgetAllows(ctx context.Context, d time.Duration) bool {
+	deadline, ok := ctx.Deadline()
+	return !ok || time.Until(deadline) > d
 }
 
-// retryWithBackoff executes a function with exponential backoff retry logic
-func retryWithBackoff(fn func() (*http.Response, error), maxRetries int) (*http.Response, error) {
+// retryAttempts makes the attempts of retryWithBackoff under ctx.
+func (a *App) retryAttempts(ctx context.Context, fn func(context.Context) (*http.Response, error), maxRetries int) (*http.Response, error) {
 	var resp *http.Response
 	var err error
 
 	for attempt := 0; attempt < maxRetries; attempt++ {
-		resp, err = fn()
+		// Fail fast while upstream is known to be down
+		if breakerErr := bgpViewBreaker.Allow(); breakerErr != nil {
+			return nil, breakerErr
+		}
+
+		started := time.Now()
+		resp, err = fn(ctx)
+
+		switch {
+		case errors.Is(err, errUpstreamBusy), errors.Is(err, ErrRateLimited):
+			// We never reached upstream; retrying would only add to the load
+			bgpViewBreaker.Abandon()
+			return nil, err
+		case err != nil && ctx.Err() != nil:
+			// Our own deadline or cancellation says nothing about upstream
+			bgpViewBreaker.Abandon()
+		case err != nil || resp.StatusCode >= 500:
+			bgpViewBreaker.Failure()
+		default:
+			bgpViewBreaker.Success()
+		}
+		recordUpstreamAttempt(started, resp, err)
 
 		if err != nil {
-			if attempt == maxRetries-1 {
+			if attempt == maxRetries-1 || !isRetryableError(err) {
 				return nil, err
 			}
 
 			// Wait with exponential backoff
-			waitTime := time.Duration(math.Pow(2, float64(attempt))) * time.Second
-			log.Printf("API request failed (attempt %d/%d), retrying in %v: %v", attempt+1, maxRetries, waitTime, err)
-			time.Sleep(waitTime)
+			waitTime := retryBaseWait << attempt
+			if !budgetAllows(ctx, waitTime) {
+				return nil, fmt.Errorf("giving up after %d attempts, as the time allowed for retries is spent: %w", attempt+1, err)
+			}
+			a.logInfof("API request failed (attempt %d/%d), retrying in %v: %v", attempt+1, maxRetries, waitTime, err)
+			if sleepErr := sleepContext(ctx, waitTime); sleepErr != nil {
+				return nil, err
+			}
 			continue
 		}
 
-		// If we get a 429 (rate limit), wait longer
+		// On a 429, hold back every request, not just this one, for as
+		// long as BGPView asks. Retrying would only take a turn from the
+		// requests queued behind this one.
 		if resp.StatusCode == 429 {
-			if attempt == maxRetries-1 {
-				return resp, nil // Return the 429 response on final attempt
+			bgpViewRateLimit.Record(resp)
+			a.upstream.pace.pause(bgpViewRateLimit.RetryAfter())
+			a.logInfof("Rate limited (429), holding BGPView requests for %v", bgpViewRateLimit.RetryAfter().Round(time.Second))
+			return resp, nil
+		}
+
+		// Upstream errors are often transient, so retry them too
+		if resp.StatusCode >= 500 {
+			waitTime := retryBaseWait << attempt
+			if attempt == maxRetries-1 || !budgetAllows(ctx, waitTime) {
+				return resp, nil // Return the error response on final attempt
 			}
 
 			resp.Body.Close()
-			waitTime := time.Duration(math.Pow(2, float64(attempt+2))) * time.Second // Longer wait for rate limits
-			log.Printf("Rate limited (429), retrying in %v (attempt %d/%d)", waitTime, attempt+1, maxRetries)
-			time.Sleep(waitTime)
+			a.logInfof("Upstream returned status %d (attempt %d/%d), retrying in %v", resp.StatusCode, attempt+1, maxRetries, waitTime)
+			if sleepErr := sleepContext(ctx, waitTime); sleepErr != nil {
+				return nil, fmt.Errorf("upstream returned status %d and gave up waiting: %w", resp.StatusCode, sleepErr)
+			}
 			continue
 		}
 
-		// Success or non-retryable error
+		// Success or non-retryable (4xx) error
 		return resp, nil
 	}
 
 	return resp, err
 }
 
-// lookupASNByIP queries the BGPView API to find the ASN associated with an IP address.
-func lookupASNByIP(ip string) (string, string, error) {
-	cacheKey := "ip_" + ip
+// isRetryableError reports whether a failed request might succeed if tried
+// again: timeouts, connection resets and refusals, and temporary DNS
+// failures. Cancellation, unknown hosts and anything unrecognised (TLS
+// failures, malformed URLs) are treated as permanent.
+func isRetryableError(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		if dnsErr.IsNotFound {
+			return false
+		}
+		return dnsErr.IsTimeout || dnsErr.IsTemporary
+	}
 
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+
+	return errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.ECONNABORTED) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, io.EOF)
+}
+
+// lookupASNByIP queries the BGPView API to find the ASNs originating prefixes
+// that cover an IP address. An address can be covered by several overlapping
+// prefixes, e.g. for anycast or multi-origin announcements, so every ASN is
+// returned, most specific prefix first, along with whether they came from
+// the cache.
+func (a *App) lookupASNByIP(ctx context.Context, ip string) ([]MatchedASN, Freshness, error) {
 	// Check cache first
-	if cached, found := cache.Get(cacheKey); found {
-		result := cached.([]string)
-		return result[0], result[1], nil
+	if matches, age, found := a.cacheGetIPASN(sourceBGPView, ip); found {
+		return matches, newFreshness(age), nil
+	}
+	if err, found := a.cacheGetNotFound(sourceBGPView, "ip", ip); found {
+		return nil, Freshness{}, err
+	}
+
+	// Collapse concurrent lookups of the same IP into one upstream call
+	v, err := a.lookups.Do(ctx, cacheKey(sourceBGPView, "ip", ip), func(ctx context.Context) (interface{}, error) {
+		return a.fetchASNByIP(ctx, ip)
+	})
+	if err != nil {
+		return nil, Freshness{}, err
 	}
+	return v.([]MatchedASN), Freshness{Source: "BGPView"}, nil
+}
 
-	bgpURL := fmt.Sprintf("https://api.bgpview.io/ip/%s", ip)
+// fetchASNByIP fetches the ASNs associated with an IP address from BGPView
+// and caches them.
+func (a *App) fetchASNByIP(ctx context.Context, ip string) ([]MatchedASN, error) {
+	bgpURL := fmt.Sprintf("%s/ip/%s", a.cfg.BGPViewBase, ip)
 
-	resp, err := retryWithBackoff(func() (*http.Response, error) {
-		return httpClient.Get(bgpURL)
-	}, 3)
+	resp, err := a.retryWithBackoff(ctx, func(ctx context.Context) (*http.Response, error) {
+		return a.httpGet(ctx, bgpURL)
+	}, 3, upstreamRetryBudget)
 
 	if err != nil {
-		return "", "", fmt.Errorf("BGPView IP API request failed: %w", err)
+		return nil, markError(ErrUpstreamUnavailable, fmt.Errorf("BGPView IP API request failed: %w", err))
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
 		if resp.StatusCode == 429 {
-			return "", "", fmt.Errorf("BGPView API rate limit exceeded for IP %s. Please try again in a few minutes", ip)
+			return nil, markError(ErrRateLimited, fmt.Errorf("BGPView API rate limit exceeded for IP %s. Please try again in a few minutes", ip))
 		}
-		return "", "", fmt.Errorf("BGPView IP API returned status %d for IP %s", resp.StatusCode, ip)
+		err := statusError(resp.StatusCode, fmt.Errorf("BGPView IP API returned status %d for IP %s", resp.StatusCode, ip))
+		if resp.StatusCode == http.StatusNotFound {
+			a.cacheSetNotFound(sourceBGPView, "ip", ip, err)
+		}
+		return nil, err
 	}
 
 	var bgpIP bgpViewIPData
-	if err := json.NewDecoder(resp.Body).Decode(&bgpIP); err != nil {
-		return "", "", fmt.Errorf("failed to parse BGPView IP response for %s: %w", ip, err)
+	if err := a.decodeJSON(resp, &bgpIP); err != nil {
+		return nil, fmt.Errorf("failed to parse BGPView IP response for %s: %w", ip, err)
+	}
+
+	matches := matchedASNs(bgpIP)
+	if len(matches) == 0 {
+		err := markError(ErrASNNotFound, fmt.Errorf("no ASN found for IP %s", ip))
+		a.cacheSetNotFound(sourceBGPView, "ip", ip, err)
+		return nil, err
+	}
+
+	// Cache the result for 30 minutes
+	a.cacheSetIPASN(sourceBGPView, ip, matches, 30*time.Minute)
+
+	return matches, nil
+}
+
+// matchedASNs lists the origin ASNs in an IP lookup response, ordered from
+// the most to the least specific covering prefix. An ASN announcing several
+// covering prefixes is listed once, with its most specific one.
+func matchedASNs(bgpIP bgpViewIPData) []MatchedASN {
+	prefixes := bgpIP.Data.Prefixes
+	bits := func(prefix string) int {
+		p, err := netip.ParsePrefix(prefix)
+		if err != nil {
+			return -1
+		}
+		return p.Bits()
 	}
+	sort.SliceStable(prefixes, func(i, j int) bool {
+		return bits(prefixes[i].Prefix) > bits(prefixes[j].Prefix)
+	})
+
+	var matches []MatchedASN
+	seen := make(map[string]bool)
+	for _, p := range prefixes {
+		asn := strconv.Itoa(p.ASN.ASN)
+		if seen[asn] {
+			continue
+		}
+		seen[asn] = true
 
-	// Get the most specific prefix (first one) which typically has the most accurate ASN
-	if len(bgpIP.Data.Prefixes) > 0 {
-		asn := fmt.Sprintf("%d", bgpIP.Data.Prefixes[0].ASN.ASN)
-		name := bgpIP.Data.Prefixes[0].ASN.Name
+		name := p.ASN.Name
 		if name == "" {
-			name = bgpIP.Data.Prefixes[0].ASN.Description
+			name = p.ASN.Description
 		}
+		matches = append(matches, MatchedASN{ASN: asn, Name: name, Prefix: p.Prefix})
+	}
+	return matches
+}
 
-		// Cache the result for 30 minutes
-		cache.Set(cacheKey, []string{asn, name}, 30*time.Minute)
+// Freshness tells whether a lookup result was served from the cache and, if
+// so, how old it is, or else which source it was just fetched from.
+type Freshness struct {
+	Cached     bool   `json:"cached"`
+	AgeSeconds int64  `json:"age_seconds"`
+	Source     string `json:"source,omitempty"`
+}
 
-		return asn, name, nil
-	}
+// newFreshness returns the Freshness of a result found in the cache with the
+// given age.
+func newFreshness(age time.Duration) Freshness {
+	return Freshness{Cached: true, AgeSeconds: int64(age / time.Second)}
+}
 
-	return "", "", fmt.Errorf("no ASN found for IP %s", ip)
+// Description summarizes f for display, e.g. "fetched 12 minutes ago
+// (cached)".
+func (f Freshness) Description() string {
+	if !f.Cached {
+		if f.Source == "" {
+			return "fetched just now"
+		}
+		return "fetched from " + f.Source + " just now"
+	}
+	age := time.Duration(f.AgeSeconds) * time.Second
+	switch {
+	case age < time.Minute:
+		return "fetched less than a minute ago (cached)"
+	case age < 2*time.Minute:
+		return "fetched 1 minute ago (cached)"
+	case age < time.Hour:
+		return fmt.Sprintf("fetched %d minutes ago (cached)", int(age/time.Minute))
+	default:
+		return fmt.Sprintf("fetched %.1f hours ago (cached)", age.Hours())
+	}
 }
 
 // lookupIPv6 queries the BGPView API for IPv6 prefixes associated with an ASN.
-func lookupIPv6(asn string) ([]string, error) {
-	cacheKey := "asn_" + asn
+func (a *App) lookupIPv6(ctx context.Context, asn string) ([]string, error) {
+	prefixes, _, err := a.lookupIPv6Fresh(ctx, asn)
+	return prefixes, err
+}
+
+// lookupIPv6Fresh is like lookupIPv6 but also reports whether the prefixes
+// came from the cache.
+func (a *App) lookupIPv6Fresh(ctx context.Context, asn string) ([]string, Freshness, error) {
+	// Reserved ASNs are never announced, so don't ask BGPView
+	if err := checkRoutableASN(asn); err != nil {
+		return nil, Freshness{}, err
+	}
 
 	// Check cache first
-	if cached, found := cache.Get(cacheKey); found {
-		return cached.([]string), nil
+	if !cacheBypassed(ctx) {
+		if prefixes, age, found := a.cacheGetPrefixes(a.source.Name(), asn); found {
+			return prefixes, newFreshness(age), nil
+		}
 	}
 
-	bgpURL := fmt.Sprintf("https://api.bgpview.io/asn/%s/prefixes?type=ipv6", asn)
+	all, err := a.lookupAllPrefixes(ctx, asn)
+	if err != nil {
+		return nil, Freshness{}, err
+	}
+	return all.IPv6, Freshness{Source: all.Source}, nil
+}
 
-	resp, err := retryWithBackoff(func() (*http.Response, error) {
-		return httpClient.Get(bgpURL)
-	}, 3)
+// allPrefixes holds both address families of an ASN's prefixes, and the
+// registered country of each IPv6 prefix.
+type allPrefixes struct {
+	IPv4, IPv6    []string
+	IPv6Countries map[string]string
+	// Source is the Label of the source the prefixes came from, or "" if
+	// they came from the cache.
+	Source string
+}
 
+// lookupAllPrefixes looks up the IPv4 and IPv6 prefixes associated with an
+// ASN in the -source. Both families come from a single upstream call and
+// are cached separately, so lookupIPv4 and lookupIPv6 share the result.
+func (a *App) lookupAllPrefixes(ctx context.Context, asn string) (allPrefixes, error) {
+	// Reserved ASNs are never announced, so don't ask BGPView
+	if err := checkRoutableASN(asn); err != nil {
+		return allPrefixes{}, err
+	}
+
+	// Check cache first
+	source := a.source.Name()
+	if !cacheBypassed(ctx) {
+		ipv4, _, found4 := a.cacheGetIPv4Prefixes(source, asn)
+		ipv6, _, found6 := a.cacheGetPrefixes(source, asn)
+		if found4 && found6 {
+			return allPrefixes{IPv4: ipv4, IPv6: ipv6}, nil
+		}
+		if err, found := a.cacheGetNotFound(source, "prefixes", asn); found {
+			return allPrefixes{}, err
+		}
+	}
+
+	// Collapse concurrent lookups of the same ASN into one upstream call
+	v, err := a.lookups.Do(ctx, cacheKey(source, "all_prefixes", asn), func(ctx context.Context) (interface{}, error) {
+		return a.fetchAllPrefixes(ctx, asn)
+	})
+	if err != nil {
+		return allPrefixes{}, err
+	}
+	return v.(allPrefixes), nil
+}
+
+// fetchAllPrefixes fetches the prefixes of both families of an ASN from the
+// -source and caches them. An unknown ASN is remembered for
+// -negative-cache-ttl.
+func (a *App) fetchAllPrefixes(ctx context.Context, asn string) (allPrefixes, error) {
+	source := a.source.Name()
+	all, err := a.source.FetchPrefixes(ctx, asn)
 	if err != nil {
-		return nil, fmt.Errorf("BGPView API request failed: %w", err)
+		if errors.Is(err, ErrASNNotFound) {
+			a.cacheSetNotFound(source, "prefixes", asn, err)
+		}
+		return allPrefixes{}, err
+	}
+	if all.Source == "" {
+		all.Source = a.source.Label()
+	}
+	all.IPv4 = sortPrefixes(all.IPv4)
+	all.IPv6 = sortPrefixes(all.IPv6)
+
+	// Cache each family for 1 hour, or briefly if it has no prefixes
+	a.cacheSetIPv4Prefixes(source, asn, all.IPv4, a.prefixCacheTTL(all.IPv4))
+	a.cacheSetPrefixes(source, asn, all.IPv6, a.prefixCacheTTL(all.IPv6))
+	a.cacheSetPrefixCountries(source, asn, all.IPv6Countries, a.prefixCacheTTL(all.IPv6))
+
+	return all, nil
+}
+
+// FetchPrefixes fetches the prefixes of both families of an ASN, and the
+// countries of the IPv6 ones, from BGPView.
+func (s bgpViewSource) FetchPrefixes(ctx context.Context, asn string) (allPrefixes, error) {
+	a := s.app
+	bgpURL := fmt.Sprintf("%s/asn/%s/prefixes", a.cfg.BGPViewBase, asn)
+
+	resp, err := a.retryWithBackoff(ctx, func(ctx context.Context) (*http.Response, error) {
+		return a.httpGet(ctx, bgpURL)
+	}, 3, upstreamRetryBudget)
+
+	if err != nil {
+		return allPrefixes{}, markError(ErrUpstreamUnavailable, fmt.Errorf("BGPView API request failed: %w", err))
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
 		if resp.StatusCode == 429 {
-			return nil, fmt.Errorf("BGPView API rate limit exceeded for ASN %s. Please try again in a few minutes", asn)
+			return allPrefixes{}, markError(ErrRateLimited, fmt.Errorf("BGPView API rate limit exceeded for ASN %s. Please try again in a few minutes", asn))
 		}
-		return nil, fmt.Errorf("BGPView API returned status %d for ASN %s", resp.StatusCode, asn)
+		return allPrefixes{}, statusError(resp.StatusCode, fmt.Errorf("BGPView API returned status %d for ASN %s", resp.StatusCode, asn))
 	}
 
 	var bgp bgpViewData
-	if err := json.NewDecoder(resp.Body).Decode(&bgp); err != nil {
-		return nil, fmt.Errorf("failed to parse BGPView response for ASN %s: %w", asn, err)
+	if err := a.decodeJSON(resp, &bgp); err != nil {
+		return allPrefixes{}, fmt.Errorf("failed to parse BGPView response for ASN %s: %w", asn, err)
 	}
 
-	var ipv6 []string
+	all := allPrefixes{IPv6Countries: make(map[string]string)}
+	for _, p := range bgp.Data.IPv4Prefixes {
+		all.IPv4 = append(all.IPv4, p.Prefix)
+	}
 	for _, p := range bgp.Data.IPv6Prefixes {
-		ipv6 = append(ipv6, p.Prefix)
+		all.IPv6 = append(all.IPv6, p.Prefix)
+		if p.CountryCode != "" {
+			all.IPv6Countries[p.Prefix] = strings.ToUpper(p.CountryCode)
+		}
 	}
+	return all, nil
+}
 
-	// Cache the result for 1 hour (IPv6 prefixes change less frequently)
-	cache.Set(cacheKey, ipv6, 1*time.Hour)
+// sortPrefixes removes duplicates from prefixes, which BGPView lists once per
+// origin for multi-origin announcements, and sorts them by address and then
+// prefix length. Entries that don't parse as prefixes are kept, sorted as
+// strings after the rest.
+func sortPrefixes(prefixes []string) []string {
+	type entry struct {
+		raw    string
+		prefix netip.Prefix
+		ok     bool
+	}
 
-	return ipv6, nil
+	var entries []entry
+	seen := make(map[string]bool)
+	for _, raw := range prefixes {
+		p, err := netip.ParsePrefix(raw)
+		key := raw
+		if err == nil {
+			key = p.String()
+		}
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		entries = append(entries, entry{raw: raw, prefix: p, ok: err == nil})
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		a, b := entries[i], entries[j]
+		switch {
+		case a.ok && b.ok:
+			if c := a.prefix.Addr().Compare(b.prefix.Addr()); c != 0 {
+				return c < 0
+			}
+			return a.prefix.Bits() < b.prefix.Bits()
+		case a.ok != b.ok:
+			return a.ok
+		default:
+			return a.raw < b.raw
+		}
+	})
+
+	sorted := make([]string, 0, len(entries))
+	for _, e := range entries {
+		sorted = append(sorted, e.raw)
+	}
+	return sorted
+}
+
+// defaultMaxRenderedPrefixes is how many prefixes are listed on the results
+// page before the rest are folded away, unless -max-prefixes says otherwise.
+const defaultMaxRenderedPrefixes = 50
+
+// messagePrefixLimit is the most prefixes named individually in the
+// generated message; longer lists are summarized.
+const messagePrefixLimit = 10
+
+// messageExactCountLimit is the most prefixes counted exactly in the
+// generated message. Beyond it the count is rounded down to the hundred, as
+// in "over 1200 IPv6 prefixes", since the exact figure says no more and
+// changes from day to day; the results page still lists every prefix.
+const messageExactCountLimit = 200
+
+// splitPrefixes splits prefixes into the first limit entries and the rest.
+func splitPrefixes[T any](prefixes []T, limit int) (visible, hidden []T) {
+	if limit <= 0 || len(prefixes) <= limit {
+		return prefixes, nil
+	}
+	return prefixes[:limit], prefixes[limit:]
+}
+
+// summarizePrefixes lists blocks for the message, naming only the first few
+// when there are more than messagePrefixLimit of them.
+func summarizePrefixes(strs messageStrings, blocks []string) string {
+	if len(blocks) <= messagePrefixLimit {
+		return strings.Join(blocks, ", ")
+	}
+	examples := strings.Join(blocks[:3], ", ")
+	if len(blocks) > messageExactCountLimit {
+		return fmt.Sprintf(strs.HugePrefixes, (len(blocks)-1)/100*100, examples)
+	}
+	return fmt.Sprintf(strs.ManyPrefixes, len(blocks), examples)
+}
+
+// generateIPv6RequestMessage constructs a message based on the returned IPv6
+// blocks, in the language of loc and the variant chosen by opts. When no
+// blocks are announced the RIR links are included, with the registry serving
+// loc's region listed first. announcesNothing selects wording for an ASN that
+// announces no IPv4 either.
+func generateIPv6RequestMessage(asn string, ipv6Blocks []string, loc locale, announcesNothing bool, opts MessageOptions) string {
+	return buildIPv6RequestMessage(ipv6Blocks, loc, announcesNothing, opts, false)
 }
 
-// generateIPv6RequestMessage constructs a message based on the returned IPv6 blocks.
-func generateIPv6RequestMessage(asn string, ipv6Blocks []string) string {
-	var blocksOrLinks string
+// generateIPv6RequestMarkdown is like generateIPv6RequestMessage but formats
+// the message as Markdown for pasting into issue trackers: section headings,
+// every prefix as a bullet and the RIR links as proper links.
+func generateIPv6RequestMarkdown(asn string, ipv6Blocks []string, loc locale, announcesNothing bool, opts MessageOptions) string {
+	return buildIPv6RequestMessage(ipv6Blocks, loc, announcesNothing, opts, true)
+}
+
+func buildIPv6RequestMessage(ipv6Blocks []string, loc locale, announcesNothing bool, opts MessageOptions, markdown bool) string {
+	strs := messageStringsFor(loc, opts)
+
+	var organizationSection, requestSection string
 	if len(ipv6Blocks) > 0 {
-		blocksOrLinks = strings.Join(ipv6Blocks, ", ")
+		organizationSection = fmt.Sprintf(strs.HasPrefixes, summarizePrefixes(strs, ipv6Blocks))
+		if markdown {
+			organizationSection += "\n"
+			for _, block := range ipv6Blocks {
+				organizationSection += "\n- `" + block + "`"
+			}
+		}
+		requestSection = strs.RequestHas
 	} else {
-		blocksOrLinks = `
-- ARIN: [https://www.arin.net/resources/guide/ipv6/first_request/](https://www.arin.net/resources/guide/ipv6/first_request/)
-- RIPE NCC: [https://www.ripe.net/manage-ips-and-asns/ipv6/request-ipv6/](https://www.ripe.net/manage-ips-and-asns/ipv6/request-ipv6/)
-- APNIC: [https://www.apnic.net/community/ipv6/get-ipv6/](https://www.apnic.net/community/ipv6/get-ipv6/)
-- AFRINIC: [https://afrinic.net/support/resource-members/how-can-i-request-for-an-ipv6-prefix?lang=en](https://afrinic.net/support/resource-members/how-can-i-request-for-an-ipv6-prefix?lang=en)
-- LACNIC: [https://www.lacnic.net/1016/2/lacnic/get-ip-addresses_asns](https://www.lacnic.net/1016/2/lacnic/get-ip-addresses_asns)
-`
+		organizationSection = strs.NoPrefixes
+		if announcesNothing {
+			organizationSection = strs.NoAnnouncements
+		}
+		requestSection = strs.RequestNone
+		if opts.IncludeRIRLinks {
+			var links strings.Builder
+			for _, l := range orderedRIRLinks(opts.RIRLinks, loc, opts.RIR) {
+				if markdown {
+					fmt.Fprintf(&links, "\n- [%s](%s)", l.Label(), l.URL)
+				} else {
+					fmt.Fprintf(&links, "\n- %s: %s", l.Label(), l.URL)
+				}
+			}
+			requestSection += "\n\n" + strs.RIRIntro + links.String()
+		}
+	}
+
+	if len(opts.IPv4Prefixes) > 0 {
+		organizationSection += "\n\n" + fmt.Sprintf(strs.IPv4Scarcity, strs.IPv4Prefixes.format(len(opts.IPv4Prefixes)), strconv.FormatUint(ipv4AddressCount(opts.IPv4Prefixes), 10), strs.IPv6Prefixes.format(len(ipv6Blocks)))
+	}
+
+	intro, statsNote := strs.Intro, ""
+	if opts.Prospect {
+		intro = strs.ProspectIntro
+	}
+	if opts.IncludeStatsLinks {
+		statsNote = strs.StatsNote
+	}
+
+	heading := func(h string) string { return h }
+	if markdown {
+		heading = func(h string) string { return "### " + h + "\n" }
+	}
+	msg := fmt.Sprintf(intro, statsNote) + "\n\n"
+	if opts.IncludeStatsLinks {
+		msg += heading(strs.GrowthHeader) + "\n" + strs.Growth + "\n\n"
+	}
+	return msg +
+		heading(strs.OrgHeader) + "\n" + organizationSection + "\n\n" +
+		heading(strs.RequestHeader) + "\n" + requestSection
+}
+
+// maxASNInputLength is the longest ASN input accepted, enough for "AS"
+// followed by a 32-bit asplain or asdot number.
+const maxASNInputLength = 16
+
+// asnInputPattern is the only shape of ASN input accepted. Anything else,
+// such as path separators or query characters, is rejected before an
+// upstream URL is ever built from it.
+var asnInputPattern = regexp.MustCompile(`^(?i:AS)?[0-9]{1,10}(\.[0-9]{1,5})?$`)
+
+// normalizeASN validates user input as an AS number, accepting an optional
+// "AS" prefix and surrounding whitespace, and returns it in plain decimal
+// form. 32-bit ASNs in asdot notation ("65000.1") are converted to asplain
+// (65000*65536 + 1), since BGPView only accepts the latter. Input naming an
+// AS-SET is recognized and reported with an error wrapping errASSetInput.
+func normalizeASN(input string) (string, error) {
+	if set, ok := normalizeASSet(input); ok {
+		return "", markError(errASSetInput, fmt.Errorf("%s is an AS-SET, not a single AS number", set))
+	}
+	asn := strings.TrimSpace(input)
+	if len(asn) > maxASNInputLength {
+		return "", fmt.Errorf("AS number is too long (at most %d characters)", maxASNInputLength)
+	}
+	if asn != "" && !asnInputPattern.MatchString(asn) {
+		return "", fmt.Errorf("%q is not a valid AS number", input)
+	}
+	if len(asn) >= 2 && strings.EqualFold(asn[:2], "AS") {
+		asn = asn[2:]
+	}
+	if asn == "" {
+		return "", errors.New("please enter an AS number")
 	}
 
-	message := fmt.Sprintf(`I am a current customer of your internet service. IPv6 now results in nearly 50%% of the global internet traffic (see https://stats.ipv6.army), over 80%% of mobile traffic, and is available on all major content providers. I see that you have %s registered to your organization. Because IPv4 is a legacy protocol with severely limited resources available and IPv6 is the current Internet protocol as defined by the IETF, I respectfully request IPv6 support for my current service offering.`, blocksOrLinks)
+	if high, low, ok := strings.Cut(asn, "."); ok {
+		h, errHigh := strconv.ParseUint(high, 10, 16)
+		l, errLow := strconv.ParseUint(low, 10, 16)
+		if errHigh != nil || errLow != nil {
+			return "", fmt.Errorf("%q is not a valid asdot AS number (both parts must be 0-65535)", input)
+		}
+		return strconv.FormatUint(h<<16|l, 10), nil
+	}
 
-	return message
+	n, err := strconv.ParseUint(asn, 10, 32)
+	if err != nil {
+		return "", fmt.Errorf("%q is not a valid AS number", input)
+	}
+	return strconv.FormatUint(n, 10), nil
+}
+
+// contactAddress picks the address an IPv6 request should be sent to: the
+// first abuse contact, or failing that the first general email contact.
+func contactAddress(details *ASNDetails) string {
+	if details == nil {
+		return ""
+	}
+	if len(details.AbuseContacts) > 0 {
+		return details.AbuseContacts[0]
+	}
+	if len(details.EmailContacts) > 0 {
+		return details.EmailContacts[0]
+	}
+	return ""
+}
+
+// mailtoLink builds a mailto: URL addressed to to with the IPv6 request
+// message as its body.
+func mailtoLink(to, asn, message string) string {
+	// mailto: wants spaces as %20, not the + that QueryEscape produces
+	escape := func(s string) string {
+		return strings.ReplaceAll(url.QueryEscape(s), "+", "%20")
+	}
+	subject := fmt.Sprintf("IPv6 support request for AS%s", asn)
+	return "mailto:" + url.PathEscape(to) + "?subject=" + escape(subject) + "&body=" + escape(message)
 }
 
 // formHandler handles HTTP requests for the web interface.
-func formHandler(w http.ResponseWriter, r *http.Request) {
-	data := pageData{}
+func (a *App) formHandler(w http.ResponseWriter, r *http.Request) {
+	data := pageData{
+		MessageOptions:   a.messageOptionsFromRequest(r),
+		MessageTones:     messageTones,
+		Source:           a.source.Label(),
+		ShowMessage:      r.FormValue("show_message") == "1",
+		ExpandedPrefixes: r.FormValue("notation") == "expanded",
+		ConnectedOver:    connectionFamily(r),
+	}
 
-	// Always try to detect the client's IP and ASN
-	clientIP := getClientIP(r)
-	data.SourceIP = clientIP
+	// Try to detect the client's IP and ASN, unless -disable-autodetect
+	// keeps the client's address private and to ourselves
+	clientIP := ""
+	if !a.cfg.DisableAutodetect {
+		clientIP = getClientIP(r)
+		data.SourceIP = clientIP
+	}
 
-	// Attempt to auto-detect ASN from client IP
-	if clientIP != "" {
-		detectedASN, asnName, err := lookupASNByIP(clientIP)
+	// Attempt to auto-detect ASN from client IP. Private and reserved
+	// addresses are never routed on the Internet, so don't waste an API call.
+	// Nor is one spent when a lookup or search was submitted, as the
+	// detected network is then only shown if it is already known.
+	submitted := r.Method == http.MethodPost && (r.FormValue("asn") != "" || r.FormValue("query") != "")
+	if isNonPublicIP(clientIP) {
+		data.PrivateNetwork = true
+	} else if clientIP != "" {
+		// Default to the most specific match and offer the others
+		matches, freshness, err := a.detectASN(r.Context(), w, r, clientIP, submitted)
 		if err == nil {
-			data.DetectedASN = detectedASN
-			data.ASNName = asnName
+			data.DetectionFreshness = &freshness
+			data.DetectedASN = matches[0].ASN
+			data.ASNName = matches[0].Name
+			data.DetectedPrefix = matches[0].Prefix
+			data.MatchedASNs = matches
 			data.AutoDetected = true
 		}
 	}
 
-	if r.Method == http.MethodPost {
-		asn := r.FormValue("asn")
+	// status reflects the outcome of the lookup; the friendly HTML body is
+	// rendered regardless
+	status := http.StatusOK
+
+	// A network name search lists candidate ASNs to pick from
+	if r.Method == http.MethodPost && r.FormValue("query") != "" {
+		data.SearchQuery = r.FormValue("query")
+		query, err := normalizeSearchQuery(data.SearchQuery)
+		if err != nil {
+			data.Error = err.Error()
+			a.respond(w, r, http.StatusBadRequest, data)
+			return
+		}
+		results, err := a.searchASN(r.Context(), query)
+		if err != nil {
+			data.Error = err.Error()
+			data.ErrorKind = errorKind(err)
+			data.RetryAfter = retryAfterSeconds(err)
+			setRetryAfter(w, err)
+			status = lookupErrorStatus(err)
+		}
+		data.SearchResults = results
+		a.respond(w, r, status, data)
+		return
+	}
+
+	// Lookups are POSTed from the form, or linked to as GET /?asn=N so
+	// that results can be bookmarked and shared
+	if r.Method == http.MethodPost || r.URL.Query().Get("asn") != "" {
+		data.ASN = r.FormValue("asn")
+		asn, err := normalizeASN(data.ASN)
+		if errors.Is(err, errASSetInput) {
+			a.renderASSet(w, r, data)
+			return
+		}
+		// A website's domain stands for the ASN hosting it
+		if domain, ok := normalizeDomain(data.ASN); ok && err != nil {
+			data.Domain = domain
+			asn, data.DomainIP, err = a.resolveDomainASN(r.Context(), domain)
+			if err != nil {
+				data.Error = err.Error()
+				data.ErrorKind = errorKind(err)
+				data.RetryAfter = retryAfterSeconds(err)
+				setRetryAfter(w, err)
+				a.respond(w, r, domainErrorStatus(err), data)
+				return
+			}
+		}
+		if err != nil {
+			data.Error = err.Error()
+			a.respond(w, r, http.StatusBadRequest, data)
+			return
+		}
 		data.ASN = asn
 
-		// Fetch detailed ASN information
-		asnDetails, detailsErr := lookupASNDetails(asn)
+		if err := a.checkASNPermitted(asn); err != nil {
+			data.Error = err.Error()
+			a.respond(w, r, http.StatusForbidden, data)
+			return
+		}
+		if err := checkRoutableASN(asn); err != nil {
+			data.Error = err.Error()
+			a.respond(w, r, http.StatusUnprocessableEntity, data)
+			return
+		}
+
+		// ?refresh=1 skips the cache, but only once a minute per client
+		ctx, refreshed, wait := a.refreshContext(w, r)
+		data.Refreshed = refreshed
+		data.RefreshWait = int(wait.Round(time.Second) / time.Second)
+		started := time.Now()
+
+		// Fetch detailed ASN information, IPv6 prefixes and upstreams
+		// concurrently, since they are independent BGPView calls.
+		var (
+			wg               sync.WaitGroup
+			asnDetails       *ASNDetails
+			detailsFreshness Freshness
+			detailsErr       error
+			ipv6Prefixes     []string
+			freshness        Freshness
+			peers            *ASNPeers
+			peersFreshness   Freshness
+			peersErr         error
+		)
+		wg.Add(3)
+		go func() {
+			defer wg.Done()
+			asnDetails, detailsFreshness, detailsErr = a.lookupASNDetailsFresh(ctx, asn)
+		}()
+		go func() {
+			defer wg.Done()
+			ipv6Prefixes, freshness, err = a.lookupIPv6Fresh(ctx, asn)
+		}()
+		go func() {
+			defer wg.Done()
+			peers, peersFreshness, peersErr = a.lookupPeersFresh(ctx, asn)
+		}()
+		wg.Wait()
+
+		lookup := lookupEvent{Time: started, ASN: asn, Prefixes: len(ipv6Prefixes), Cached: freshness.Cached, Duration: time.Since(started).Round(time.Millisecond)}
+		if err != nil {
+			lookup.Error = err.Error()
+		}
+		a.recentLookups.add(lookup)
+
+		// Details and upstream failures are non-fatal; the prefixes are
+		// what matter. The page notes which sections are missing.
+		data.DetailsStatus = sectionStatus(detailsErr)
+		data.PrefixesStatus = sectionStatus(err)
+		data.PeersStatus = sectionStatus(peersErr)
 		if detailsErr == nil {
 			data.ASNDetails = asnDetails
+			data.DetailsFreshness = &detailsFreshness
+			data.MessageOptions.RIR = asnDetails.RIRAllocation
+		}
+		if peersErr == nil {
+			data.Peers = peers
+			data.PeersFreshness = &peersFreshness
 		}
 
-		ipv6Prefixes, err := lookupIPv6(asn)
 		if err != nil {
 			data.Error = err.Error()
+			data.ErrorKind = errorKind(err)
+			data.RetryAfter = retryAfterSeconds(err)
+			setRetryAfter(w, err)
+			status = lookupErrorStatus(err)
 		} else {
 			data.Prefixes = ipv6Prefixes
+			data.Freshness = &freshness
+			// Countries are a nicety; without them the prefixes are
+			// listed untagged. They were cached by the prefix lookup,
+			// even a refreshed one, so don't bypass the cache again.
+			countries, _ := a.lookupPrefixCountries(r.Context(), asn)
+			annotated := annotatePrefixes(ipv6Prefixes, countries)
+			if a.cfg.RPKI {
+				a.annotateRPKI(ctx, asn, annotated)
+			}
+			if a.cfg.ReverseDNS {
+				data.ReverseDNSChecked, data.ReverseDNSMissing = a.annotateReverseDNS(ctx, annotated)
+			}
+			data.VisiblePrefixes, data.HiddenPrefixes = splitPrefixes(annotated, a.cfg.MaxPrefixes)
+			data.Readiness = ipv6Readiness(ipv6Prefixes)
+			if len(ipv6Prefixes) > 1 {
+				data.PrefixAnalysis = analyzePrefixes(ipv6Prefixes)
+			}
+
+			// The IPv4 prefixes came with the IPv6 ones, so this is
+			// normally a cache hit. Without IPv6, they tell "IPv4 only"
+			// apart from an ASN that announces nothing at all. If the
+			// IPv4 lookup fails, assume the common IPv4-only case and
+			// leave the address count out of the message.
+			if ipv4Prefixes, err := a.lookupIPv4(ctx, asn); err == nil {
+				data.MessageOptions.IPv4Prefixes = ipv4Prefixes
+				data.AnnouncesNothing = len(ipv6Prefixes) == 0 && len(ipv4Prefixes) == 0
+			}
+			data.Message = generateIPv6RequestMessage(asn, ipv6Prefixes, negotiateLocale(r, a.cfg.Lang), data.AnnouncesNothing, data.MessageOptions)
+
+			// Compare against earlier lookups before recording this one
+			if a.history != nil {
+				data.Trend = a.history.Trend(asn, len(ipv6Prefixes))
+				if err := a.history.Record(asn, len(ipv6Prefixes)); err != nil {
+					log.Printf("Failed to record prefix history for ASN %s: %v", asn, err)
+				}
+			}
+
+			// ?format=md returns just the message, as Markdown
+			if r.URL.Query().Get("format") == "md" {
+				w.Header().Set("Content-Type", "text/markdown; charset=utf-8")
+				fmt.Fprintln(w, generateIPv6RequestMarkdown(asn, ipv6Prefixes, negotiateLocale(r, a.cfg.Lang), data.AnnouncesNothing, data.MessageOptions))
+				return
+			}
+			if to := contactAddress(data.ASNDetails); to != "" {
+				data.MailtoURL = mailtoLink(to, asn, data.Message)
+			}
+			data.SupportForm = a.supportFormLink(asn, data.Message)
+			var name string
+			if data.ASNDetails != nil {
+				name = data.ASNDetails.Name
+			}
+			data.Preview = a.sharePreview(r, asn, name, ipv6Prefixes)
 		}
 	} else if data.AutoDetected {
-		// For GET requests, if we auto-detected an ASN, pre-populate the form
+		// Otherwise, if we auto-detected an ASN, pre-populate the form
 		data.ASN = data.DetectedASN
 	}
 
-	err := indexTemplate.Execute(w, data)
+	// The lookups gave up because the request ran out of time
+	if errors.Is(r.Context().Err(), context.DeadlineExceeded) {
+		status = http.StatusGatewayTimeout
+	}
+
+	a.respond(w, r, status, data)
+}
+
+// renderPage renders the web interface with the given HTTP status. The page
+// is rendered into a buffer first, so a template that fails midway yields a
+// clean 500 instead of a half-written page.
+func (a *App) renderPage(w http.ResponseWriter, status int, data pageData) {
+	tmpl, err := a.pageTemplate()
 	if err != nil {
-		http.Error(w, "Error rendering template: "+err.Error(), http.StatusInternalServerError)
+		http.Error(w, "Error loading template: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		log.Printf("Error rendering template: %v", err)
+		http.Error(w, "Error rendering page", http.StatusInternalServerError)
 		return
 	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	buf.WriteTo(w)
+}
+
+// lookupErrorStatus maps an upstream lookup failure to an HTTP status: 422
+// for a reserved ASN, 504 when we ran out of time, 503 when we refused to
+// call upstream (circuit open or too busy) or were rate limited, 404 for an
+// unknown ASN, and 502 for anything else upstream got wrong.
+func lookupErrorStatus(err error) int {
+	var reserved *ReservedASNError
+	switch {
+	case errors.As(err, &reserved):
+		return http.StatusUnprocessableEntity
+	case errors.Is(err, context.DeadlineExceeded):
+		return http.StatusGatewayTimeout
+	case errors.Is(err, errCircuitOpen), errors.Is(err, errUpstreamBusy), errors.Is(err, ErrRateLimited):
+		return http.StatusServiceUnavailable
+	case errors.Is(err, ErrASNNotFound):
+		return http.StatusNotFound
+	default:
+		return http.StatusBadGateway
+	}
 }
 
 func main() {
-	// Check if this is the daemon child process before parsing flags
-	for _, arg := range os.Args[1:] {
-		if arg == "--daemon-child" {
-			runDaemonServer()
-			return
+	cfg, err := loadConfig(os.Args[1:])
+	if err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+
+	if cfg.ShowVersion {
+		fmt.Println(currentVersion())
+		return
+	}
+
+	a, err := newApp(cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if cfg.Batch || cfg.FromFile != "" {
+		input := os.Stdin
+		if cfg.FromFile != "" {
+			f, err := os.Open(cfg.FromFile)
+			if err != nil {
+				log.Fatalf("Failed to open ASN list: %v", err)
+			}
+			defer f.Close()
+			input = f
 		}
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		if err := a.runBatch(ctx, input, os.Stdout, cfg.BatchFormat, cfg.BatchWorkers, cfg.BatchDelay); err != nil {
+			log.Fatalf("Batch lookup failed: %v", err)
+		}
+		return
 	}
 
-	// Parse command-line flags
-	daemon := flag.Bool("d", false, "Run as daemon (background process on IPv6 localhost)")
-	port := flag.String("port", "8080", "Port to listen on")
-	flag.Parse()
+	// Check upstream connectivity in the process that will serve; the
+	// daemon parent only forks the child
+	if cfg.StartupCheck && !cfg.Daemon {
+		if err := a.startupCheck(context.Background()); err != nil {
+			if cfg.StartupCheckFatal {
+				log.Fatalf("Startup check failed, BGPView is unreachable: %v", err)
+			}
+			log.Printf("WARNING: startup check failed, lookups will not work until BGPView is reachable: %v", err)
+		}
+	}
+
+	// The daemon child inherits the parent's flags, so configure it the
+	// same way before starting the server
+	if cfg.DaemonChild {
+		a.runDaemonServer(cfg.Port)
+		return
+	}
 
 	// If daemon flag is set, fork and run in background
-	if *daemon {
-		runAsDaemon()
+	if cfg.Daemon {
+		a.runAsDaemon(cfg.Port)
 		return
 	}
 
 	// Set up signal handling for graceful shutdown
-	c := make(chan os.Signal, 1)
-	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Normal mode - bind to all interfaces, or with -ipv6-only to all
+	// IPv6 ones. Listening on "tcp6" sets IPV6_V6ONLY on the socket, so
+	// IPv4 clients aren't accepted as IPv4-mapped addresses either.
+	network, bindAddr := "tcp", ":"+cfg.Port
+	if cfg.IPv6Only {
+		network, bindAddr = "tcp6", "[::]:"+cfg.Port
+		a.logInfof("Server starting on IPv6 port %s...", cfg.Port)
+	} else {
+		a.logInfof("Server starting on port %s...", cfg.Port)
+	}
+	if err := a.runServer(ctx, network, bindAddr); err != nil {
+		log.Fatalf("Server failed to start: %v", err)
+	}
+}
 
-	// Normal mode - bind to all interfaces
-	bindAddr := ":" + *port
+// runServer serves the web interface on bindAddr of network, "tcp" or
+// "tcp6", until ctx is done, then shuts down gracefully, giving in-flight
+// requests up to 5 seconds to finish.
+// It is shared by the foreground and daemon modes so that both always get
+// the same routing, middleware and shutdown behavior.
+func (a *App) runServer(ctx context.Context, network, bindAddr string) error {
+	listener, err := net.Listen(network, bindAddr)
+	if err != nil {
+		return err
+	}
 
-	// Start HTTP server in a goroutine
 	server := &http.Server{
-		Addr:    bindAddr,
-		Handler: nil,
+		Addr:              bindAddr,
+		Handler:           a.withRequestLogging(withGzip(withSecurityHeaders(withRequestTimeout(a.newRouter(), a.cfg.RequestTimeout)))),
+		ReadHeaderTimeout: a.cfg.ReadHeaderTimeout,
+		ReadTimeout:       a.cfg.ReadTimeout,
+		WriteTimeout:      a.cfg.WriteTimeout,
+		IdleTimeout:       a.cfg.IdleTimeout,
 	}
 
-	http.HandleFunc("/", formHandler)
+	if a.watchlist != nil {
+		go a.watchlist.run(ctx)
+	}
 
+	// Start HTTP server in a goroutine
+	errCh := make(chan error, 1)
 	go func() {
-		log.Printf("Server starting on port %s...", *port)
-		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			log.Fatalf("Server failed to start: %v", err)
-		}
+		errCh <- server.Serve(listener)
 	}()
 
-	// Wait for signal
-	<-c
-	log.Println("Received interrupt signal, shutting down gracefully...")
+	// Wait for the server to fail or for shutdown to be requested
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+	}
+	a.logInfof("Received interrupt signal, shutting down gracefully...")
 
 	// Graceful shutdown with timeout
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	if err := server.Shutdown(ctx); err != nil {
+	if err := server.Shutdown(shutdownCtx); err != nil {
 		log.Printf("Server forced to shutdown: %v", err)
 	}
-	log.Println("Server stopped")
+	a.logInfof("Server stopped")
+	return nil
 }
 
 // runAsDaemon forks the process and runs it in the background on IPv6 localhost
-func runAsDaemon() {
+func (a *App) runAsDaemon(port string) {
 	// Create a new process group to detach from parent
 	if os.Getppid() != 1 {
 		// Re-execute the program without the -d flag, but pass a special flag to indicate daemon child
@@ -793,61 +2314,27 @@ func runAsDaemon() {
 
 		cmd := exec.Command(os.Args[0], args...)
 		cmd.Start()
-		log.Printf("Started daemon process with PID: %d (IPv6 localhost only)", cmd.Process.Pid)
+		a.logInfof("Started daemon process with PID: %d (IPv6 localhost only)", cmd.Process.Pid)
 		os.Exit(0)
 	}
 
 	// This is the daemon process - run the main server logic with IPv6 binding
-	runDaemonServer()
+	a.runDaemonServer(port)
 }
 
 // runDaemonServer runs the HTTP server bound to IPv6 localhost
-func runDaemonServer() {
-	log.Println("Running as daemon on IPv6 localhost...")
-
-	// Extract port from command line args, default to 8080
-	port := "8080"
-	for i, arg := range os.Args[1:] {
-		if arg == "-port" && i+1 < len(os.Args[1:]) {
-			port = os.Args[i+2]
-			break
-		}
-	}
+func (a *App) runDaemonServer(port string) {
+	a.logInfof("Running as daemon on IPv6 localhost...")
 
 	// Set up signal handling for graceful shutdown
-	c := make(chan os.Signal, 1)
-	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
 	// Bind only to IPv6 localhost
-	bindAddr := "[::1]:" + port
-
-	// Start HTTP server in a goroutine
-	server := &http.Server{
-		Addr:    bindAddr,
-		Handler: nil,
-	}
-
-	http.HandleFunc("/", formHandler)
-
-	go func() {
-		log.Printf("Daemon server starting on IPv6 localhost port %s...", port)
-		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			log.Fatalf("Server failed to start: %v", err)
-		}
-	}()
-
-	// Wait for signal
-	<-c
-	log.Println("Received interrupt signal, shutting down gracefully...")
-
-	// Graceful shutdown with timeout
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-
-	if err := server.Shutdown(ctx); err != nil {
-		log.Printf("Server forced to shutdown: %v", err)
+	a.logInfof("Daemon server starting on IPv6 localhost port %s...", port)
+	if err := a.runServer(ctx, "tcp6", "[::1]:"+port); err != nil {
+		log.Fatalf("Server failed to start: %v", err)
 	}
-	log.Println("Server stopped")
 
 	// Redirect stdout and stderr to log file (optional)
 	// You can uncomment this if you want to log to a file
@@ -0,0 +1,674 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// bgpViewIP2001db8 is a BGPView /ip/2001:db8::1 response.
+const bgpViewIP2001db8 = `{"status":"ok","data":{"ip":"2001:db8::1","prefixes":[{"prefix":"2001:db8::/32","asn":{"asn":19625,"name":"BLACKBOX"}}]}}`
+
+// upstreamLookups are the lookups that go to BGPView, each with the path it
+// asks for and the responses to serve for a hit and for nothing found.
+var upstreamLookups = []struct {
+	name   string
+	path   string
+	found  string
+	empty  string // "" when the lookup has no empty answer
+	lookup func(a *App) (int, error)
+}{
+	{
+		name:  "lookupIPv6",
+		path:  "/asn/19625/prefixes",
+		found: bgpViewPrefixes19625,
+		empty: `{"status":"ok","data":{"ipv4_prefixes":[],"ipv6_prefixes":[]}}`,
+		lookup: func(a *App) (int, error) {
+			prefixes, err := a.lookupIPv6(context.Background(), "19625")
+			return len(prefixes), err
+		},
+	},
+	{
+		name:  "lookupASNByIP",
+		path:  "/ip/2001:db8::1",
+		found: bgpViewIP2001db8,
+		empty: `{"status":"ok","data":{"ip":"2001:db8::1","prefixes":[]}}`,
+		lookup: func(a *App) (int, error) {
+			matches, _, err := a.lookupASNByIP(context.Background(), "2001:db8::1")
+			return len(matches), err
+		},
+	},
+	{
+		name:  "lookupASNDetails",
+		path:  "/asn/19625",
+		found: bgpViewASN19625,
+		lookup: func(a *App) (int, error) {
+			details, err := a.lookupASNDetails(context.Background(), "19625")
+			if details == nil {
+				return 0, err
+			}
+			return 1, err
+		},
+	},
+}
+
+// errAny stands for any error in a test case that expects no particular one.
+var errAny = errors.New("any error")
+
+func TestUpstreamLookups(t *testing.T) {
+	type response struct {
+		status int
+		header map[string]string
+		body   string
+	}
+	tests := []struct {
+		name    string
+		args    []string
+		respond func(found, empty string) response
+		want    map[string]int // results per lookup, when there's no error
+		wantErr map[string]error
+	}{
+		{
+			name:    "normal response",
+			respond: func(found, _ string) response { return response{http.StatusOK, nil, found} },
+			want:    map[string]int{"lookupIPv6": 2, "lookupASNByIP": 1, "lookupASNDetails": 1},
+		},
+		{
+			name:    "empty prefix list",
+			respond: func(_, empty string) response { return response{http.StatusOK, nil, empty} },
+			want:    map[string]int{"lookupIPv6": 0},
+			wantErr: map[string]error{"lookupASNByIP": ErrASNNotFound},
+		},
+		{
+			name:    "not found",
+			respond: func(_, _ string) response { return response{http.StatusNotFound, nil, `{"status":"error"}`} },
+			wantErr: map[string]error{"lookupIPv6": ErrASNNotFound, "lookupASNByIP": ErrASNNotFound, "lookupASNDetails": ErrASNNotFound},
+		},
+		{
+			name: "rate limited",
+			respond: func(_, _ string) response {
+				return response{http.StatusTooManyRequests, map[string]string{"Retry-After": "120"}, ""}
+			},
+			wantErr: map[string]error{"lookupIPv6": ErrRateLimited, "lookupASNByIP": ErrRateLimited, "lookupASNDetails": ErrRateLimited},
+		},
+		{
+			name:    "malformed JSON",
+			respond: func(_, _ string) response { return response{http.StatusOK, nil, `{"status":"ok","data":`} },
+			wantErr: map[string]error{"lookupIPv6": errAny, "lookupASNByIP": errAny, "lookupASNDetails": errAny},
+		},
+		{
+			name:    "oversized body",
+			args:    []string{"-max-body-size", "64"},
+			respond: func(found, _ string) response { return response{http.StatusOK, nil, found + strings.Repeat(" ", 64)} },
+			wantErr: map[string]error{"lookupIPv6": errBodyTooLarge, "lookupASNByIP": errBodyTooLarge, "lookupASNDetails": errBodyTooLarge},
+		},
+	}
+	for _, tt := range tests {
+		for _, l := range upstreamLookups {
+			_, wantsResult := tt.want[l.name]
+			wantErr := tt.wantErr[l.name]
+			if !wantsResult && wantErr == nil {
+				continue
+			}
+			t.Run(tt.name+"/"+l.name, func(t *testing.T) {
+				a := newTestApp(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					if r.URL.Path != l.path {
+						http.NotFound(w, r)
+						return
+					}
+					resp := tt.respond(l.found, l.empty)
+					for k, v := range resp.header {
+						w.Header().Set(k, v)
+					}
+					w.WriteHeader(resp.status)
+					w.Write([]byte(resp.body))
+				}), tt.args...)
+
+				n, err := l.lookup(a)
+				switch {
+				case wantErr == nil && err != nil:
+					t.Fatalf("unexpected error: %v", err)
+				case wantErr == errAny && err == nil:
+					t.Fatal("got no error, want one")
+				case wantErr != nil && wantErr != errAny && !errors.Is(err, wantErr):
+					t.Fatalf("got error %v, want %v", err, wantErr)
+				case wantErr == nil && n != tt.want[l.name]:
+					t.Errorf("got %d results, want %d", n, tt.want[l.name])
+				}
+				if wantErr == ErrRateLimited {
+					if wait := bgpViewRateLimit.RetryAfter(); wait < 110*time.Second || wait > 120*time.Second {
+						t.Errorf("holding requests for %v, want the 120s asked for", wait)
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestUpstreamFailuresTripBreaker(t *testing.T) {
+	for _, l := range upstreamLookups {
+		t.Run(l.name, func(t *testing.T) {
+			var hits atomic.Int32
+			a := newTestApp(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				hits.Add(1)
+				http.Error(w, "upstream down", http.StatusBadGateway)
+			}))
+
+			// Each lookup retries twice, so the second trips the breaker
+			// after two attempts and the third doesn't reach upstream.
+			steps := []struct {
+				hits    int32
+				wantErr error
+			}{
+				{3, ErrUpstreamUnavailable},
+				{5, errCircuitOpen},
+				{5, errCircuitOpen},
+			}
+			for i, step := range steps {
+				_, err := l.lookup(a)
+				if !errors.Is(err, ErrUpstreamUnavailable) || !errors.Is(err, step.wantErr) {
+					t.Errorf("lookup %d: got error %v, want %v", i+1, err, step.wantErr)
+				}
+				if got := hits.Load(); got != step.hits {
+					t.Errorf("lookup %d: %d upstream requests in all, want %d", i+1, got, step.hits)
+				}
+			}
+		})
+	}
+}
+
+func TestFormLookupFetchesConcurrently(t *testing.T) {
+	tests := []struct {
+		name          string
+		failing       string // the path that fails
+		failingStatus int
+		status        int
+		contains      []string
+	}{
+		{"details missing", "/asn/19625", http.StatusNotFound, http.StatusOK, []string{"2001:db8::/32", "2001:db8:1::/48"}},
+		{"prefixes missing", "/asn/19625/prefixes", http.StatusNotFound, http.StatusNotFound, []string{"returned status 404 for ASN 19625"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Neither the details nor the prefixes are served until both
+			// have been asked for, which they only are if asked at once
+			arrived, both := make(chan struct{}, 2), make(chan struct{})
+			go func() {
+				<-arrived
+				<-arrived
+				close(both)
+			}()
+			var seen sync.Map
+			var sequential atomic.Bool
+			stub := bgpViewStub(map[string]string{
+				"/asn/19625":          bgpViewASN19625,
+				"/asn/19625/prefixes": bgpViewPrefixes19625,
+			})
+			a := newTestApp(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				_, retry := seen.LoadOrStore(r.URL.Path, true)
+				if !retry && (r.URL.Path == "/asn/19625" || r.URL.Path == "/asn/19625/prefixes") {
+					arrived <- struct{}{}
+					select {
+					case <-both:
+					case <-time.After(2 * time.Second):
+						sequential.Store(true)
+					}
+				}
+				if r.URL.Path == tt.failing {
+					http.Error(w, "failed", tt.failingStatus)
+					return
+				}
+				stub.ServeHTTP(w, r)
+			}))
+
+			r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader("asn=19625"))
+			r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			w := httptest.NewRecorder()
+			a.formHandler(w, r)
+
+			if sequential.Load() {
+				t.Error("details and prefixes were not fetched concurrently")
+			}
+			if w.Code != tt.status {
+				t.Errorf("status = %d, want %d", w.Code, tt.status)
+			}
+			for _, s := range tt.contains {
+				if !strings.Contains(w.Body.String(), s) {
+					t.Errorf("page lacks %q", s)
+				}
+			}
+		})
+	}
+}
+
+func TestCacheKeysIsolated(t *testing.T) {
+	a := newTestApp(t, http.NotFoundHandler())
+	a.cacheSetPrefixes(sourceBGPView, "19625", []string{"2001:db8::/32"}, time.Hour)
+	a.cacheSetIPASN(sourceBGPView, "19625", []MatchedASN{{ASN: "64500"}}, time.Hour)
+
+	// The same ASN from another source, or of another kind, is a miss
+	if _, _, found := a.cacheGetPrefixes(sourceRIPEstat, "19625"); found {
+		t.Error("RIPEstat lookup was served BGPView's prefixes")
+	}
+	if _, _, found := a.cacheGetASNDetails(sourceBGPView, "19625"); found {
+		t.Error("details lookup was served cached prefixes")
+	}
+	if prefixes, _, found := a.cacheGetPrefixes(sourceBGPView, "19625"); !found || len(prefixes) != 1 {
+		t.Errorf("cached prefixes = %v, %v, want the one set", prefixes, found)
+	}
+	if matches, _, found := a.cacheGetIPASN(sourceBGPView, "19625"); !found || matches[0].ASN != "64500" {
+		t.Errorf("cached IP lookup = %v, %v, want AS64500", matches, found)
+	}
+
+	// A value of the wrong type is a miss rather than a panic, whether
+	// stored as is or serialized as by Redis
+	a.cache.Set(cacheKey(sourceBGPView, "details", "64500"), []string{"2001:db8::/32"}, time.Hour)
+	if _, _, found := a.cacheGetASNDetails(sourceBGPView, "64500"); found {
+		t.Error("details lookup was served a prefix list")
+	}
+	a.cache.Set(cacheKey(sourceBGPView, "prefixes", "64500"), json.RawMessage(`{"asn":"64500"}`), time.Hour)
+	if _, _, found := a.cacheGetPrefixes(sourceBGPView, "64500"); found {
+		t.Error("prefix lookup was served serialized details")
+	}
+}
+
+func TestGetClientIPv6(t *testing.T) {
+	tests := []struct {
+		name       string
+		remoteAddr string
+		xff        string
+		want       string
+	}{
+		{"bracketed with port", "[2001:db8::1]:443", "", "2001:db8::1"},
+		{"zone and port", "[fe80::1%eth0]:8080", "", "fe80::1"},
+		{"bare address", "2001:db8::1", "", "2001:db8::1"},
+		{"bracketed without port", "[2001:db8::1]", "", "2001:db8::1"},
+		{"IPv4-mapped", "[::ffff:192.0.2.1]:443", "", "192.0.2.1"},
+		{"forwarded with port", "[::1]:443", "[2001:db8::2]:51234", "2001:db8::2"},
+		{"forwarded with zone", "[::1]:443", "fe80::2%en0", "fe80::2"},
+		{"forwarded after garbage", "[::1]:443", "unknown, 2001:db8::3", "2001:db8::3"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.RemoteAddr = tt.remoteAddr
+			if tt.xff != "" {
+				r.Header.Set("X-Forwarded-For", tt.xff)
+			}
+			if got := getClientIP(r); got != tt.want {
+				t.Errorf("getClientIP = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalizeASNAsdot(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    string
+		wantErr bool
+	}{
+		{"65000.1", "4259840001", false},
+		{"AS1.0", "65536", false},
+		{"as0.65535", "65535", false},
+		{"65535.65535", "4294967295", false},
+		{" 3.10 ", "196618", false},
+		{"0.19625", "19625", false},
+		{"65536.1", "", true},
+		{"1.65536", "", true},
+		{"1.", "", true},
+		{".1", "", true},
+		{"1.2.3", "", true},
+		{"-1.2", "", true},
+	}
+	for _, tt := range tests {
+		got, err := normalizeASN(tt.input)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("normalizeASN(%q) = %q, want an error", tt.input, got)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("normalizeASN(%q) = %q, %v, want %q", tt.input, got, err, tt.want)
+		}
+	}
+}
+
+func TestRunServerDrainsOnCancel(t *testing.T) {
+	started, release := make(chan struct{}, 1), make(chan struct{})
+	stub := bgpViewStub(map[string]string{
+		"/asn/19625":          bgpViewASN19625,
+		"/asn/19625/prefixes": bgpViewPrefixes19625,
+	})
+	a := newTestApp(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/asn/19625/prefixes" {
+			started <- struct{}{}
+			<-release
+		}
+		stub.ServeHTTP(w, r)
+	}))
+
+	// runServer listens itself, so find it a free port
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stopped := make(chan error, 1)
+	go func() { stopped <- a.runServer(ctx, "tcp", addr) }()
+
+	// Wait for the server to come up
+	for i := 0; ; i++ {
+		resp, err := http.Get("http://" + addr + "/")
+		if err == nil {
+			resp.Body.Close()
+			break
+		}
+		if i == 50 {
+			t.Fatalf("server didn't start: %v", err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// A request in flight when shutdown starts is still answered
+	type result struct {
+		status int
+		body   string
+		err    error
+	}
+	inFlight := make(chan result, 1)
+	go func() {
+		resp, err := http.PostForm("http://"+addr+"/", url.Values{"asn": {"19625"}})
+		if err != nil {
+			inFlight <- result{err: err}
+			return
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		inFlight <- result{resp.StatusCode, string(body), err}
+	}()
+	<-started
+	cancel()
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+
+	res := <-inFlight
+	if res.err != nil || res.status != http.StatusOK || !strings.Contains(res.body, "2001:db8::/32") {
+		t.Errorf("in-flight request got %d %q, %v; want the prefixes", res.status, res.body, res.err)
+	}
+	select {
+	case err := <-stopped:
+		if err != nil {
+			t.Errorf("runServer returned %v, want nil", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("runServer didn't return after its context was cancelled")
+	}
+	if _, err := http.Get("http://" + addr + "/"); err == nil {
+		t.Error("server still accepting requests after shutdown")
+	}
+}
+
+func TestFormRejectsMalformedASN(t *testing.T) {
+	var hits atomic.Int32
+	a := newTestApp(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		http.NotFound(w, r)
+	}))
+
+	for _, input := range []string{
+		strings.Repeat("1", 10000),
+		"AS" + strings.Repeat("9", maxASNInputLength),
+		"19625/../../ip/192.0.2.1",
+		"../asn/19625",
+		"19625?foo=bar",
+		"19625%2F..%2Fprefixes",
+		"19625#prefixes",
+		"1 9625",
+	} {
+		name := input
+		if len(name) > 32 {
+			name = name[:32] + "..."
+		}
+		t.Run(name, func(t *testing.T) {
+			form := url.Values{"asn": {input}}.Encode()
+			r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(form))
+			r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			r.RemoteAddr = "10.0.0.1:1234" // not auto-detected
+			w := httptest.NewRecorder()
+			a.formHandler(w, r)
+
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("status = %d, want %d", w.Code, http.StatusBadRequest)
+			}
+		})
+	}
+	if got := hits.Load(); got != 0 {
+		t.Errorf("%d upstream requests for malformed input, want none", got)
+	}
+}
+
+func TestIsRetryableError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"timeout", &url.Error{Op: "Get", URL: "https://api.bgpview.io/asn/1", Err: os.ErrDeadlineExceeded}, true},
+		{"connection reset", &net.OpError{Op: "read", Net: "tcp", Err: os.NewSyscallError("read", syscall.ECONNRESET)}, true},
+		{"connection refused", &net.OpError{Op: "dial", Net: "tcp", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)}, true},
+		{"connection closed early", fmt.Errorf("reading body: %w", io.ErrUnexpectedEOF), true},
+		{"temporary DNS failure", &net.DNSError{Err: "server misbehaving", Name: "api.bgpview.io", IsTemporary: true}, true},
+		{"DNS timeout", &net.DNSError{Err: "i/o timeout", Name: "api.bgpview.io", IsTimeout: true}, true},
+		{"unknown host", &net.DNSError{Err: "no such host", Name: "api.bgpview.io", IsNotFound: true}, false},
+		{"cancelled", &url.Error{Op: "Get", URL: "https://api.bgpview.io/asn/1", Err: context.Canceled}, false},
+		{"deadline", fmt.Errorf("lookup: %w", context.DeadlineExceeded), false},
+		{"unrecognised", errors.New("tls: bad certificate"), false},
+	}
+	for _, tt := range tests {
+		if got := isRetryableError(tt.err); got != tt.want {
+			t.Errorf("%s: isRetryableError(%v) = %v, want %v", tt.name, tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestRetryWithBackoffStatuses(t *testing.T) {
+	tests := []struct {
+		status int
+		hits   int32
+	}{
+		{http.StatusOK, 1},
+		{http.StatusBadRequest, 1},
+		{http.StatusNotFound, 1},
+		{http.StatusTooManyRequests, 1}, // held back by the rate limit instead
+		{http.StatusInternalServerError, 3},
+		{http.StatusServiceUnavailable, 3},
+	}
+	for _, tt := range tests {
+		t.Run(http.StatusText(tt.status), func(t *testing.T) {
+			var hits atomic.Int32
+			a := newTestApp(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				hits.Add(1)
+				w.WriteHeader(tt.status)
+			}))
+
+			resp, err := a.retryWithBackoff(context.Background(), func(ctx context.Context) (*http.Response, error) {
+				return a.httpGet(ctx, a.cfg.BGPViewBase+"/asn/19625")
+			}, 3, upstreamRetryBudget)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != tt.status {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.status)
+			}
+			if got := hits.Load(); got != tt.hits {
+				t.Errorf("%d attempts, want %d", got, tt.hits)
+			}
+		})
+	}
+}
+
+func TestRetryWithBackoffErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		attempts int
+	}{
+		{"transient", &net.OpError{Op: "read", Net: "tcp", Err: os.NewSyscallError("read", syscall.ECONNRESET)}, 3},
+		{"permanent", &net.DNSError{Err: "no such host", Name: "api.bgpview.io", IsNotFound: true}, 1},
+		{"cancelled", context.Canceled, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := newTestApp(t, http.NotFoundHandler())
+			attempts := 0
+			_, err := a.retryWithBackoff(context.Background(), func(ctx context.Context) (*http.Response, error) {
+				attempts++
+				return nil, tt.err
+			}, 3, upstreamRetryBudget)
+			if !errors.Is(err, tt.err) {
+				t.Errorf("got error %v, want %v", err, tt.err)
+			}
+			if attempts != tt.attempts {
+				t.Errorf("%d attempts, want %d", attempts, tt.attempts)
+			}
+		})
+	}
+}
+
+func TestNegativeCache(t *testing.T) {
+	const ttl = 100 * time.Millisecond
+	for _, l := range upstreamLookups {
+		t.Run(l.name, func(t *testing.T) {
+			// Nothing is found at first, then the lookup starts succeeding
+			var hits atomic.Int32
+			a := newTestApp(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != l.path {
+					http.NotFound(w, r)
+					return
+				}
+				if hits.Add(1) == 1 {
+					if l.empty == "" {
+						http.NotFound(w, r)
+						return
+					}
+					w.Write([]byte(l.empty))
+					return
+				}
+				w.Write([]byte(l.found))
+			}), "-negative-cache-ttl", ttl.String())
+
+			first, firstErr := l.lookup(a)
+			if first != 0 {
+				t.Fatalf("first lookup found %d results, want none", first)
+			}
+			again, err := l.lookup(a)
+			if again != 0 || (err == nil) != (firstErr == nil) || (err != nil && (!errors.Is(err, ErrASNNotFound) || err.Error() != firstErr.Error())) {
+				t.Errorf("repeated lookup = %d, %v, want the cached %v", again, err, firstErr)
+			}
+			if got := hits.Load(); got != 1 {
+				t.Errorf("%d upstream requests before the negative TTL ran out, want 1", got)
+			}
+
+			time.Sleep(ttl + 50*time.Millisecond)
+			if n, err := l.lookup(a); err != nil || n == 0 {
+				t.Errorf("lookup after the negative TTL = %d, %v, want the new results", n, err)
+			}
+			if got := hits.Load(); got != 2 {
+				t.Errorf("%d upstream requests in all, want 2", got)
+			}
+		})
+	}
+}
+
+func TestLookupIPv6SortsAndDeduplicates(t *testing.T) {
+	// Multi-origin prefixes are listed once per origin, in no useful order
+	a := newTestApp(t, bgpViewStub(map[string]string{
+		"/asn/19625/prefixes": `{"status":"ok","data":{"ipv4_prefixes":[],"ipv6_prefixes":[
+			{"prefix":"2001:db8:10::/48"},
+			{"prefix":"2001:db8::/32"},
+			{"prefix":"2001:db8:9::/48"},
+			{"prefix":"2001:db8:10::/48"},
+			{"prefix":"not-a-prefix"},
+			{"prefix":"2001:db8::/48"},
+			{"prefix":"2001:db8::/32"},
+			{"prefix":"2001:db8:a::/48"}
+		]}}`,
+	}))
+
+	got, err := a.lookupIPv6(context.Background(), "19625")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"2001:db8::/32", "2001:db8::/48", "2001:db8:9::/48", "2001:db8:a::/48", "2001:db8:10::/48", "not-a-prefix"}
+	if strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("prefixes = %v, want %v", got, want)
+	}
+}
+
+func TestSortPrefixes(t *testing.T) {
+	tests := []struct {
+		in, want []string
+	}{
+		{nil, []string{}},
+		{[]string{"2001:DB8::/32", "2001:db8::/32"}, []string{"2001:DB8::/32"}},
+		{[]string{"zz", "2001:db8::/32", "aa", "zz"}, []string{"2001:db8::/32", "aa", "zz"}},
+		{[]string{"198.51.100.0/24", "192.0.2.0/24", "192.0.2.0/23"}, []string{"192.0.2.0/23", "192.0.2.0/24", "198.51.100.0/24"}},
+	}
+	for _, tt := range tests {
+		if got := sortPrefixes(tt.in); strings.Join(got, " ") != strings.Join(tt.want, " ") {
+			t.Errorf("sortPrefixes(%v) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestGetClientIPForwardedFor(t *testing.T) {
+	tests := []struct {
+		name string
+		xff  []string
+		want string
+	}{
+		{"IPv4", []string{"203.0.113.1"}, "203.0.113.1"},
+		{"IPv4 with port", []string{"203.0.113.1:443"}, "203.0.113.1"},
+		{"IPv6", []string{"2001:db8::1"}, "2001:db8::1"},
+		{"IPv6 with port", []string{"[2001:db8::1]:443"}, "2001:db8::1"},
+		{"bracketed IPv6", []string{"[2001:db8::1]"}, "2001:db8::1"},
+		{"mixed list", []string{"[2001:db8::1]:443, 203.0.113.1:80"}, "2001:db8::1"},
+		{"mixed list, IPv4 first", []string{" 203.0.113.1:80 ,[2001:db8::1]:443"}, "203.0.113.1"},
+		{"garbage skipped", []string{"unknown, , 203.0.113.1:8080"}, "203.0.113.1"},
+		{"port without address skipped", []string{":443, 2001:db8::2"}, "2001:db8::2"},
+		{"repeated headers", []string{"bogus", "[2001:db8::3]:1"}, "2001:db8::3"},
+		{"nothing valid", []string{"unknown, 999.1.1.1"}, "192.0.2.1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.RemoteAddr = "192.0.2.1:1234"
+			for _, xff := range tt.xff {
+				r.Header.Add("X-Forwarded-For", xff)
+			}
+			if got := getClientIP(r); got != tt.want {
+				t.Errorf("getClientIP = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"time"
+)
+
+// logLevel controls how much the server logs. Errors are always logged.
+type logLevel int
+
+const (
+	logQuiet   logLevel = iota // errors only
+	logNormal                  // plus startup, shutdown, retries and breaker changes
+	logVerbose                 // plus every request and cache access
+)
+
+// logLevelFor returns the log level set by cfg's -quiet and -verbose.
+func logLevelFor(cfg *Config) (logLevel, error) {
+	switch {
+	case cfg.Quiet && cfg.Verbose:
+		return logNormal, errors.New("-quiet and -verbose are mutually exclusive")
+	case cfg.Quiet:
+		return logQuiet, nil
+	case cfg.Verbose:
+		return logVerbose, nil
+	}
+	return logNormal, nil
+}
+
+// logInfof logs routine operational events, which -quiet suppresses.
+func (a *App) logInfof(format string, args ...interface{}) {
+	if a.verbosity >= logNormal {
+		log.Printf(format, args...)
+	}
+}
+
+// logDebugf logs per-request and cache events, which only -verbose shows.
+func (a *App) logDebugf(format string, args ...interface{}) {
+	if a.verbosity >= logVerbose {
+		log.Printf(format, args...)
+	}
+}
+
+// statusRecorder captures the status code written by a handler.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// withRequestLogging logs every request with its status and duration when
+// running verbosely, and is a no-op otherwise.
+func (a *App) withRequestLogging(h http.Handler) http.Handler {
+	if a.verbosity < logVerbose {
+		return h
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		h.ServeHTTP(rec, r)
+		a.logDebugf("%s %s %d %v", r.Method, r.URL.Path, rec.status, time.Since(start).Round(time.Millisecond))
+	})
+}
+
+// loggingCache wraps a CacheBackend to log hits, misses and stores. It is
+// only used when running verbosely.
+type loggingCache struct {
+	CacheBackend
+}
+
+func (c loggingCache) Get(key string) (interface{}, time.Duration, bool) {
+	value, age, found := c.CacheBackend.Get(key)
+	if found {
+		log.Printf("Cache hit: %s (age %v)", key, age.Round(time.Second))
+	} else {
+		log.Printf("Cache miss: %s", key)
+	}
+	return value, age, found
+}
+
+func (c loggingCache) Set(key string, value interface{}, ttl time.Duration) {
+	log.Printf("Cache store: %s (ttl %v)", key, ttl)
+	c.CacheBackend.Set(key, value, ttl)
+}
@@ -0,0 +1,450 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// defaultLang is the default of -lang, the language used for the generated
+// message when the request doesn't ask for a supported one.
+const defaultLang = "en"
+
+// rirLink points at a Regional Internet Registry's guide to obtaining IPv6
+// address space. Name identifies the registry and Text, if set, replaces it
+// in the message.
+type rirLink struct {
+	Name string `json:"name"`
+	URL  string `json:"url"`
+	Text string `json:"text,omitempty"`
+}
+
+// Label returns the text to show for the link.
+func (l rirLink) Label() string {
+	if l.Text != "" {
+		return l.Text
+	}
+	return l.Name
+}
+
+// matches reports whether l is the link for rir, a registry name as given
+// by BGPView ("RIPE") or in a link's Name ("RIPE NCC").
+func (l rirLink) matches(rir string) bool {
+	rir = strings.TrimSpace(rir)
+	if rir == "" {
+		return false
+	}
+	first, _, _ := strings.Cut(l.Name, " ")
+	return strings.EqualFold(l.Name, rir) || strings.EqualFold(first, rir)
+}
+
+// defaultRIRLinks lists every RIR in its default order. An App can replace
+// it with -rir-links-file when a registry reorganizes its site.
+var defaultRIRLinks = []rirLink{
+	{Name: "ARIN", URL: "https://www.arin.net/resources/guide/ipv6/first_request/"},
+	{Name: "RIPE NCC", URL: "https://www.ripe.net/manage-ips-and-asns/ipv6/request-ipv6/"},
+	{Name: "APNIC", URL: "https://www.apnic.net/community/ipv6/get-ipv6/"},
+	{Name: "AFRINIC", URL: "https://afrinic.net/support/resource-members/how-can-i-request-for-an-ipv6-prefix?lang=en"},
+	{Name: "LACNIC", URL: "https://www.lacnic.net/1016/2/lacnic/get-ip-addresses_asns"},
+}
+
+// messageStrings holds the translatable parts of the IPv6 request message.
+type messageStrings struct {
+	Intro           string // %s is replaced with StatsNote, or nothing
+	ProspectIntro   string // Intro for someone who isn't a customer yet
+	StatsNote       string // cites the adoption trends page
+	GrowthHeader    string
+	Growth          string
+	OrgHeader       string
+	HasPrefixes     string // %s is replaced with the prefix list
+	ManyPrefixes    string // the prefix count and a few examples
+	HugePrefixes    string // like ManyPrefixes, with the count rounded down
+	NoPrefixes      string
+	NoAnnouncements string // replaces NoPrefixes when no IPv4 is announced either
+	IPv4Scarcity    string // IPv4Prefixes, the IPv4 address count and IPv6Prefixes
+	IPv4Prefixes    pluralString
+	IPv6Prefixes    pluralString
+	RequestHeader   string
+	RequestHas      string
+	RequestNone     string
+	RIRIntro        string
+	DefaultRIRName  string // registry listed first when the locale has no region
+}
+
+// pluralString is a phrase counting something, like "%d IPv4 prefixes",
+// worded for a count of one and for any other count.
+type pluralString struct {
+	One, Other string
+}
+
+// format returns the phrase for n.
+func (p pluralString) format(n int) string {
+	if n == 1 {
+		return fmt.Sprintf(p.One, n)
+	}
+	return fmt.Sprintf(p.Other, n)
+}
+
+// statsURL is the IPv6 adoption trend page cited by every translation.
+const statsURL = "https://stats.ipv6.army/?page=Historical%20Trends"
+
+// messageCatalog maps a base language tag to its message strings.
+var messageCatalog = map[string]messageStrings{
+	"en": {
+		Intro:           "I am a current customer of your internet service. IPv6 now results in nearly 50%% of the global internet traffic%s, over 80%% of mobile traffic, and is available on all major content providers.",
+		ProspectIntro:   "I am considering your internet service. IPv6 now results in nearly 50%% of the global internet traffic%s, over 80%% of mobile traffic, and is available on all major content providers, so IPv6 support is part of my decision.",
+		StatsNote:       " (see current adoption trends: " + statsURL + ")",
+		GrowthHeader:    "📊 GROWTH EVIDENCE:",
+		Growth:          "The growth trend is clear - IPv6 adoption has been steadily increasing over the past 5 years as shown in the Global IPv6 Adoption Timeline. You can view the historical trends and adoption graphs here:\n" + statsURL + "\n\nMajor content providers and ISPs worldwide have implemented IPv6 to future-proof their networks and meet growing demand.",
+		OrgHeader:       "🌐 YOUR ORGANIZATION:",
+		HasPrefixes:     "I see that you have %s registered to your organization.",
+		ManyPrefixes:    "%d IPv6 prefixes, including %s,",
+		HugePrefixes:    "over %d IPv6 prefixes, including %s,",
+		NoPrefixes:      "You currently have no IPv6 associated with your ASN. This represents a significant opportunity to modernize your network infrastructure.",
+		NoAnnouncements: "Your ASN does not currently announce any prefixes at all, IPv4 or IPv6. As you bring the network into service, this is the ideal moment to deploy IPv6 from day one rather than retrofitting it later.",
+		IPv4Scarcity:    "Your network announces %[1]s covering about %[2]s addresses, and %[3]s. The entire IPv4 Internet has only about 4.3 billion addresses, while a single IPv6 /48 alone has more than 10^24.",
+		IPv4Prefixes:    pluralString{"%d IPv4 prefix", "%d IPv4 prefixes"},
+		IPv6Prefixes:    pluralString{"%d IPv6 prefix", "%d IPv6 prefixes"},
+		RequestHeader:   "📋 REQUEST:",
+		RequestHas:      "Because IPv4 is a legacy protocol with severely limited resources available and IPv6 is the current Internet protocol as defined by the IETF, I respectfully request IPv6 support for my current service offering. This would ensure compatibility with the modern Internet infrastructure and provide better connectivity for your customers.",
+		RequestNone:     "As IPv4 address space becomes increasingly scarce and expensive, implementing IPv6 is essential for future growth and compatibility. I respectfully request that you prioritize IPv6 deployment for your network and customer services.",
+		RIRIntro:        "To get started with IPv6, you can request address space from your Regional Internet Registry:",
+		DefaultRIRName:  "ARIN",
+	},
+	"es": {
+		Intro:           "Soy cliente actual de su servicio de internet. IPv6 representa ya casi el 50%% del tráfico global de internet%s, más del 80%% del tráfico móvil, y está disponible en todos los principales proveedores de contenido.",
+		ProspectIntro:   "Estoy considerando contratar su servicio de internet. IPv6 representa ya casi el 50%% del tráfico global de internet%s, más del 80%% del tráfico móvil, y está disponible en todos los principales proveedores de contenido, por lo que el soporte de IPv6 forma parte de mi decisión.",
+		StatsNote:       " (vea las tendencias de adopción actuales: " + statsURL + ")",
+		GrowthHeader:    "📊 EVIDENCIA DE CRECIMIENTO:",
+		Growth:          "La tendencia es clara: la adopción de IPv6 ha aumentado de forma constante durante los últimos 5 años, como muestra la cronología de adopción global de IPv6. Puede consultar las tendencias históricas y los gráficos de adopción aquí:\n" + statsURL + "\n\nLos principales proveedores de contenido e ISP de todo el mundo han implementado IPv6 para preparar sus redes para el futuro y atender la creciente demanda.",
+		OrgHeader:       "🌐 SU ORGANIZACIÓN:",
+		HasPrefixes:     "Veo que su organización tiene registrados %s.",
+		ManyPrefixes:    "%d prefijos IPv6, entre ellos %s",
+		HugePrefixes:    "más de %d prefijos IPv6, entre ellos %s",
+		NoPrefixes:      "Actualmente su ASN no tiene IPv6 asociado. Esto representa una gran oportunidad para modernizar su infraestructura de red.",
+		NoAnnouncements: "Actualmente su ASN no anuncia ningún prefijo, ni IPv4 ni IPv6. Al poner la red en servicio, este es el momento ideal para desplegar IPv6 desde el primer día en lugar de añadirlo más adelante.",
+		IPv4Scarcity:    "Su red anuncia %[1]s, con unas %[2]s direcciones, y %[3]s. Todo el Internet IPv4 tiene solo unos 4.300 millones de direcciones, mientras que un único /48 de IPv6 tiene más de 10^24.",
+		IPv4Prefixes:    pluralString{"%d prefijo IPv4", "%d prefijos IPv4"},
+		IPv6Prefixes:    pluralString{"%d prefijo IPv6", "%d prefijos IPv6"},
+		RequestHeader:   "📋 SOLICITUD:",
+		RequestHas:      "Dado que IPv4 es un protocolo heredado con recursos muy limitados e IPv6 es el protocolo de Internet actual definido por el IETF, solicito respetuosamente soporte de IPv6 para mi servicio actual. Esto garantizaría la compatibilidad con la infraestructura moderna de Internet y ofrecería una mejor conectividad a sus clientes.",
+		RequestNone:     "A medida que el espacio de direcciones IPv4 se vuelve cada vez más escaso y costoso, implementar IPv6 es esencial para el crecimiento y la compatibilidad futuros. Solicito respetuosamente que prioricen el despliegue de IPv6 en su red y sus servicios a clientes.",
+		RIRIntro:        "Para comenzar con IPv6, pueden solicitar espacio de direcciones a su Registro Regional de Internet:",
+		DefaultRIRName:  "LACNIC",
+	},
+	"fr": {
+		Intro:           "Je suis actuellement client de votre service internet. IPv6 représente désormais près de 50 %% du trafic internet mondial%s, plus de 80 %% du trafic mobile, et est disponible chez tous les grands fournisseurs de contenu.",
+		ProspectIntro:   "J'envisage de souscrire à votre service internet. IPv6 représente désormais près de 50 %% du trafic internet mondial%s, plus de 80 %% du trafic mobile, et est disponible chez tous les grands fournisseurs de contenu ; la prise en charge d'IPv6 compte donc dans ma décision.",
+		StatsNote:       " (voir les tendances d'adoption actuelles : " + statsURL + ")",
+		GrowthHeader:    "📊 PREUVES DE CROISSANCE :",
+		Growth:          "La tendance est claire : l'adoption d'IPv6 n'a cessé de progresser au cours des 5 dernières années, comme le montre la chronologie mondiale de l'adoption d'IPv6. Vous pouvez consulter les tendances historiques et les graphiques d'adoption ici :\n" + statsURL + "\n\nLes grands fournisseurs de contenu et FAI du monde entier ont déployé IPv6 pour pérenniser leurs réseaux et répondre à une demande croissante.",
+		OrgHeader:       "🌐 VOTRE ORGANISATION :",
+		HasPrefixes:     "Je constate que %s sont enregistrés au nom de votre organisation.",
+		ManyPrefixes:    "%d préfixes IPv6, dont %s,",
+		HugePrefixes:    "plus de %d préfixes IPv6, dont %s,",
+		NoPrefixes:      "Aucune adresse IPv6 n'est actuellement associée à votre ASN. C'est une occasion importante de moderniser votre infrastructure réseau.",
+		NoAnnouncements: "Votre ASN n'annonce actuellement aucun préfixe, ni IPv4 ni IPv6. Au moment de mettre le réseau en service, c'est l'occasion idéale de déployer IPv6 dès le premier jour plutôt que de l'ajouter plus tard.",
+		IPv4Scarcity:    "Votre réseau annonce %[1]s, soit environ %[2]s adresses, et %[3]s. L'ensemble de l'Internet IPv4 ne compte qu'environ 4,3 milliards d'adresses, alors qu'un seul /48 IPv6 en contient plus de 10^24.",
+		IPv4Prefixes:    pluralString{"%d préfixe IPv4", "%d préfixes IPv4"},
+		IPv6Prefixes:    pluralString{"%d préfixe IPv6", "%d préfixes IPv6"},
+		RequestHeader:   "📋 DEMANDE :",
+		RequestHas:      "IPv4 étant un protocole historique aux ressources très limitées et IPv6 étant le protocole Internet actuel défini par l'IETF, je vous demande respectueusement de prendre en charge IPv6 pour mon offre de service actuelle. Cela garantirait la compatibilité avec l'infrastructure Internet moderne et offrirait une meilleure connectivité à vos clients.",
+		RequestNone:     "L'espace d'adressage IPv4 devenant de plus en plus rare et coûteux, le déploiement d'IPv6 est essentiel pour votre croissance et votre compatibilité futures. Je vous demande respectueusement de faire du déploiement d'IPv6 une priorité pour votre réseau et vos services clients.",
+		RIRIntro:        "Pour démarrer avec IPv6, vous pouvez demander un espace d'adressage auprès de votre registre Internet régional :",
+		DefaultRIRName:  "RIPE NCC",
+	},
+	"de": {
+		Intro:           "Ich bin derzeit Kunde Ihres Internetdienstes. IPv6 macht inzwischen fast 50 %% des weltweiten Internetverkehrs aus%s, über 80 %% des mobilen Datenverkehrs und wird von allen großen Inhalteanbietern unterstützt.",
+		ProspectIntro:   "Ich erwäge, Ihren Internetdienst zu buchen. IPv6 macht inzwischen fast 50 %% des weltweiten Internetverkehrs aus%s, über 80 %% des mobilen Datenverkehrs und wird von allen großen Inhalteanbietern unterstützt, daher ist IPv6-Unterstützung Teil meiner Entscheidung.",
+		StatsNote:       " (siehe aktuelle Verbreitungstrends: " + statsURL + ")",
+		GrowthHeader:    "📊 BELEGE FÜR DAS WACHSTUM:",
+		Growth:          "Der Trend ist eindeutig: Die Verbreitung von IPv6 ist in den letzten 5 Jahren stetig gestiegen, wie die weltweite IPv6-Verbreitungszeitleiste zeigt. Die historischen Trends und Verbreitungsgrafiken finden Sie hier:\n" + statsURL + "\n\nGroße Inhalteanbieter und Internetprovider weltweit haben IPv6 eingeführt, um ihre Netze zukunftssicher zu machen und die wachsende Nachfrage zu bedienen.",
+		OrgHeader:       "🌐 IHRE ORGANISATION:",
+		HasPrefixes:     "Ich sehe, dass für Ihre Organisation %s registriert sind.",
+		ManyPrefixes:    "%d IPv6-Präfixe, darunter %s,",
+		HugePrefixes:    "über %d IPv6-Präfixe, darunter %s,",
+		NoPrefixes:      "Ihrem ASN ist derzeit kein IPv6 zugeordnet. Das ist eine große Chance, Ihre Netzinfrastruktur zu modernisieren.",
+		NoAnnouncements: "Ihr ASN kündigt derzeit überhaupt keine Präfixe an, weder IPv4 noch IPv6. Bei der Inbetriebnahme des Netzes ist jetzt der ideale Zeitpunkt, IPv6 vom ersten Tag an einzuführen, statt es später nachzurüsten.",
+		IPv4Scarcity:    "Ihr Netz kündigt %[1]s mit rund %[2]s Adressen und %[3]s an. Das gesamte IPv4-Internet hat nur etwa 4,3 Milliarden Adressen, ein einziges IPv6-/48 dagegen mehr als 10^24.",
+		IPv4Prefixes:    pluralString{"%d IPv4-Präfix", "%d IPv4-Präfixe"},
+		IPv6Prefixes:    pluralString{"%d IPv6-Präfix", "%d IPv6-Präfixe"},
+		RequestHeader:   "📋 ANFRAGE:",
+		RequestHas:      "Da IPv4 ein veraltetes Protokoll mit stark begrenzten Ressourcen ist und IPv6 das aktuelle, von der IETF definierte Internetprotokoll ist, bitte ich Sie höflich um IPv6-Unterstützung für meinen aktuellen Anschluss. Dies würde die Kompatibilität mit der modernen Internetinfrastruktur sicherstellen und Ihren Kunden eine bessere Konnektivität bieten.",
+		RequestNone:     "Da IPv4-Adressen immer knapper und teurer werden, ist die Einführung von IPv6 für zukünftiges Wachstum und Kompatibilität unerlässlich. Ich bitte Sie höflich, die Einführung von IPv6 in Ihrem Netz und Ihren Kundendiensten zu priorisieren.",
+		RIRIntro:        "Für den Einstieg in IPv6 können Sie Adressraum bei Ihrer regionalen Internet-Registry beantragen:",
+		DefaultRIRName:  "RIPE NCC",
+	},
+	"ja": {
+		Intro:           "私は貴社のインターネットサービスを現在利用している者です。現在、IPv6は世界のインターネットトラフィックの約50%%%s、モバイルトラフィックの80%%以上を占めており、主要なコンテンツプロバイダーはすべてIPv6に対応しています。",
+		ProspectIntro:   "私は貴社のインターネットサービスの利用を検討している者です。現在、IPv6は世界のインターネットトラフィックの約50%%%s、モバイルトラフィックの80%%以上を占めており、主要なコンテンツプロバイダーはすべてIPv6に対応しているため、IPv6対応は契約を判断する上で重要な要素です。",
+		StatsNote:       "（最新の普及動向: " + statsURL + "）",
+		GrowthHeader:    "📊 普及の推移:",
+		Growth:          "傾向は明らかです。世界のIPv6普及タイムラインが示すとおり、IPv6の普及率は過去5年間着実に伸び続けています。過去の推移と普及グラフはこちらでご覧いただけます:\n" + statsURL + "\n\n世界中の主要なコンテンツプロバイダーやISPが、ネットワークの将来性を確保し増大する需要に応えるためにIPv6を導入しています。",
+		OrgHeader:       "🌐 貴社について:",
+		HasPrefixes:     "貴社には %s が登録されていることを確認しました。",
+		ManyPrefixes:    "%[2]s を含む%[1]d個のIPv6プレフィックス",
+		HugePrefixes:    "%[2]s を含む%[1]d個を超えるIPv6プレフィックス",
+		NoPrefixes:      "現在、貴社のASNにはIPv6が割り当てられていません。これはネットワーク基盤を近代化する大きな機会です。",
+		NoAnnouncements: "現在、貴社のASNはIPv4・IPv6ともにプレフィックスを一切広報していません。ネットワークの運用を開始するにあたり、後から追加するのではなく、最初からIPv6を導入する絶好の機会です。",
+		IPv4Scarcity:    "貴社のネットワークは%[1]s（約%[2]s個のアドレス）と%[3]sを広報しています。IPv4インターネット全体のアドレスは約43億個しかありませんが、IPv6の/48ひとつだけで10^24個を超えるアドレスがあります。",
+		IPv4Prefixes:    pluralString{"%d個のIPv4プレフィックス", "%d個のIPv4プレフィックス"},
+		IPv6Prefixes:    pluralString{"%d個のIPv6プレフィックス", "%d個のIPv6プレフィックス"},
+		RequestHeader:   "📋 お願い:",
+		RequestHas:      "IPv4は資源が極めて限られたレガシーなプロトコルであり、IPv6はIETFが定める現行のインターネットプロトコルです。つきましては、現在契約しているサービスでのIPv6対応をお願い申し上げます。これにより現代のインターネット基盤との互換性が確保され、お客様により良い接続性を提供できます。",
+		RequestNone:     "IPv4アドレスはますます枯渇し高価になっており、今後の成長と互換性のためにIPv6の導入は不可欠です。貴社のネットワークおよび顧客向けサービスにおけるIPv6導入を優先していただけますようお願い申し上げます。",
+		RIRIntro:        "IPv6の導入にあたっては、地域インターネットレジストリにアドレス空間を申請できます:",
+		DefaultRIRName:  "APNIC",
+	},
+}
+
+// Tones the message can be written in. toneFormal is the wording in
+// messageCatalog.
+const (
+	toneFormal    = "formal"
+	toneCasual    = "casual"
+	toneTechnical = "technical"
+)
+
+// messageTones lists the tones in the order the page offers them.
+var messageTones = []string{toneFormal, toneCasual, toneTechnical}
+
+// toneStrings replaces the parts of messageStrings that set the tone of the
+// message.
+type toneStrings struct {
+	Intro         string
+	ProspectIntro string
+	RequestHas    string
+	RequestNone   string
+}
+
+// toneCatalog maps a base language tag to its wording for each tone other
+// than formal. A language without wording for a tone falls back to formal.
+var toneCatalog = map[string]map[string]toneStrings{
+	"en": {
+		toneCasual: {
+			Intro:         "Hi! I'm one of your customers. These days IPv6 carries nearly 50%% of all internet traffic%s and over 80%% of mobile traffic, and every major content provider supports it.",
+			ProspectIntro: "Hi! I'm thinking about signing up for your service. These days IPv6 carries nearly 50%% of all internet traffic%s and over 80%% of mobile traffic, and every major content provider supports it, so it matters to me.",
+			RequestHas:    "Since you already have IPv6 space, it would be great to see it turned on for my service too. IPv4 addresses are running out, and IPv6 is simply how the modern internet works. Thanks for considering it!",
+			RequestNone:   "IPv4 addresses keep getting scarcer and pricier, so IPv6 is the way forward. It would be great to see you roll it out on your network and services. Thanks for considering it!",
+		},
+		toneTechnical: {
+			Intro:         "I am a current subscriber on your network. IPv6 now accounts for roughly 50%% of global internet traffic%s and over 80%% of mobile traffic; all major content and CDN providers are dual-stacked.",
+			ProspectIntro: "I am evaluating your network as a provider. IPv6 now accounts for roughly 50%% of global internet traffic%s and over 80%% of mobile traffic; all major content and CDN providers are dual-stacked, so native IPv6 is a requirement for me.",
+			RequestHas:    "Since the address space is already allocated and routed, I request native dual-stack service on my connection: a delegated prefix (a /56 or /48 via DHCPv6-PD) and IPv6 router advertisements on the customer edge. This avoids depending on CGNAT for IPv4 exhaustion and follows current IETF practice (RFC 6540).",
+			RequestNone:   "With IPv4 exhausted at every RIR and reliant on CGNAT or market transfers, I request that you obtain IPv6 space, announce it from your ASN and deploy native dual-stack service with prefix delegation to customers, per current IETF practice (RFC 6540).",
+		},
+	},
+}
+
+// MessageOptions selects a variant of the IPv6 request message.
+type MessageOptions struct {
+	Tone string // toneFormal, toneCasual or toneTechnical; "" is formal
+	// Prospect writes as a prospective customer rather than a current one.
+	Prospect bool
+	// IncludeRIRLinks lists each RIR's IPv6 guide when there is no IPv6.
+	IncludeRIRLinks bool
+	// IncludeStatsLinks cites the adoption statistics and growth trend.
+	IncludeStatsLinks bool
+	// RIR is the ASN's registry, whose link is listed first. It is set
+	// from the ASN details rather than the request.
+	RIR string
+	// IPv4Prefixes are the ASN's IPv4 prefixes, whose address count makes
+	// the scarcity argument concrete. Like RIR, they come from a lookup.
+	IPv4Prefixes []string
+	// RIRLinks are the links to list, in their default order, from the
+	// App's -rir-links-file. Nil is defaultRIRLinks.
+	RIRLinks []rirLink
+}
+
+// defaultMessageOptions is the formal customer message with every link.
+var defaultMessageOptions = MessageOptions{
+	Tone:              toneFormal,
+	IncludeRIRLinks:   true,
+	IncludeStatsLinks: true,
+}
+
+// messageOptionsFromRequest reads the message options from the tone and
+// framing form values. rir_links=0 and stats_links=0 leave out those
+// links; unknown values fall back to the defaults.
+func (a *App) messageOptionsFromRequest(r *http.Request) MessageOptions {
+	opts := defaultMessageOptions
+	opts.RIRLinks = a.rirLinks
+	for _, t := range messageTones {
+		if r.FormValue("tone") == t {
+			opts.Tone = t
+		}
+	}
+	opts.Prospect = r.FormValue("framing") == "prospect"
+	opts.IncludeRIRLinks = r.FormValue("rir_links") != "0"
+	opts.IncludeStatsLinks = r.FormValue("stats_links") != "0"
+	return opts
+}
+
+// messageStringsFor returns the message strings for loc with the wording of
+// opts applied.
+func messageStringsFor(loc locale, opts MessageOptions) messageStrings {
+	strs, ok := messageCatalog[loc.Lang]
+	if !ok {
+		strs = messageCatalog["en"]
+	}
+	if t, ok := toneCatalog[loc.Lang][opts.Tone]; ok {
+		strs.Intro = t.Intro
+		strs.ProspectIntro = t.ProspectIntro
+		strs.RequestHas = t.RequestHas
+		strs.RequestNone = t.RequestNone
+	}
+	return strs
+}
+
+// regionRIR maps ISO 3166 country codes, as found in the region subtag of a
+// language tag, to the RIR serving that country. Countries not listed fall
+// back to the language's default registry.
+var regionRIR = map[string]string{
+	"US": "ARIN", "CA": "ARIN", "PR": "ARIN", "JM": "ARIN", "BS": "ARIN",
+	"GB": "RIPE NCC", "IE": "RIPE NCC", "DE": "RIPE NCC", "AT": "RIPE NCC", "CH": "RIPE NCC",
+	"FR": "RIPE NCC", "BE": "RIPE NCC", "LU": "RIPE NCC", "NL": "RIPE NCC", "ES": "RIPE NCC",
+	"IT": "RIPE NCC", "PT": "RIPE NCC", "SE": "RIPE NCC", "NO": "RIPE NCC", "DK": "RIPE NCC",
+	"FI": "RIPE NCC", "PL": "RIPE NCC", "RU": "RIPE NCC", "UA": "RIPE NCC", "TR": "RIPE NCC",
+	"IL": "RIPE NCC", "AE": "RIPE NCC", "SA": "RIPE NCC",
+	"JP": "APNIC", "CN": "APNIC", "KR": "APNIC", "TW": "APNIC", "HK": "APNIC",
+	"IN": "APNIC", "SG": "APNIC", "AU": "APNIC", "NZ": "APNIC", "ID": "APNIC",
+	"MY": "APNIC", "TH": "APNIC", "VN": "APNIC", "PH": "APNIC", "PK": "APNIC",
+	"ZA": "AFRINIC", "NG": "AFRINIC", "KE": "AFRINIC", "EG": "AFRINIC", "MA": "AFRINIC",
+	"SN": "AFRINIC", "CI": "AFRINIC", "CM": "AFRINIC", "GH": "AFRINIC", "TN": "AFRINIC",
+	"MX": "LACNIC", "BR": "LACNIC", "AR": "LACNIC", "CL": "LACNIC", "CO": "LACNIC",
+	"PE": "LACNIC", "VE": "LACNIC", "EC": "LACNIC", "UY": "LACNIC", "CR": "LACNIC",
+	"419": "LACNIC",
+}
+
+// locale is a negotiated message language plus optional region.
+type locale struct {
+	Lang   string
+	Region string
+}
+
+// parseLocale splits a language tag such as "es-AR" into a locale. The
+// language is lowercased and the region uppercased.
+func parseLocale(tag string) locale {
+	parts := strings.FieldsFunc(strings.TrimSpace(tag), func(r rune) bool {
+		return r == '-' || r == '_'
+	})
+	if len(parts) == 0 {
+		return locale{}
+	}
+
+	loc := locale{Lang: strings.ToLower(parts[0])}
+	for _, p := range parts[1:] {
+		// The region is the first two-letter or three-digit subtag
+		if len(p) == 2 || (len(p) == 3 && p[0] >= '0' && p[0] <= '9') {
+			loc.Region = strings.ToUpper(p)
+			break
+		}
+	}
+	return loc
+}
+
+// negotiateLocale picks the message locale for a request: an explicit ?lang=
+// parameter wins, then the highest-weighted supported Accept-Language entry,
+// then fallback, the -lang.
+func negotiateLocale(r *http.Request, fallback string) locale {
+	if lang := r.URL.Query().Get("lang"); lang != "" {
+		if loc := parseLocale(lang); isSupportedLang(loc.Lang) {
+			return loc
+		}
+	}
+
+	type weighted struct {
+		loc locale
+		q   float64
+	}
+	var candidates []weighted
+	for _, part := range strings.Split(r.Header.Get("Accept-Language"), ",") {
+		tag, params, _ := strings.Cut(part, ";")
+		loc := parseLocale(tag)
+		if !isSupportedLang(loc.Lang) {
+			continue
+		}
+
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if parsed, err := strconv.ParseFloat(v, 64); err == nil {
+				q = parsed
+			}
+		}
+		if q > 0 {
+			candidates = append(candidates, weighted{loc: loc, q: q})
+		}
+	}
+	if len(candidates) > 0 {
+		sort.SliceStable(candidates, func(i, j int) bool {
+			return candidates[i].q > candidates[j].q
+		})
+		return candidates[0].loc
+	}
+
+	if isSupportedLang(fallback) {
+		return locale{Lang: fallback}
+	}
+	return locale{Lang: "en"}
+}
+
+func isSupportedLang(lang string) bool {
+	_, ok := messageCatalog[lang]
+	return ok
+}
+
+// loadRIRLinks reads the JSON array of RIR links in path, each an object
+// with "name", "url" and optionally "text".
+func loadRIRLinks(path string) ([]rirLink, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read RIR links: %w", err)
+	}
+	var links []rirLink
+	if err := json.Unmarshal(data, &links); err != nil {
+		return nil, fmt.Errorf("failed to parse RIR links %s: %w", path, err)
+	}
+	if len(links) == 0 {
+		return nil, fmt.Errorf("%s lists no RIR links", path)
+	}
+	for i, l := range links {
+		if l.Name == "" || l.URL == "" {
+			return nil, fmt.Errorf("RIR link %d in %s needs a name and a url", i+1, path)
+		}
+	}
+	return links, nil
+}
+
+// orderedRIRLinks returns links, or defaultRIRLinks when nil, with the
+// preferred registry moved to the front, keeping the rest in their default
+// order. The ASN's own registry, rir, is preferred when known; otherwise the
+// one serving loc.
+func orderedRIRLinks(links []rirLink, loc locale, rir string) []rirLink {
+	if links == nil {
+		links = defaultRIRLinks
+	}
+	preferred, ok := regionRIR[loc.Region]
+	if !ok {
+		preferred = messageCatalog[loc.Lang].DefaultRIRName
+	}
+	if rir != "" {
+		preferred = rir
+	}
+
+	ordered := make([]rirLink, 0, len(links))
+	for _, l := range links {
+		if l.matches(preferred) {
+			ordered = append(ordered, l)
+		}
+	}
+	for _, l := range links {
+		if !l.matches(preferred) {
+			ordered = append(ordered, l)
+		}
+	}
+	return ordered
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGenerateIPv6RequestMessageVariants(t *testing.T) {
+	prefixes := []string{"2001:db8::/32", "2001:db8:1::/48"}
+	en := locale{Lang: "en"}
+	with := func(change func(*MessageOptions)) MessageOptions {
+		opts := defaultMessageOptions
+		change(&opts)
+		return opts
+	}
+
+	tests := []struct {
+		name             string
+		prefixes         []string
+		announcesNothing bool
+		opts             MessageOptions
+		contains         []string
+		lacks            []string
+	}{
+		{
+			name:     "formal",
+			prefixes: prefixes,
+			opts:     defaultMessageOptions,
+			contains: []string{"I am a current customer", "I see that you have 2001:db8::/32", "2001:db8:1::/48", "I respectfully request IPv6 support", statsURL, "📊 GROWTH EVIDENCE:"},
+			lacks:    []string{"To get started with IPv6"},
+		},
+		{
+			name:     "casual",
+			prefixes: prefixes,
+			opts:     with(func(o *MessageOptions) { o.Tone = toneCasual }),
+			contains: []string{"Hi! I'm one of your customers", "Since you already have IPv6 space"},
+			lacks:    []string{"I am a current customer"},
+		},
+		{
+			name:     "technical",
+			prefixes: prefixes,
+			opts:     with(func(o *MessageOptions) { o.Tone = toneTechnical }),
+			contains: []string{"I am a current subscriber", "native dual-stack service", "DHCPv6-PD"},
+		},
+		{
+			name:     "unknown tone",
+			prefixes: prefixes,
+			opts:     with(func(o *MessageOptions) { o.Tone = "sarcastic" }),
+			contains: []string{"I am a current customer"},
+		},
+		{
+			name:     "prospect",
+			prefixes: prefixes,
+			opts:     with(func(o *MessageOptions) { o.Prospect = true }),
+			contains: []string{"I am considering your internet service"},
+			lacks:    []string{"current customer"},
+		},
+		{
+			name:     "casual prospect",
+			prefixes: prefixes,
+			opts:     with(func(o *MessageOptions) { o.Tone, o.Prospect = toneCasual, true }),
+			contains: []string{"I'm thinking about signing up"},
+		},
+		{
+			name:     "without stats links",
+			prefixes: prefixes,
+			opts:     with(func(o *MessageOptions) { o.IncludeStatsLinks = false }),
+			lacks:    []string{statsURL, "GROWTH EVIDENCE"},
+		},
+		{
+			name:     "no prefixes",
+			opts:     defaultMessageOptions,
+			contains: []string{"You currently have no IPv6", "prioritize IPv6 deployment", "To get started with IPv6", "- ARIN: https://www.arin.net/"},
+			lacks:    []string{"I see that you have"},
+		},
+		{
+			name:     "no prefixes without RIR links",
+			opts:     with(func(o *MessageOptions) { o.IncludeRIRLinks = false }),
+			contains: []string{"You currently have no IPv6"},
+			lacks:    []string{"To get started with IPv6", "arin.net"},
+		},
+		{
+			name:             "no announcements",
+			announcesNothing: true,
+			opts:             defaultMessageOptions,
+			contains:         []string{"does not currently announce any prefixes at all"},
+			lacks:            []string{"You currently have no IPv6"},
+		},
+		{
+			name:     "IPv4 scarcity",
+			prefixes: prefixes[:1],
+			opts:     with(func(o *MessageOptions) { o.IPv4Prefixes = []string{"192.0.2.0/24", "198.51.100.0/24"} }),
+			contains: []string{"announces 2 IPv4 prefixes covering about 512 addresses, and 1 IPv6 prefix."},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg := generateIPv6RequestMessage("19625", tt.prefixes, en, tt.announcesNothing, tt.opts)
+			for _, s := range tt.contains {
+				if !strings.Contains(msg, s) {
+					t.Errorf("message lacks %q:\n%s", s, msg)
+				}
+			}
+			for _, s := range tt.lacks {
+				if strings.Contains(msg, s) {
+					t.Errorf("message contains %q:\n%s", s, msg)
+				}
+			}
+		})
+	}
+}
+
+func TestGenerateIPv6RequestMessageRIROrder(t *testing.T) {
+	opts := defaultMessageOptions
+	opts.RIR = "RIPE"
+	msg := generateIPv6RequestMessage("19625", nil, locale{Lang: "en"}, false, opts)
+	ripe, arin := strings.Index(msg, "ripe.net"), strings.Index(msg, "arin.net")
+	if ripe < 0 || arin < 0 || ripe > arin {
+		t.Errorf("the ASN's registry, RIPE NCC, isn't listed first:\n%s", msg)
+	}
+
+	md := generateIPv6RequestMarkdown("19625", nil, locale{Lang: "en"}, false, opts)
+	if !strings.Contains(md, "### 📋 REQUEST:") || !strings.Contains(md, "- [RIPE NCC](https://www.ripe.net/") {
+		t.Errorf("Markdown message lacks headings or links:\n%s", md)
+	}
+}
@@ -0,0 +1,269 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Formats a lookup on / can be rendered in.
+const (
+	formatHTML     = "html"
+	formatJSON     = "json"
+	formatText     = "text"
+	formatMarkdown = "md" // just the generated message
+)
+
+// negotiateFormat picks the format to answer r in: the one named by
+// ?format=, or else the one its Accept header prefers. Browsers ask for
+// text/html; API clients for application/json; and curl, which accepts
+// anything, gets plain text. Without an Accept header, HTML is served.
+func negotiateFormat(r *http.Request) string {
+	switch format := r.URL.Query().Get("format"); format {
+	case formatHTML, formatJSON, formatText, formatMarkdown:
+		return format
+	case "txt":
+		return formatText
+	}
+
+	accept := r.Header.Get("Accept")
+	if accept == "" {
+		return formatHTML
+	}
+	best, bestQ := "", 0.0
+	anything := false
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(part)
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(v, 64); err != nil {
+				continue
+			}
+		}
+		var format string
+		switch mediaType {
+		case "text/html", "application/xhtml+xml":
+			format = formatHTML
+		case "application/json":
+			format = formatJSON
+		case "text/plain":
+			format = formatText
+		case "*/*", "text/*":
+			anything = anything || q > 0
+			continue
+		default:
+			continue
+		}
+		// Earlier entries win ties, as clients list their preference first
+		if q > bestQ {
+			best, bestQ = format, q
+		}
+	}
+	if best == "" && anything {
+		return formatText
+	}
+	if best == "" {
+		return formatHTML
+	}
+	return best
+}
+
+// respond renders the outcome of a request to / in the format r asks for.
+func (a *App) respond(w http.ResponseWriter, r *http.Request, status int, data pageData) {
+	w.Header().Add("Vary", "Accept")
+	switch negotiateFormat(r) {
+	case formatJSON:
+		writeResultJSON(w, status, data)
+	case formatText, formatMarkdown:
+		writeResultText(w, status, data)
+	default:
+		a.renderPage(w, status, data)
+	}
+}
+
+// lookupResult is the JSON rendering of a request to /. Only the parts
+// that apply to the request are present: a lookup of an ASN, a domain or an
+// AS-SET, a name search, or, with no lookup at all, the client's detected
+// network.
+type lookupResult struct {
+	ASN            string            `json:"asn,omitempty"`
+	Name           string            `json:"name,omitempty"`
+	Description    string            `json:"description,omitempty"`
+	CountryCode    string            `json:"country_code,omitempty"`
+	RIR            string            `json:"rir,omitempty"`
+	Website        string            `json:"website,omitempty"`
+	AbuseContacts  []string          `json:"abuse_contacts,omitempty"`
+	EmailContacts  []string          `json:"email_contacts,omitempty"`
+	Domain         string            `json:"domain,omitempty"`
+	DomainIP       string            `json:"domain_ip,omitempty"`
+	IPv6Readiness  string            `json:"ipv6_readiness,omitempty"`
+	IPv6Prefixes   []string          `json:"ipv6_prefixes,omitempty"`
+	Freshness      *Freshness        `json:"freshness,omitempty"`
+	Message        string            `json:"message,omitempty"`
+	ASSet          *asSetResult      `json:"as_set,omitempty"`
+	SearchQuery    string            `json:"search_query,omitempty"`
+	SearchResults  []searchResult    `json:"search_results,omitempty"`
+	ClientIP       string            `json:"client_ip,omitempty"`
+	DetectedASNs   []detectedNetwork `json:"detected_asns,omitempty"`
+	PrivateNetwork bool              `json:"private_network,omitempty"`
+}
+
+// asSetResult is the JSON rendering of an ASSetResult.
+type asSetResult struct {
+	Name      string              `json:"name"`
+	Members   []asSetMemberResult `json:"members"`
+	Unchecked int                 `json:"unchecked_members,omitempty"`
+	Prefixes  []string            `json:"ipv6_prefixes"`
+}
+
+// asSetMemberResult is the JSON rendering of an ASSetMember.
+type asSetMemberResult struct {
+	ASN         string `json:"asn"`
+	PrefixCount int    `json:"ipv6_prefix_count"`
+	Error       string `json:"error,omitempty"`
+}
+
+// searchResult is the JSON rendering of an ASNSearchResult.
+type searchResult struct {
+	ASN         string `json:"asn"`
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	CountryCode string `json:"country_code,omitempty"`
+}
+
+// detectedNetwork is the JSON rendering of a MatchedASN.
+type detectedNetwork struct {
+	ASN    string `json:"asn"`
+	Name   string `json:"name,omitempty"`
+	Prefix string `json:"prefix,omitempty"`
+}
+
+// writeResultJSON writes data as a lookupResult, or as an apiError if the
+// request failed.
+func writeResultJSON(w http.ResponseWriter, status int, data pageData) {
+	if data.Error != "" {
+		var body apiError
+		body.Error.Code = pageErrorCode(status, data.ErrorKind)
+		body.Error.Message = data.Error
+		body.Error.RetryAfterSeconds = data.RetryAfter
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(body)
+		return
+	}
+
+	result := lookupResult{
+		Domain:   data.Domain,
+		DomainIP: data.DomainIP,
+	}
+	switch {
+	case data.ASSet != nil:
+		set := &asSetResult{Name: data.ASSet.Name, Unchecked: data.ASSet.Unchecked, Prefixes: data.ASSet.Prefixes}
+		for _, m := range data.ASSet.Members {
+			set.Members = append(set.Members, asSetMemberResult(m))
+		}
+		result.ASSet = set
+	case data.SearchQuery != "":
+		result.SearchQuery = data.SearchQuery
+		for _, s := range data.SearchResults {
+			result.SearchResults = append(result.SearchResults, searchResult(s))
+		}
+	case data.Readiness != "":
+		result.ASN = data.ASN
+		result.IPv6Readiness = data.Readiness
+		result.IPv6Prefixes = data.Prefixes
+		result.Freshness = data.Freshness
+		result.Message = data.Message
+		if d := data.ASNDetails; d != nil {
+			result.Name = d.Name
+			result.Description = d.DescriptionShort
+			result.CountryCode = d.CountryCode
+			result.RIR = d.RIRAllocation
+			result.Website = d.Website
+			result.AbuseContacts = d.AbuseContacts
+			result.EmailContacts = d.EmailContacts
+		}
+	default:
+		result.ClientIP = data.SourceIP
+		result.PrivateNetwork = data.PrivateNetwork
+		for _, m := range data.MatchedASNs {
+			result.DetectedASNs = append(result.DetectedASNs, detectedNetwork(m))
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(result)
+}
+
+// pageErrorCode returns the JSON API error code for a failed request to /,
+// from the kind of its lookup error or else its status.
+func pageErrorCode(status int, kind string) string {
+	switch {
+	case kind == "not-found", status == http.StatusNotFound:
+		return codeNotFound
+	case kind == "rate-limited":
+		return codeRateLimited
+	case status < 500:
+		return codeInvalidInput
+	}
+	return codeUpstreamError
+}
+
+// writeResultText writes data as whois-style plain text, like /asn/{asn}.txt
+// for a lookup of an ASN.
+func writeResultText(w http.ResponseWriter, status int, data pageData) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	if data.Error != "" {
+		w.WriteHeader(status)
+		fmt.Fprintf(w, "%% Error: %s\n", data.Error)
+		return
+	}
+	w.WriteHeader(status)
+
+	if data.Domain != "" {
+		fmt.Fprintf(w, "%% %s resolves to %s\n", data.Domain, data.DomainIP)
+	}
+	switch {
+	case data.ASSet != nil:
+		fmt.Fprintf(w, "%-16s%s\n", "as-set:", data.ASSet.Name)
+		for _, m := range data.ASSet.Members {
+			if m.Error != "" {
+				fmt.Fprintf(w, "%-16sAS%s (%s)\n", "member:", m.ASN, m.Error)
+			} else {
+				fmt.Fprintf(w, "%-16sAS%s (%d IPv6 prefixes)\n", "member:", m.ASN, m.PrefixCount)
+			}
+		}
+		if data.ASSet.Unchecked > 0 {
+			fmt.Fprintf(w, "%% %d more members not checked\n", data.ASSet.Unchecked)
+		}
+		for _, prefix := range data.ASSet.Prefixes {
+			fmt.Fprintf(w, "%-16s%s\n", "route6:", prefix)
+		}
+	case data.SearchQuery != "":
+		fmt.Fprintf(w, "%% %d networks matching %q\n", len(data.SearchResults), data.SearchQuery)
+		for _, s := range data.SearchResults {
+			fmt.Fprintf(w, "%-16s%s", "AS"+s.ASN, s.Name)
+			if s.CountryCode != "" {
+				fmt.Fprintf(w, " (%s)", s.CountryCode)
+			}
+			fmt.Fprintln(w)
+		}
+	case data.Readiness != "":
+		writeASNText(w, data.ASN, data.ASNDetails, data.Prefixes)
+	default:
+		if data.SourceIP != "" {
+			fmt.Fprintf(w, "%% Your address: %s\n", data.SourceIP)
+		}
+		for _, m := range data.MatchedASNs {
+			fmt.Fprintf(w, "%% Your network: AS%s %s (%s)\n", m.ASN, m.Name, m.Prefix)
+		}
+		fmt.Fprintln(w, "% Look up an ASN with /?asn=<number>")
+	}
+}
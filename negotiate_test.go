@@ -0,0 +1,82 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestNegotiateFormat(t *testing.T) {
+	tests := []struct {
+		query  string
+		accept string
+		want   string
+	}{
+		{"", "", formatHTML},
+		{"", "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8", formatHTML},
+		{"", "application/json", formatJSON},
+		{"", "text/plain", formatText},
+		{"", "*/*", formatText},
+		{"", "text/*", formatText},
+		{"", "application/json;q=0.5, text/plain;q=0.9", formatText},
+		{"", "text/plain, application/json", formatText},
+		{"", "application/json, text/plain", formatJSON},
+		{"", "application/json;q=0", formatHTML},
+		{"", "*/*;q=0", formatHTML},
+		{"", "image/png", formatHTML},
+		{"", "application/json;q=bogus, text/html", formatHTML},
+		{"format=json", "text/html", formatJSON},
+		{"format=txt", "text/html", formatText},
+		{"format=md", "", formatMarkdown},
+		{"format=xml", "application/json", formatJSON},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/?"+tt.query, nil)
+		if tt.accept != "" {
+			r.Header.Set("Accept", tt.accept)
+		}
+		if got := negotiateFormat(r); got != tt.want {
+			t.Errorf("negotiateFormat(?%s, Accept: %q) = %q, want %q", tt.query, tt.accept, got, tt.want)
+		}
+	}
+}
+
+func TestLookupServedInNegotiatedFormat(t *testing.T) {
+	a := newTestApp(t, bgpViewStub(map[string]string{
+		"/asn/19625":          bgpViewASN19625,
+		"/asn/19625/prefixes": bgpViewPrefixes19625,
+	}))
+	router := a.newRouter()
+
+	tests := []struct {
+		accept      string
+		contentType string
+		contains    string
+	}{
+		{"text/html", "text/html", "<html"},
+		{"application/json", "application/json", `"asn":"19625"`},
+		{"text/plain", "text/plain", "2001:db8::/32"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.accept, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/?asn=19625", nil)
+			r.Header.Set("Accept", tt.accept)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, r)
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, want %d", w.Code, http.StatusOK)
+			}
+			if got := w.Header().Get("Content-Type"); !strings.HasPrefix(got, tt.contentType) {
+				t.Errorf("Content-Type = %q, want %s", got, tt.contentType)
+			}
+			if got := w.Header().Get("Vary"); !strings.Contains(got, "Accept") {
+				t.Errorf("Vary = %q, want Accept", got)
+			}
+			if !strings.Contains(w.Body.String(), tt.contains) {
+				t.Errorf("body lacks %q", tt.contains)
+			}
+		})
+	}
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// webhookClient delivers webhooks. It is separate from the App's client,
+// which is only for BGPView and is replaced in offline mode.
+var webhookClient = &http.Client{
+	Timeout:   10 * time.Second,
+	Transport: newUpstreamTransport(),
+}
+
+// ipv6Event is the JSON body of a webhook notification.
+type ipv6Event struct {
+	Event           string    `json:"event"`
+	ASN             string    `json:"asn"`
+	Name            string    `json:"name,omitempty"`
+	IPv6PrefixCount int       `json:"ipv6_prefix_count"`
+	Prefixes        []string  `json:"prefixes"`
+	DetectedAt      time.Time `json:"detected_at"`
+}
+
+// checkWebhookURL reports whether u can be used with -webhook-url.
+func checkWebhookURL(u string) error {
+	parsed, err := url.Parse(u)
+	if err != nil {
+		return err
+	}
+	if parsed.Scheme != "http" && parsed.Scheme != "https" || parsed.Host == "" {
+		return fmt.Errorf("%q is not an http or https URL", u)
+	}
+	return nil
+}
+
+// sendWebhook posts event to the -webhook-url. Any 2xx response counts as
+// delivered.
+func (a *App) sendWebhook(ctx context.Context, event ipv6Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, a.cfg.WebhookURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", a.userAgent())
+
+	resp, err := webhookClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("webhook request failed: %w", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// watchState remembers the last known IPv6 prefix count of each watched
+// ASN, so that a transition to IPv6 is noticed once, even across restarts.
+type watchState struct {
+	path string // empty to keep the state in memory only
+
+	mu     sync.Mutex
+	counts map[string]int
+}
+
+// loadWatchState reads the state saved at path, if any. An empty path gives
+// a state that isn't persisted.
+func loadWatchState(path string) (*watchState, error) {
+	s := &watchState{path: path, counts: make(map[string]int)}
+	if path == "" {
+		return s, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read watch state %s: %w", path, err)
+	}
+	if err := json.Unmarshal(data, &s.counts); err != nil {
+		return nil, fmt.Errorf("failed to parse watch state %s: %w", path, err)
+	}
+	return s, nil
+}
+
+// gained reports whether asn has just gained IPv6 if it now has count
+// prefixes: it was last seen with no IPv6 prefixes and now has some. An ASN
+// seen for the first time never counts as gaining IPv6.
+func (s *watchState) gained(asn string, count int) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	prev, known := s.counts[asn]
+	return known && prev == 0 && count > 0
+}
+
+// update records count for asn, saving the state if it changed.
+func (s *watchState) update(asn string, count int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if prev, known := s.counts[asn]; known && prev == count {
+		return nil
+	}
+	s.counts[asn] = count
+	return s.save()
+}
+
+// save writes the state to its file, replacing the old one atomically so a
+// crash can't leave it truncated. The caller must hold s.mu.
+func (s *watchState) save() error {
+	if s.path == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(s.counts, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), ".watch-state-*")
+	if err != nil {
+		return fmt.Errorf("failed to save watch state: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to save watch state: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to save watch state: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return fmt.Errorf("failed to save watch state: %w", err)
+	}
+	return nil
+}
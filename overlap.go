@@ -0,0 +1,130 @@
+package main
+
+import (
+	"net/netip"
+	"sort"
+	"strings"
+)
+
+// CoveredPrefix is an announced prefix that lies within another announced,
+// less specific prefix.
+type CoveredPrefix struct {
+	Prefix    string
+	CoveredBy string
+}
+
+// PrefixAggregate is a prefix that adjacent announced prefixes add up to
+// exactly, and so could be announced in their place.
+type PrefixAggregate struct {
+	Prefix   string
+	Prefixes []string // the announced prefixes it replaces
+}
+
+// PrefixAnalysis describes how well an ASN's announcements are aggregated.
+// More-specifics and unaggregated announcements aren't necessarily
+// mistakes, as they are often used for traffic engineering, but each one
+// adds to the global routing table.
+type PrefixAnalysis struct {
+	Announced  int // distinct valid prefixes
+	Covered    []CoveredPrefix
+	Aggregates []PrefixAggregate
+	// Minimal is how many announcements would cover the same addresses,
+	// with covered prefixes dropped and aggregates merged.
+	Minimal int
+}
+
+// analyzePrefixes finds the prefixes in the list that are covered by
+// another, and the adjacent ones that could be merged into fewer
+// announcements. Unparseable prefixes are skipped.
+func analyzePrefixes(prefixes []string) *PrefixAnalysis {
+	seen := make(map[netip.Prefix]bool)
+	var parsed []netip.Prefix
+	for _, p := range prefixes {
+		prefix, err := netip.ParsePrefix(strings.TrimSpace(p))
+		if err != nil {
+			continue
+		}
+		prefix = prefix.Masked()
+		if !seen[prefix] {
+			seen[prefix] = true
+			parsed = append(parsed, prefix)
+		}
+	}
+
+	// In address order, with a covering prefix before those it covers, the
+	// prefixes not covered by any other are disjoint, and each covered
+	// prefix is covered by the last of them
+	sort.Slice(parsed, func(i, j int) bool {
+		if c := parsed[i].Addr().Compare(parsed[j].Addr()); c != 0 {
+			return c < 0
+		}
+		return parsed[i].Bits() < parsed[j].Bits()
+	})
+
+	analysis := &PrefixAnalysis{Announced: len(parsed)}
+	var outermost []netip.Prefix
+	for _, prefix := range parsed {
+		if n := len(outermost); n > 0 && outermost[n-1].Overlaps(prefix) {
+			analysis.Covered = append(analysis.Covered, CoveredPrefix{
+				Prefix:    prefix.String(),
+				CoveredBy: outermost[n-1].String(),
+			})
+			continue
+		}
+		outermost = append(outermost, prefix)
+	}
+
+	// Merge sibling halves into their parent until none are left. The
+	// outermost prefixes are disjoint, so a parent never overlaps another.
+	merged := make(map[netip.Prefix][]netip.Prefix, len(outermost))
+	for _, prefix := range outermost {
+		merged[prefix] = []netip.Prefix{prefix}
+	}
+	for changed := true; changed; {
+		changed = false
+		for prefix, parts := range merged {
+			if prefix.Bits() == 0 {
+				continue
+			}
+			parent, _ := prefix.Addr().Prefix(prefix.Bits() - 1)
+			sibling := siblingPrefix(prefix)
+			siblingParts, ok := merged[sibling]
+			if !ok {
+				continue
+			}
+			delete(merged, prefix)
+			delete(merged, sibling)
+			merged[parent] = append(parts, siblingParts...)
+			changed = true
+		}
+	}
+
+	analysis.Minimal = len(merged)
+	var aggregates []netip.Prefix
+	for prefix, parts := range merged {
+		if len(parts) > 1 {
+			aggregates = append(aggregates, prefix)
+		}
+	}
+	sort.Slice(aggregates, func(i, j int) bool { return aggregates[i].Addr().Less(aggregates[j].Addr()) })
+	for _, prefix := range aggregates {
+		parts := merged[prefix]
+		sort.Slice(parts, func(i, j int) bool { return parts[i].Addr().Less(parts[j].Addr()) })
+		aggregate := PrefixAggregate{Prefix: prefix.String()}
+		for _, p := range parts {
+			aggregate.Prefixes = append(aggregate.Prefixes, p.String())
+		}
+		analysis.Aggregates = append(analysis.Aggregates, aggregate)
+	}
+	return analysis
+}
+
+// siblingPrefix returns the other half of the prefix one bit shorter than
+// prefix: 2001:db8:1::/48 for 2001:db8::/48.
+func siblingPrefix(prefix netip.Prefix) netip.Prefix {
+	b := prefix.Addr().AsSlice()
+	bit := prefix.Bits() - 1
+	b[bit/8] ^= 0x80 >> (bit % 8)
+	addr, _ := netip.AddrFromSlice(b)
+	return netip.PrefixFrom(addr, prefix.Bits())
+}
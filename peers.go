@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// bgpViewUpstreamsData represents the structure of the JSON response from
+// BGPView API for an ASN's upstream (transit) providers.
+type bgpViewUpstreamsData struct {
+	Data struct {
+		IPv4Upstreams []bgpViewPeer `json:"ipv4_upstreams"`
+		IPv6Upstreams []bgpViewPeer `json:"ipv6_upstreams"`
+	} `json:"data"`
+}
+
+type bgpViewPeer struct {
+	ASN         int    `json:"asn"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	CountryCode string `json:"country_code"`
+}
+
+// Peer is a neighbouring ASN.
+type Peer struct {
+	ASN         string
+	Name        string
+	Description string
+	CountryCode string
+}
+
+// ASNPeers holds an ASN's upstream providers for each address family.
+type ASNPeers struct {
+	IPv4Upstreams []Peer
+	IPv6Upstreams []Peer
+}
+
+// cacheGetPeers returns the cached upstreams for an ASN from source, and
+// their age.
+func (a *App) cacheGetPeers(source, asn string) (*ASNPeers, time.Duration, bool) {
+	return cacheGetAs[*ASNPeers](a.cache, cacheKey(source, "peers", asn))
+}
+
+// cacheSetPeers caches the upstreams for an ASN from source.
+func (a *App) cacheSetPeers(source, asn string, peers *ASNPeers, ttl time.Duration) {
+	a.cache.Set(cacheKey(source, "peers", asn), peers, ttl)
+}
+
+// lookupPeers queries the BGPView API for the upstream providers of an ASN.
+func (a *App) lookupPeers(ctx context.Context, asn string) (*ASNPeers, error) {
+	peers, _, err := a.lookupPeersFresh(ctx, asn)
+	return peers, err
+}
+
+// lookupPeersFresh is like lookupPeers but also reports whether the
+// upstreams came from the cache.
+func (a *App) lookupPeersFresh(ctx context.Context, asn string) (*ASNPeers, Freshness, error) {
+	// Check cache first
+	if !cacheBypassed(ctx) {
+		if peers, age, found := a.cacheGetPeers(sourceBGPView, asn); found {
+			return peers, newFreshness(age), nil
+		}
+	}
+
+	bgpURL := fmt.Sprintf("%s/asn/%s/upstreams", a.cfg.BGPViewBase, asn)
+
+	resp, err := a.retryWithBackoff(ctx, func(ctx context.Context) (*http.Response, error) {
+		return a.httpGet(ctx, bgpURL)
+	}, 3, upstreamRetryBudget)
+
+	if err != nil {
+		return nil, Freshness{}, markError(ErrUpstreamUnavailable, fmt.Errorf("BGPView upstreams API request failed: %w", err))
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		if resp.StatusCode == 429 {
+			return nil, Freshness{}, markError(ErrRateLimited, fmt.Errorf("BGPView API rate limit exceeded for ASN %s upstreams", asn))
+		}
+		return nil, Freshness{}, statusError(resp.StatusCode, fmt.Errorf("BGPView upstreams API returned status %d for ASN %s", resp.StatusCode, asn))
+	}
+
+	var bgpUpstreams bgpViewUpstreamsData
+	if err := a.decodeJSON(resp, &bgpUpstreams); err != nil {
+		return nil, Freshness{}, fmt.Errorf("failed to parse BGPView upstreams response for %s: %w", asn, err)
+	}
+
+	peers := &ASNPeers{
+		IPv4Upstreams: convertPeers(bgpUpstreams.Data.IPv4Upstreams),
+		IPv6Upstreams: convertPeers(bgpUpstreams.Data.IPv6Upstreams),
+	}
+
+	// Cache the result for 1 hour
+	a.cacheSetPeers(sourceBGPView, asn, peers, 1*time.Hour)
+
+	return peers, Freshness{Source: "BGPView"}, nil
+}
+
+func convertPeers(in []bgpViewPeer) []Peer {
+	var out []Peer
+	for _, p := range in {
+		out = append(out, Peer{
+			ASN:         fmt.Sprintf("%d", p.ASN),
+			Name:        p.Name,
+			Description: p.Description,
+			CountryCode: p.CountryCode,
+		})
+	}
+	return out
+}
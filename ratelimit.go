@@ -0,0 +1,132 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// defaultRateLimitWait is how long BGPView is assumed to keep rate limiting
+// us when a 429 response doesn't say, with Retry-After.
+const defaultRateLimitWait = time.Minute
+
+// rateLimitTracker remembers when upstream last rate limited us and when it
+// said we may try again, so users can be told how long to wait.
+type rateLimitTracker struct {
+	mu    sync.Mutex
+	last  time.Time
+	until time.Time
+}
+
+// bgpViewRateLimit tracks BGPView's rate limiting.
+var bgpViewRateLimit = &rateLimitTracker{}
+
+// Record notes a 429 response, using its Retry-After header if present.
+func (t *rateLimitTracker) Record(resp *http.Response) {
+	now := time.Now()
+	wait, ok := parseRetryAfter(resp.Header.Get("Retry-After"), now)
+	if !ok {
+		wait = defaultRateLimitWait
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.last = now
+	t.until = now.Add(wait)
+}
+
+// RetryAfter returns how long until upstream said we may try again, or 0 if
+// we aren't currently rate limited.
+func (t *rateLimitTracker) RetryAfter() time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if wait := time.Until(t.until); wait > 0 {
+		return wait
+	}
+	return 0
+}
+
+// Last returns when upstream last rate limited us, or the zero time if it
+// never has.
+func (t *rateLimitTracker) Last() time.Time {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.last
+}
+
+// parseRetryAfter parses a Retry-After header, which is either a number of
+// seconds or an HTTP date.
+func parseRetryAfter(v string, now time.Time) (time.Duration, bool) {
+	if v == "" {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(v); err == nil && secs >= 0 {
+		return time.Duration(secs) * time.Second, true
+	}
+	if at, err := http.ParseTime(v); err == nil {
+		if wait := at.Sub(now); wait > 0 {
+			return wait, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+// retryAfterSeconds returns, for a lookup error caused by upstream rate
+// limiting, the whole number of seconds until it is worth trying again. It
+// returns 0 for other errors.
+func retryAfterSeconds(err error) int {
+	if !errors.Is(err, ErrRateLimited) {
+		return 0
+	}
+	wait := bgpViewRateLimit.RetryAfter()
+	if wait <= 0 {
+		return 0
+	}
+	return int((wait + time.Second - 1) / time.Second)
+}
+
+// setRetryAfter sets the Retry-After header for a lookup error caused by
+// upstream rate limiting.
+func setRetryAfter(w http.ResponseWriter, err error) {
+	if secs := retryAfterSeconds(err); secs > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(secs))
+	}
+}
+
+// healthStatus is the JSON served by /healthz.
+type healthStatus struct {
+	Status            string     `json:"status"` // "ok", or "degraded" while upstream is unusable
+	CircuitBreaker    string     `json:"circuit_breaker"`
+	RateLimited       bool       `json:"rate_limited"`
+	RetryAfterSeconds int        `json:"retry_after_seconds,omitempty"`
+	LastRateLimited   *time.Time `json:"last_rate_limited,omitempty"`
+}
+
+// healthHandler serves /healthz: whether this instance can currently reach
+// BGPView. Upstream trouble is reported but still answered with 200, since
+// restarting or removing this instance wouldn't help.
+func healthHandler(w http.ResponseWriter, r *http.Request) {
+	health := healthStatus{
+		Status:         "ok",
+		CircuitBreaker: bgpViewBreaker.State(),
+	}
+	if wait := bgpViewRateLimit.RetryAfter(); wait > 0 {
+		health.RateLimited = true
+		health.RetryAfterSeconds = int((wait + time.Second - 1) / time.Second)
+	}
+	if last := bgpViewRateLimit.Last(); !last.IsZero() {
+		last = last.UTC()
+		health.LastRateLimited = &last
+	}
+	if health.RateLimited || health.CircuitBreaker != "closed" {
+		health.Status = "degraded"
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(health)
+}
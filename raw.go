@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// maxRawResponseSize caps how much of an upstream response /raw/ will relay.
+const maxRawResponseSize = 1 << 20
+
+// cacheGetRawASN returns the cached raw ASN response from source, and its
+// age.
+func (a *App) cacheGetRawASN(source, asn string) (string, time.Duration, bool) {
+	return cacheGetAs[string](a.cache, cacheKey(source, "raw", asn))
+}
+
+// cacheSetRawASN caches the raw ASN response from source.
+func (a *App) cacheSetRawASN(source, asn, body string, ttl time.Duration) {
+	a.cache.Set(cacheKey(source, "raw", asn), body, ttl)
+}
+
+// lookupRawASN returns BGPView's ASN response for asn exactly as it was
+// sent, for clients that want fields ASNDetails doesn't model.
+func (a *App) lookupRawASN(ctx context.Context, asn string) (string, error) {
+	// Check cache first
+	if !cacheBypassed(ctx) {
+		if body, _, found := a.cacheGetRawASN(sourceBGPView, asn); found {
+			return body, nil
+		}
+	}
+
+	// Collapse concurrent lookups of the same ASN into one upstream call
+	v, err := a.lookups.Do(ctx, cacheKey(sourceBGPView, "raw", asn), func(ctx context.Context) (interface{}, error) {
+		return a.fetchRawASN(ctx, asn)
+	})
+	if err != nil {
+		return "", err
+	}
+	return v.(string), nil
+}
+
+// fetchRawASN fetches the raw ASN response from BGPView and caches it.
+func (a *App) fetchRawASN(ctx context.Context, asn string) (string, error) {
+	bgpURL := fmt.Sprintf("%s/asn/%s", a.cfg.BGPViewBase, asn)
+
+	resp, err := a.retryWithBackoff(ctx, func(ctx context.Context) (*http.Response, error) {
+		return a.httpGet(ctx, bgpURL)
+	}, 3, upstreamRetryBudget)
+
+	if err != nil {
+		return "", markError(ErrUpstreamUnavailable, fmt.Errorf("BGPView ASN API request failed: %w", err))
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		if resp.StatusCode == 429 {
+			return "", markError(ErrRateLimited, fmt.Errorf("BGPView API rate limit exceeded for ASN %s", asn))
+		}
+		return "", statusError(resp.StatusCode, fmt.Errorf("BGPView ASN API returned status %d for ASN %s", resp.StatusCode, asn))
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxRawResponseSize+1))
+	if err != nil {
+		return "", markError(ErrUpstreamUnavailable, fmt.Errorf("failed to read BGPView ASN response for %s: %w", asn, err))
+	}
+	if len(body) > maxRawResponseSize {
+		return "", fmt.Errorf("BGPView ASN response for %s is too large to relay", asn)
+	}
+	if !json.Valid(body) {
+		return "", fmt.Errorf("BGPView returned invalid JSON for ASN %s", asn)
+	}
+
+	// Cache the result for 2 hours, like the parsed details
+	a.cacheSetRawASN(sourceBGPView, asn, string(body), 2*time.Hour)
+
+	return string(body), nil
+}
+
+// rawASNHandler serves /raw/asn/{asn}: BGPView's ASN response passed
+// through unmodified, but subject to our caching and upstream limits.
+func (a *App) rawASNHandler(w http.ResponseWriter, r *http.Request) {
+	asn, err := normalizeASN(r.PathValue("asn"))
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, codeInvalidInput, err)
+		return
+	}
+	if err := a.checkASNPermitted(asn); err != nil {
+		writeAPIError(w, http.StatusForbidden, codeInvalidInput, err)
+		return
+	}
+	if err := checkRoutableASN(asn); err != nil {
+		writeAPIError(w, http.StatusUnprocessableEntity, codeInvalidInput, err)
+		return
+	}
+
+	ctx, _, _ := a.refreshContext(w, r)
+	body, err := a.lookupRawASN(ctx, asn)
+	if err != nil {
+		writeLookupAPIError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	io.WriteString(w, body)
+}
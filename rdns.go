@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/netip"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxReverseDNSChecks is how many prefixes of a lookup are checked for
+// reverse DNS delegation, as each takes a few DNS queries. The first ones,
+// which are listed without the "show all" toggle, are checked.
+const maxReverseDNSChecks = 20
+
+// reverseDNSConcurrency is how many prefixes of one lookup are checked at
+// once.
+const reverseDNSConcurrency = 5
+
+// minReverseDNSZoneBits is the shortest prefix whose ip6.arpa zone is taken
+// as the network's own delegation. Shorter zones are the RIRs' and IANA's,
+// which have NS records whether or not the network delegated its space.
+const minReverseDNSZoneBits = 20
+
+// Reverse DNS delegation statuses of a prefix.
+const (
+	reverseDNSDelegated = "delegated"
+	reverseDNSMissing   = "missing"
+)
+
+// annotateReverseDNS sets the ReverseDNS status of the first
+// maxReverseDNSChecks prefixes and returns how many of them were checked and
+// how many lack a delegation. Prefixes whose delegation can't be checked are
+// left unannotated.
+func (a *App) annotateReverseDNS(ctx context.Context, prefixes []GeoPrefix) (checked, missing int) {
+	slots := make(chan struct{}, reverseDNSConcurrency)
+	var wg sync.WaitGroup
+	for i := range prefixes[:min(len(prefixes), maxReverseDNSChecks)] {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			slots <- struct{}{}
+			defer func() { <-slots }()
+			status, err := a.lookupReverseDNS(ctx, prefixes[i].Prefix)
+			if err != nil {
+				a.logDebugf("Reverse DNS check of %s failed: %v", prefixes[i].Prefix, err)
+				return
+			}
+			prefixes[i].ReverseDNS = status
+		}()
+	}
+	wg.Wait()
+
+	for _, p := range prefixes {
+		switch p.ReverseDNS {
+		case reverseDNSMissing:
+			missing++
+			fallthrough
+		case reverseDNSDelegated:
+			checked++
+		}
+	}
+	return checked, missing
+}
+
+// lookupReverseDNS returns the reverse DNS delegation status of prefix,
+// cached for an hour.
+func (a *App) lookupReverseDNS(ctx context.Context, prefix string) (string, error) {
+	key := cacheKey("dns", "rdns", prefix)
+	if !cacheBypassed(ctx) {
+		if status, _, found := cacheGetAs[string](a.cache, key); found {
+			return status, nil
+		}
+	}
+
+	v, err := a.lookups.Do(ctx, key, func(ctx context.Context) (interface{}, error) {
+		status, err := checkReverseDNS(ctx, prefix)
+		if err != nil {
+			return nil, err
+		}
+		a.cache.Set(key, status, time.Hour)
+		return status, nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return v.(string), nil
+}
+
+// checkReverseDNS looks for NS records on the ip6.arpa zone of prefix. A
+// prefix that doesn't end on a nibble boundary is checked at the next one, as
+// such zones can only be delegated in nibbles. Networks often delegate their
+// whole allocation rather than each announced prefix, so if the prefix's own
+// zone has no NS records, those of less specific prefixes down to
+// minReverseDNSZoneBits are tried.
+func checkReverseDNS(ctx context.Context, prefix string) (string, error) {
+	p, err := netip.ParsePrefix(prefix)
+	if err != nil {
+		return "", err
+	}
+	if !p.Addr().Is6() {
+		return "", errors.New("not an IPv6 prefix")
+	}
+	for bits := min((p.Bits()+3)/4*4, 128); bits >= minReverseDNSZoneBits; bits -= 4 {
+		ns, err := resolver.LookupNS(ctx, reverseDNSZone(p.Addr(), bits))
+		if err != nil {
+			var dnsErr *net.DNSError
+			if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+				continue
+			}
+			return "", err
+		}
+		if len(ns) > 0 {
+			return reverseDNSDelegated, nil
+		}
+	}
+	return reverseDNSMissing, nil
+}
+
+// reverseDNSZone returns the ip6.arpa zone of the first bits of addr, which
+// must be a multiple of 4: "8.b.d.0.1.0.0.2.ip6.arpa." for 2001:db8::/32.
+func reverseDNSZone(addr netip.Addr, bits int) string {
+	const hexDigits = "0123456789abcdef"
+	a := addr.As16()
+	var b strings.Builder
+	for i := bits/4 - 1; i >= 0; i-- {
+		nibble := a[i/2] >> 4
+		if i%2 == 1 {
+			nibble = a[i/2] & 0x0f
+		}
+		b.WriteByte(hexDigits[nibble])
+		b.WriteByte('.')
+	}
+	b.WriteString("ip6.arpa.")
+	return b.String()
+}
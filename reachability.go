@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"time"
+)
+
+// pingTimeout bounds how long to wait for an echo reply.
+const pingTimeout = 3 * time.Second
+
+// pingInterval is how often one client may ask for a reachability check.
+const pingInterval = 5 * time.Second
+
+const (
+	icmpv6EchoRequest = 128
+	icmpv6EchoReply   = 129
+)
+
+// reachabilityResult is the JSON response of the /reachability endpoint.
+type reachabilityResult struct {
+	Prefix    string  `json:"prefix"`
+	Target    string  `json:"target"`
+	Reachable bool    `json:"reachable"`
+	RTTMillis float64 `json:"rtt_ms,omitempty"`
+	Error     string  `json:"error,omitempty"`
+}
+
+// pingTarget picks the address to probe in prefix: the first address after
+// the (subnet-router anycast) network address, which is where a router is
+// most commonly found.
+func pingTarget(prefix netip.Prefix) netip.Addr {
+	addr := prefix.Masked().Addr()
+	if next := addr.Next(); next.IsValid() && prefix.Contains(next) {
+		return next
+	}
+	return addr
+}
+
+// ping6 sends a single ICMPv6 echo request to addr and waits for the reply,
+// returning the round-trip time.
+func ping6(ctx context.Context, addr netip.Addr) (time.Duration, error) {
+	conn, err := net.ListenPacket("ip6:ipv6-icmp", "::")
+	if err != nil {
+		return 0, fmt.Errorf("failed to open ICMPv6 socket (are we privileged?): %w", err)
+	}
+	defer conn.Close()
+
+	deadline := time.Now().Add(pingTimeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	conn.SetDeadline(deadline)
+
+	// Echo request: type, code, checksum (filled in by the kernel for
+	// ICMPv6 raw sockets), identifier, sequence number, payload
+	id := uint16(rand.Intn(0xffff))
+	msg := make([]byte, 8, 16)
+	msg[0] = icmpv6EchoRequest
+	binary.BigEndian.PutUint16(msg[4:], id)
+	binary.BigEndian.PutUint16(msg[6:], 1)
+	msg = append(msg, []byte("ipv6req!")...)
+
+	dst := &net.IPAddr{IP: addr.AsSlice()}
+	start := time.Now()
+	if _, err := conn.WriteTo(msg, dst); err != nil {
+		return 0, fmt.Errorf("failed to send echo request: %w", err)
+	}
+
+	buf := make([]byte, 1500)
+	for {
+		n, from, err := conn.ReadFrom(buf)
+		if err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				return 0, errors.New("no reply before timeout")
+			}
+			return 0, fmt.Errorf("failed to read reply: %w", err)
+		}
+
+		// Skip anything that isn't our reply from the target
+		fromAddr, ok := from.(*net.IPAddr)
+		if !ok || !fromAddr.IP.Equal(dst.IP) || n < 8 {
+			continue
+		}
+		if buf[0] == icmpv6EchoReply && binary.BigEndian.Uint16(buf[4:]) == id {
+			return time.Since(start), nil
+		}
+	}
+}
+
+// announces reports whether prefix is among the announced prefixes.
+func announces(announced []string, prefix netip.Prefix) bool {
+	for _, p := range announced {
+		if q, err := netip.ParsePrefix(p); err == nil && q.Masked() == prefix {
+			return true
+		}
+	}
+	return false
+}
+
+// reachabilityHandler pings the first address of an IPv6 prefix given as
+// ?prefix= and reports whether it answered. Only a public prefix announced
+// by the ASN given as ?asn= is pinged, so that the server can't be used to
+// probe arbitrary networks, and each client may ask once per pingInterval.
+func (a *App) reachabilityHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	fail := func(status int, result reachabilityResult, err error) {
+		result.Error = err.Error()
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(result)
+	}
+
+	raw := r.URL.Query().Get("prefix")
+	prefix, err := netip.ParsePrefix(raw)
+	if err != nil || !prefix.Addr().Is6() || prefix.Addr().Is4In6() {
+		fail(http.StatusBadRequest, reachabilityResult{Prefix: raw}, errors.New("prefix must be an IPv6 prefix such as 2001:db8::/32"))
+		return
+	}
+	prefix = prefix.Masked()
+	target := pingTarget(prefix)
+	result := reachabilityResult{Prefix: prefix.String(), Target: target.String()}
+	if isNonPublicIP(target.String()) {
+		fail(http.StatusBadRequest, result, errors.New("prefix is not publicly routed"))
+		return
+	}
+
+	asn, err := normalizeASN(r.URL.Query().Get("asn"))
+	if err != nil {
+		fail(http.StatusBadRequest, result, err)
+		return
+	}
+	if err := a.checkASNPermitted(asn); err != nil {
+		fail(http.StatusForbidden, result, err)
+		return
+	}
+	if wait, ok := a.pings.Allow(a.clientAddr(r)); !ok {
+		secs := int((wait + time.Second - 1) / time.Second)
+		w.Header().Set("Retry-After", strconv.Itoa(secs))
+		fail(http.StatusTooManyRequests, result, fmt.Errorf("too many reachability checks; try again in %d seconds", secs))
+		return
+	}
+
+	announced, err := a.lookupIPv6(r.Context(), asn)
+	if err != nil {
+		fail(lookupErrorStatus(err), result, err)
+		return
+	}
+	if !announces(announced, prefix) {
+		fail(http.StatusForbidden, result, fmt.Errorf("AS%s does not announce %s", asn, prefix))
+		return
+	}
+
+	rtt, err := ping6(r.Context(), target)
+	if err != nil {
+		result.Error = err.Error()
+	} else {
+		result.Reachable = true
+		result.RTTMillis = float64(rtt.Microseconds()) / 1000
+	}
+
+	json.NewEncoder(w).Encode(result)
+}
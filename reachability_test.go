@@ -0,0 +1,72 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+func TestReachabilityRefusesUnannouncedPrefixes(t *testing.T) {
+	tests := []struct {
+		name   string
+		query  string
+		status int
+		hits   int32
+	}{
+		{"not announced", "?asn=19625&prefix=2001:db8:ffff::/48", http.StatusForbidden, 1},
+		{"announced by another ASN", "?asn=13335&prefix=2001:db8::/32", http.StatusForbidden, 1},
+		{"unique local", "?asn=19625&prefix=fd00::/8", http.StatusBadRequest, 0},
+		{"link-local", "?asn=19625&prefix=fe80::/64", http.StatusBadRequest, 0},
+		{"IPv4", "?asn=19625&prefix=192.0.2.0/24", http.StatusBadRequest, 0},
+		{"no ASN", "?prefix=2001:db8::/32", http.StatusBadRequest, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var hits atomic.Int32
+			stub := bgpViewStub(map[string]string{
+				"/asn/19625/prefixes": bgpViewPrefixes19625,
+				"/asn/13335/prefixes": `{"status":"ok","data":{"ipv4_prefixes":[],"ipv6_prefixes":[{"prefix":"2001:db8:13::/48"}]}}`,
+			})
+			a := newTestApp(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				hits.Add(1)
+				stub.ServeHTTP(w, r)
+			}), "-enable-ping")
+
+			w := httptest.NewRecorder()
+			a.newRouter().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/reachability"+tt.query, nil))
+
+			if w.Code != tt.status {
+				t.Errorf("status = %d, want %d; body: %s", w.Code, tt.status, w.Body)
+			}
+			if got := hits.Load(); got != tt.hits {
+				t.Errorf("%d upstream requests, want %d", got, tt.hits)
+			}
+		})
+	}
+}
+
+func TestReachabilityRateLimited(t *testing.T) {
+	a := newTestApp(t, bgpViewStub(map[string]string{
+		"/asn/19625/prefixes": bgpViewPrefixes19625,
+	}), "-enable-ping")
+	router := a.newRouter()
+
+	check := func(remoteAddr string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/reachability?asn=19625&prefix=2001:db8:ffff::/48", nil)
+		r.RemoteAddr = remoteAddr
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		return w
+	}
+	if w := check("192.0.2.1:1234"); w.Code != http.StatusForbidden {
+		t.Fatalf("first check: status = %d, want %d", w.Code, http.StatusForbidden)
+	}
+	w := check("192.0.2.1:5678")
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") == "" {
+		t.Errorf("repeated check: status = %d, Retry-After %q; want %d with Retry-After", w.Code, w.Header().Get("Retry-After"), http.StatusTooManyRequests)
+	}
+	if w := check("198.51.100.1:1234"); w.Code != http.StatusForbidden {
+		t.Errorf("another client's check: status = %d, want %d", w.Code, http.StatusForbidden)
+	}
+}
@@ -0,0 +1,293 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// redisKeyPrefix is prepended to every key written to Redis so that the
+// cache can share a database with other applications.
+const redisKeyPrefix = "ipv6request:"
+
+// redisTimeout bounds a single round trip to the Redis server. A slow or
+// unreachable cache is treated as a miss rather than holding up lookups.
+const redisTimeout = 500 * time.Millisecond
+
+// errRedisNil is returned for a RESP null reply, i.e. a missing key.
+var errRedisNil = errors.New("redis: nil reply")
+
+// redisEntry is the JSON envelope a value is stored in, recording when it
+// was stored so its age can be reported.
+type redisEntry struct {
+	StoredAt int64           `json:"stored_at"` // Unix milliseconds
+	Value    json.RawMessage `json:"value"`
+}
+
+// RedisCache is a CacheBackend that stores JSON-encoded values in Redis,
+// letting several instances behind a load balancer share lookups. It speaks
+// just enough of the RESP protocol for GET and SET over one connection,
+// which is re-dialled whenever a command fails.
+type RedisCache struct {
+	addr          string
+	cacheCounters // Redis expires entries itself, so evictions stay 0
+
+	mu   sync.Mutex
+	conn net.Conn
+	rw   *bufio.ReadWriter
+}
+
+// newRedisCache returns a RedisCache for the server at addr and checks that
+// it answers a PING.
+func newRedisCache(addr string) (*RedisCache, error) {
+	c := &RedisCache{addr: addr}
+	reply, err := c.do("PING")
+	if err != nil {
+		return nil, err
+	}
+	if reply != "PONG" {
+		return nil, fmt.Errorf("redis: unexpected PING reply %q", reply)
+	}
+	return c, nil
+}
+
+// Get returns the raw JSON stored under key as a json.RawMessage, and its
+// age.
+func (c *RedisCache) Get(key string) (interface{}, time.Duration, bool) {
+	reply, err := c.do("GET", redisKeyPrefix+key)
+	if err != nil {
+		if !errors.Is(err, errRedisNil) {
+			log.Printf("Redis GET %s failed: %v", key, err)
+		}
+		c.misses.Add(1)
+		return nil, 0, false
+	}
+	s, ok := reply.(string)
+	if !ok {
+		c.misses.Add(1)
+		return nil, 0, false
+	}
+	var entry redisEntry
+	if err := json.Unmarshal([]byte(s), &entry); err != nil {
+		log.Printf("Discarding undecodable Redis entry %s: %v", key, err)
+		c.misses.Add(1)
+		return nil, 0, false
+	}
+	c.hits.Add(1)
+	return entry.Value, time.Since(time.UnixMilli(entry.StoredAt)), true
+}
+
+// Set stores value under key as JSON, with the time it was stored, expiring
+// after ttl.
+func (c *RedisCache) Set(key string, value interface{}, ttl time.Duration) {
+	raw, err := json.Marshal(value)
+	if err != nil {
+		log.Printf("Not caching %s: %v", key, err)
+		return
+	}
+	data, err := json.Marshal(redisEntry{StoredAt: time.Now().UnixMilli(), Value: raw})
+	if err != nil {
+		log.Printf("Not caching %s: %v", key, err)
+		return
+	}
+	ms := ttl.Milliseconds()
+	if ms < 1 {
+		ms = 1
+	}
+	if _, err := c.do("SET", redisKeyPrefix+key, string(data), "PX", strconv.FormatInt(ms, 10)); err != nil {
+		log.Printf("Redis SET %s failed: %v", key, err)
+		return
+	}
+	c.sets.Add(1)
+}
+
+// redisScanCount is the number of keys asked for per SCAN call.
+const redisScanCount = "500"
+
+// Keys returns the keys stored by this application, found with SCAN so that
+// a large database isn't blocked as it would be by KEYS.
+func (c *RedisCache) Keys() []string {
+	var keys []string
+	cursor := "0"
+	for {
+		reply, err := c.do("SCAN", cursor, "MATCH", redisKeyPrefix+"*", "COUNT", redisScanCount)
+		if err != nil {
+			log.Printf("Redis SCAN failed: %v", err)
+			return keys
+		}
+		parts, ok := reply.([]interface{})
+		if !ok || len(parts) != 2 {
+			log.Printf("Redis SCAN returned an unexpected reply")
+			return keys
+		}
+		cursor, _ = parts[0].(string)
+		batch, _ := parts[1].([]interface{})
+		for _, item := range batch {
+			if key, ok := item.(string); ok {
+				keys = append(keys, strings.TrimPrefix(key, redisKeyPrefix))
+			}
+		}
+		if cursor == "0" || cursor == "" {
+			return keys
+		}
+	}
+}
+
+// TTL returns the remaining time to live of key, as reported by PTTL.
+func (c *RedisCache) TTL(key string) (time.Duration, bool) {
+	reply, err := c.do("PTTL", redisKeyPrefix+key)
+	if err != nil {
+		log.Printf("Redis PTTL %s failed: %v", key, err)
+		return 0, false
+	}
+	ms, ok := reply.(int64)
+	if !ok || ms < 0 {
+		return 0, false
+	}
+	return time.Duration(ms) * time.Millisecond, true
+}
+
+func (c *RedisCache) Len() int {
+	return len(c.Keys())
+}
+
+// Flush deletes every key stored by this application, leaving other data
+// in the database alone.
+func (c *RedisCache) Flush() {
+	keys := c.Keys()
+	for len(keys) > 0 {
+		n := min(len(keys), 500)
+		args := []string{"DEL"}
+		for _, key := range keys[:n] {
+			args = append(args, redisKeyPrefix+key)
+		}
+		if _, err := c.do(args...); err != nil {
+			log.Printf("Redis DEL failed: %v", err)
+			return
+		}
+		keys = keys[n:]
+	}
+}
+
+// do sends a command and reads its reply, dialling the server if there is
+// no open connection. A connection that fails mid-command is discarded.
+func (c *RedisCache) do(args ...string) (interface{}, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.conn == nil {
+		conn, err := net.DialTimeout("tcp", c.addr, redisTimeout)
+		if err != nil {
+			return nil, err
+		}
+		c.conn = conn
+		c.rw = bufio.NewReadWriter(bufio.NewReader(conn), bufio.NewWriter(conn))
+	}
+
+	reply, err := c.roundTrip(args)
+	if err != nil && !errors.Is(err, errRedisNil) && !isRedisError(err) {
+		c.conn.Close()
+		c.conn, c.rw = nil, nil
+	}
+	return reply, err
+}
+
+func (c *RedisCache) roundTrip(args []string) (interface{}, error) {
+	c.conn.SetDeadline(time.Now().Add(redisTimeout))
+
+	fmt.Fprintf(c.rw, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(c.rw, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	if err := c.rw.Flush(); err != nil {
+		return nil, err
+	}
+	return readRedisReply(c.rw.Reader)
+}
+
+// redisError is an error reply sent by the server. It leaves the
+// connection usable.
+type redisError string
+
+func (e redisError) Error() string { return "redis: " + string(e) }
+
+func isRedisError(err error) bool {
+	var re redisError
+	return errors.As(err, &re)
+}
+
+// readRedisReply parses one RESP reply. Simple and bulk strings are returned
+// as strings, integers as int64 and arrays as []interface{}.
+func readRedisReply(r *bufio.Reader) (interface{}, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 || line[len(line)-2] != '\r' {
+		return nil, fmt.Errorf("redis: malformed reply %q", line)
+	}
+	kind, body := line[0], line[1:len(line)-2]
+
+	switch kind {
+	case '+':
+		return body, nil
+	case '-':
+		return nil, redisError(body)
+	case ':':
+		return strconv.ParseInt(body, 10, 64)
+	case '$':
+		n, err := strconv.Atoi(body)
+		if err != nil {
+			return nil, fmt.Errorf("redis: bad bulk length %q", body)
+		}
+		if n < 0 {
+			return nil, errRedisNil
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		return string(buf[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(body)
+		if err != nil {
+			return nil, fmt.Errorf("redis: bad array length %q", body)
+		}
+		if n < 0 {
+			return nil, errRedisNil
+		}
+		items := make([]interface{}, n)
+		for i := range items {
+			item, err := readRedisReply(r)
+			if err != nil && !errors.Is(err, errRedisNil) {
+				return nil, err
+			}
+			items[i] = item
+		}
+		return items, nil
+	}
+	return nil, fmt.Errorf("redis: unknown reply type %q", kind)
+}
+
+// newCacheBackend returns the cache implementation named by backend.
+func newCacheBackend(backend, redisAddr string) (CacheBackend, error) {
+	switch backend {
+	case "", "memory":
+		return newCache(), nil
+	case "redis":
+		c, err := newRedisCache(redisAddr)
+		if err != nil {
+			return nil, fmt.Errorf("connecting to Redis at %s: %w", redisAddr, err)
+		}
+		return c, nil
+	}
+	return nil, fmt.Errorf("unknown cache backend %q (want memory or redis)", backend)
+}
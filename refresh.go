@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// refreshInterval is how often one client may force fresh lookups that
+// bypass the cache.
+const refreshInterval = time.Minute
+
+type bypassCacheKey struct{}
+
+// withCacheBypass returns a context under which lookups skip the cache and
+// always ask upstream. Their results are still cached.
+func withCacheBypass(ctx context.Context) context.Context {
+	return context.WithValue(ctx, bypassCacheKey{}, true)
+}
+
+// cacheBypassed reports whether lookups under ctx should skip the cache.
+func cacheBypassed(ctx context.Context) bool {
+	bypass, _ := ctx.Value(bypassCacheKey{}).(bool)
+	return bypass
+}
+
+// refreshLimiter allows each client one forced refresh per interval.
+type refreshLimiter struct {
+	interval time.Duration
+
+	mu     sync.Mutex
+	last   map[string]time.Time
+	pruned time.Time // when clients were last forgotten
+}
+
+// Allow reports whether client may refresh now and records it if so.
+// Otherwise it returns how long the client has to wait.
+func (l *refreshLimiter) Allow(client string) (time.Duration, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	if l.last == nil {
+		l.last = make(map[string]time.Time)
+	}
+	if last, ok := l.last[client]; ok {
+		if wait := l.interval - now.Sub(last); wait > 0 {
+			return wait, false
+		}
+	}
+
+	// Forget clients whose interval has passed, once per interval, so the
+	// map only holds the clients of the last two intervals
+	if now.Sub(l.pruned) >= l.interval {
+		for c, last := range l.last {
+			if now.Sub(last) >= l.interval {
+				delete(l.last, c)
+			}
+		}
+		l.pruned = now
+	}
+	l.last[client] = now
+	return 0, true
+}
+
+// refreshContext returns the context lookups for r should use. When r asks
+// for ?refresh=1 and its client, as told by clientAddr, hasn't refreshed
+// within refreshInterval, the context bypasses the cache and refreshed is
+// true; otherwise wait is how long the client must wait to refresh. The
+// outcome is reported in the X-Refresh response header.
+func (a *App) refreshContext(w http.ResponseWriter, r *http.Request) (ctx context.Context, refreshed bool, wait time.Duration) {
+	ctx = r.Context()
+	if r.FormValue("refresh") != "1" {
+		return ctx, false, 0
+	}
+	wait, ok := a.refreshes.Allow(a.clientAddr(r))
+	if !ok {
+		w.Header().Set("X-Refresh", "limited")
+		return ctx, false, wait
+	}
+	w.Header().Set("X-Refresh", "fresh")
+	return withCacheBypass(ctx), true, 0
+}
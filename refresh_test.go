@@ -0,0 +1,52 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientAddr(t *testing.T) {
+	a := newTestApp(t, http.NotFoundHandler(), "-trusted-proxies", "10.0.0.1, 2001:db8:ffff::/48")
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		xff        []string
+		want       string
+	}{
+		{"direct", "198.51.100.7:4242", nil, "198.51.100.7"},
+		{"spoofed header", "198.51.100.7:4242", []string{"203.0.113.9"}, "198.51.100.7"},
+		{"trusted proxy", "10.0.0.1:4242", []string{"203.0.113.9"}, "203.0.113.9"},
+		{"client-supplied hop", "10.0.0.1:4242", []string{"192.0.2.1, 203.0.113.9"}, "203.0.113.9"},
+		{"chained proxies", "[2001:db8:ffff::2]:4242", []string{"203.0.113.9", "10.0.0.1"}, "203.0.113.9"},
+		{"only proxies", "10.0.0.1:4242", []string{"10.0.0.1"}, "10.0.0.1"},
+		{"garbage hop", "10.0.0.1:4242", []string{"203.0.113.9, unknown"}, "10.0.0.1"},
+		{"no header", "10.0.0.1:4242", nil, "10.0.0.1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.RemoteAddr = tt.remoteAddr
+			for _, xff := range tt.xff {
+				r.Header.Add("X-Forwarded-For", xff)
+			}
+			if got := a.clientAddr(r); got != tt.want {
+				t.Errorf("clientAddr = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRefreshLimitIgnoresSpoofedHeaders(t *testing.T) {
+	a := newTestApp(t, http.NotFoundHandler())
+
+	for i, xff := range []string{"203.0.113.1", "203.0.113.2"} {
+		r := httptest.NewRequest(http.MethodGet, "/?refresh=1", nil)
+		r.Header.Set("X-Forwarded-For", xff)
+		_, refreshed, _ := a.refreshContext(httptest.NewRecorder(), r)
+		if want := i == 0; refreshed != want {
+			t.Errorf("refresh %d with X-Forwarded-For %s: refreshed = %v, want %v", i+1, xff, refreshed, want)
+		}
+	}
+}
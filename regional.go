@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// sourceRegional is the cache namespace for data from a regionalSource.
+const sourceRegional = "regional"
+
+// regionalSource is the PrefixLookup used with -rir-sources. It looks up
+// each ASN in the sources configured for the RIR that assigned it, in order,
+// falling back to the next when one fails, so that lookups prefer the most
+// authoritative source for the ASN's region. ASNs of other RIRs, and those
+// whose RIR can't be told, are looked up in -source alone.
+type regionalSource struct {
+	app   *App
+	def   PrefixLookup
+	byRIR map[string][]PrefixLookup
+	// others are the sources other than def, in the order first listed
+	others []PrefixLookup
+}
+
+func (*regionalSource) Name() string { return sourceRegional }
+
+// Label lists the sources lookups may be answered by, like "BGPView or
+// RIPEstat".
+func (s *regionalSource) Label() string {
+	labels := []string{s.def.Label()}
+	for _, source := range s.others {
+		labels = append(labels, source.Label())
+	}
+	if len(labels) == 1 {
+		return labels[0]
+	}
+	return strings.Join(labels[:len(labels)-1], ", ") + " or " + labels[len(labels)-1]
+}
+
+// newRegionalSource returns the regionalSource for spec, the value of
+// -rir-sources: entries like "RIPE=ripestat,bgpview" separated by
+// semicolons, naming an RIR as BGPView does and the sources to try for its
+// ASNs. sources holds the sources already created, by name.
+func (a *App) newRegionalSource(def PrefixLookup, spec string, sources map[string]PrefixLookup) (*regionalSource, error) {
+	s := &regionalSource{app: a, def: def, byRIR: make(map[string][]PrefixLookup)}
+	for _, entry := range strings.Split(spec, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		rir, names, ok := strings.Cut(entry, "=")
+		rir = strings.ToUpper(strings.TrimSpace(rir))
+		if !ok {
+			return nil, fmt.Errorf("%q is not like RIPE=ripestat,bgpview", entry)
+		}
+		if _, known := rirWhoisServers[rir]; !known {
+			return nil, fmt.Errorf("unknown RIR %q (want ARIN, RIPE, APNIC, LACNIC or AFRINIC)", rir)
+		}
+		if _, dup := s.byRIR[rir]; dup {
+			return nil, fmt.Errorf("%s is listed twice", rir)
+		}
+		for _, name := range strings.Split(names, ",") {
+			name = strings.TrimSpace(name)
+			_, existed := sources[name]
+			source, err := a.newSource(name, sources)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", rir, err)
+			}
+			if !existed {
+				s.others = append(s.others, source)
+			}
+			s.byRIR[rir] = append(s.byRIR[rir], source)
+		}
+	}
+	if len(s.byRIR) == 0 {
+		return nil, errors.New("no RIRs listed")
+	}
+	return s, nil
+}
+
+// sourcesFor returns the sources to look asn up in, in order. The RIR is
+// taken from the ASN's details, which are normally cached by the time its
+// prefixes are looked up.
+func (s *regionalSource) sourcesFor(ctx context.Context, asn string) []PrefixLookup {
+	details, err := s.app.lookupASNDetails(ctx, asn)
+	if err == nil {
+		if sources, ok := s.byRIR[strings.ToUpper(details.RIRAllocation)]; ok {
+			return sources
+		}
+	}
+	return []PrefixLookup{s.def}
+}
+
+// FetchPrefixes returns the prefixes asn announces, according to the first
+// of its region's sources that answers, which is named in their Source. If
+// none does, the first source's error is returned.
+func (s *regionalSource) FetchPrefixes(ctx context.Context, asn string) (allPrefixes, error) {
+	var firstErr error
+	for _, source := range s.sourcesFor(ctx, asn) {
+		all, err := source.FetchPrefixes(ctx, asn)
+		if err == nil {
+			all.Source = source.Label()
+			return all, nil
+		}
+		s.app.logInfof("Prefix lookup of ASN %s in %s failed: %v", asn, source.Name(), err)
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+	return allPrefixes{}, firstErr
+}
+
+// FetchASNDetails returns the details of asn from -source, whose RIR then
+// selects the sources its prefixes are looked up in. If -source fails, the
+// other sources are tried in the order they were listed, as the RIR isn't
+// known yet. The details' Source names the source that answered.
+func (s *regionalSource) FetchASNDetails(ctx context.Context, asn string) (*ASNDetails, error) {
+	details, firstErr := s.def.FetchASNDetails(ctx, asn)
+	if firstErr == nil {
+		details.Source = s.def.Label()
+		return details, nil
+	}
+	for _, source := range s.others {
+		if details, err := source.FetchASNDetails(ctx, asn); err == nil {
+			details.Source = source.Label()
+			return details, nil
+		}
+	}
+	return nil, firstErr
+}
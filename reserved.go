@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"net/netip"
+	"strconv"
+)
+
+// asnRange is a block of AS numbers set aside by IANA that never appears in
+// the global routing table.
+type asnRange struct {
+	First, Last uint32
+	Purpose     string
+	Reference   string
+}
+
+// reservedASNs lists the special-purpose AS numbers from the IANA registry.
+// BGPView knows nothing about them, which would otherwise read as "no IPv6".
+var reservedASNs = []asnRange{
+	{0, 0, "reserved", "RFC 7607"},
+	{23456, 23456, "AS_TRANS, a placeholder for 4-byte ASNs", "RFC 6793"},
+	{64496, 64511, "reserved for documentation and sample code", "RFC 5398"},
+	{64512, 65534, "reserved for private use", "RFC 6996"},
+	{65535, 65535, "reserved", "RFC 7300"},
+	{65536, 65551, "reserved for documentation and sample code", "RFC 5398"},
+	{65552, 131071, "reserved", "IANA"},
+	{4200000000, 4294967294, "reserved for private use", "RFC 6996"},
+	{4294967295, 4294967295, "reserved", "RFC 7300"},
+}
+
+// reservedPrefixes lists the special-purpose address blocks from the IANA
+// registries that netip.Addr has no predicate for. Clients in them are
+// behind a NAT or proxy, and BGPView can't map them to an ASN either.
+var reservedPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("100.64.0.0/10"), // shared address space for carrier-grade NAT, RFC 6598
+}
+
+// ReservedASNError reports that an ASN falls in a special-purpose range and
+// so has no globally routed prefixes to look up.
+type ReservedASNError struct {
+	ASN   string
+	Range asnRange
+}
+
+func (e *ReservedASNError) Error() string {
+	return fmt.Sprintf("AS%s is %s (%s) and is not routed on the public Internet, so it has no prefixes to look up",
+		e.ASN, e.Range.Purpose, e.Range.Reference)
+}
+
+// checkRoutableASN returns a *ReservedASNError if asn, in asplain form, is a
+// private, documentation or otherwise reserved AS number.
+func checkRoutableASN(asn string) error {
+	n, err := strconv.ParseUint(asn, 10, 32)
+	if err != nil {
+		return nil
+	}
+	for _, r := range reservedASNs {
+		if uint32(n) >= r.First && uint32(n) <= r.Last {
+			return &ReservedASNError{ASN: asn, Range: r}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// sourceRIPEstat is the -source and cache namespace for data from the
+// RIPEstat API.
+const sourceRIPEstat = "ripestat"
+
+// defaultRIPEstatBase is where the RIPEstat API is reached unless
+// -ripestat-base names another.
+const defaultRIPEstatBase = "https://stat.ripe.net"
+
+// ripeStatPrefixesData is the RIPEstat announced-prefixes API response.
+type ripeStatPrefixesData struct {
+	Data struct {
+		Prefixes []struct {
+			Prefix string `json:"prefix"`
+		} `json:"prefixes"`
+	} `json:"data"`
+}
+
+// ripeStatOverviewData is the RIPEstat as-overview API response.
+type ripeStatOverviewData struct {
+	Data struct {
+		Holder string `json:"holder"`
+		Block  struct {
+			Desc string `json:"desc"` // like "Assigned by RIPE NCC"
+		} `json:"block"`
+	} `json:"data"`
+}
+
+// ripeStatRIRs maps the registries named in as-overview's block descriptions
+// to the RIR names used by BGPView.
+var ripeStatRIRs = map[string]string{
+	"RIPE NCC": "RIPE",
+	"ARIN":     "ARIN",
+	"APNIC":    "APNIC",
+	"LACNIC":   "LACNIC",
+	"AFRINIC":  "AFRINIC",
+}
+
+// ripeStatSource is the PrefixLookup backed by RIPEstat, which sees the
+// routing table through the RIPE NCC's route collectors.
+type ripeStatSource struct {
+	app *App
+}
+
+func (ripeStatSource) Name() string  { return sourceRIPEstat }
+func (ripeStatSource) Label() string { return "RIPEstat" }
+
+// ripeStatGet calls the RIPEstat data call named call, like
+// "announced-prefixes", with query and decodes the response into v. RIPEstat
+// isn't BGPView, so its calls aren't paced or retried like BGPView's.
+func (a *App) ripeStatGet(ctx context.Context, call string, query url.Values, v interface{}) error {
+	query.Set("sourceapp", "ipv6request")
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, a.cfg.RIPEstatBase+"/data/"+call+"/data.json?"+query.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("User-Agent", a.userAgent())
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return markError(ErrUpstreamUnavailable, fmt.Errorf("RIPEstat %s request failed: %w", call, err))
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return statusError(resp.StatusCode, fmt.Errorf("RIPEstat %s API returned status %d", call, resp.StatusCode))
+	}
+	if err := a.decodeJSON(resp, v); err != nil {
+		return fmt.Errorf("failed to parse RIPEstat %s response: %w", call, err)
+	}
+	return nil
+}
+
+// FetchPrefixes returns the prefixes RIPEstat saw asn announce over the last
+// two weeks. RIPEstat doesn't give their countries.
+func (s ripeStatSource) FetchPrefixes(ctx context.Context, asn string) (allPrefixes, error) {
+	var data ripeStatPrefixesData
+	if err := s.app.ripeStatGet(ctx, "announced-prefixes", url.Values{"resource": {"AS" + asn}}, &data); err != nil {
+		return allPrefixes{}, err
+	}
+	var all allPrefixes
+	for _, p := range data.Data.Prefixes {
+		if strings.Contains(p.Prefix, ":") {
+			all.IPv6 = append(all.IPv6, p.Prefix)
+		} else {
+			all.IPv4 = append(all.IPv4, p.Prefix)
+		}
+	}
+	return all, nil
+}
+
+// FetchASNDetails returns the name and description of the holder of asn and
+// the RIR it was assigned by, which is all RIPEstat's AS overview has.
+func (s ripeStatSource) FetchASNDetails(ctx context.Context, asn string) (*ASNDetails, error) {
+	var data ripeStatOverviewData
+	if err := s.app.ripeStatGet(ctx, "as-overview", url.Values{"resource": {"AS" + asn}}, &data); err != nil {
+		return nil, err
+	}
+	if data.Data.Holder == "" {
+		return nil, markError(ErrASNNotFound, fmt.Errorf("RIPEstat has no record of ASN %s", asn))
+	}
+	// Holders are written like "RIPE-NCC-AS - Reseaux IP Europeens ..."
+	name, description, _ := strings.Cut(data.Data.Holder, " - ")
+	details := &ASNDetails{
+		ASN:              asn,
+		Name:             name,
+		DescriptionShort: description,
+	}
+	for registry, rir := range ripeStatRIRs {
+		if strings.HasSuffix(data.Data.Block.Desc, " "+registry) {
+			details.RIRAllocation = rir
+		}
+	}
+	return details, nil
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+	"strings"
+)
+
+// staticFiles holds the stylesheet, script and favicon served under /static/.
+//
+//go:embed static
+var staticFiles embed.FS
+
+// newRouter returns the mux serving every route of the web interface. Paths
+// not registered here get a 404 rather than the form, so that browser and
+// crawler probes don't trigger BGPView lookups. Each route names the methods
+// it accepts (GET also allows HEAD); the mux answers any other method with 405
+// and an Allow header. Paths that only differ from a route by case or a
+// trailing slash are served by that route; see withCanonicalPaths.
+func (a *App) newRouter() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /{$}", a.formHandler)
+	mux.HandleFunc("POST /{$}", a.formHandler)
+	mux.HandleFunc("GET /asn/{asn}", a.asnTextHandler)
+	mux.HandleFunc("GET /raw/asn/{asn}", a.rawASNHandler)
+	mux.HandleFunc("GET /dashboard", a.dashboardHandler)
+	mux.HandleFunc("GET /compare", a.compareHandler)
+	mux.HandleFunc("GET /whois", a.whoisHandler)
+	mux.HandleFunc("GET /card", a.cardHandler)
+	mux.HandleFunc("GET /version", versionHandler)
+	mux.HandleFunc("GET /healthz", healthHandler)
+	mux.HandleFunc("GET /favicon.ico", faviconHandler)
+	mux.Handle("GET /static/", staticHandler())
+	// Sending ICMPv6 needs a raw socket, and so root or CAP_NET_RAW,
+	// which is why the reachability check is opt-in
+	if a.cfg.EnablePing {
+		mux.HandleFunc("GET /reachability", a.reachabilityHandler)
+	}
+	if a.cfg.AdminToken != "" {
+		mux.HandleFunc("GET /admin", a.requireAdmin(a.adminHandler))
+		mux.HandleFunc("GET /admin/cache", a.requireAdmin(a.adminCacheHandler))
+		mux.HandleFunc("POST /admin/cache/flush", a.requireAdmin(a.adminFlushHandler))
+	}
+	return withCanonicalPaths(mux)
+}
+
+// withCanonicalPaths serves requests whose path matches no route of mux,
+// like "/ASN/AS19625/", as if the path were in lower case and without
+// trailing slashes. normalizeASN accepts "as" in any case, so guessed URLs
+// work rather than getting a confusing 404, and a guessed URL with the wrong
+// method gets the same 405 as the canonical one.
+func withCanonicalPaths(mux *http.ServeMux) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// A method the route doesn't accept matches no pattern either, so
+		// canonicalize before the mux tells "no route" from "wrong method"
+		if _, pattern := mux.Handler(r); pattern == "" {
+			canonical := strings.ToLower(strings.TrimRight(r.URL.Path, "/"))
+			if canonical == "" {
+				canonical = "/"
+			}
+			if canonical != r.URL.Path {
+				r = r.Clone(r.Context())
+				r.URL.Path = canonical
+				r.URL.RawPath = ""
+			}
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
+
+// staticHandler serves the embedded static assets. Content types are derived
+// from the file extensions by http.FileServer.
+func staticHandler() http.Handler {
+	sub, err := fs.Sub(staticFiles, "static")
+	if err != nil {
+		panic(err)
+	}
+	files := http.StripPrefix("/static/", http.FileServer(http.FS(sub)))
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Don't expose directory listings
+		if strings.HasSuffix(r.URL.Path, "/") {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Cache-Control", "public, max-age=3600")
+		files.ServeHTTP(w, r)
+	})
+}
+
+// faviconHandler serves the embedded favicon.
+func faviconHandler(w http.ResponseWriter, r *http.Request) {
+	favicon, err := staticFiles.ReadFile("static/favicon.ico")
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "image/x-icon")
+	w.Header().Set("Cache-Control", "public, max-age=86400")
+	w.Write(favicon)
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCanonicalPaths(t *testing.T) {
+	router := newTestApp(t, http.NotFoundHandler()).newRouter()
+
+	tests := []struct {
+		method string
+		path   string
+		status int
+	}{
+		{http.MethodGet, "/version", http.StatusOK},
+		{http.MethodGet, "/VERSION/", http.StatusOK},
+		{http.MethodGet, "/Version//", http.StatusOK},
+		{http.MethodPost, "/version", http.StatusMethodNotAllowed},
+		{http.MethodPost, "/Version/", http.StatusMethodNotAllowed},
+		{http.MethodPost, "/Dashboard/", http.StatusMethodNotAllowed},
+		{http.MethodGet, "/Nonexistent/", http.StatusNotFound},
+		{http.MethodPost, "/Nonexistent/", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.path, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(tt.method, tt.path, nil))
+			if w.Code != tt.status {
+				t.Errorf("status = %d, want %d", w.Code, tt.status)
+			}
+		})
+	}
+}
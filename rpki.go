@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxRPKIChecks is how many prefixes of a lookup have their RPKI status
+// checked, as RIPEstat validates one prefix per request. The first ones,
+// which are listed without the "show all" toggle, are checked.
+const maxRPKIChecks = 20
+
+// rpkiConcurrency is how many RPKI statuses of one lookup are fetched at
+// once.
+const rpkiConcurrency = 5
+
+// RPKI validation statuses of a route, as named by RFC 6811.
+const (
+	rpkiValid    = "Valid"
+	rpkiInvalid  = "Invalid"
+	rpkiNotFound = "NotFound"
+)
+
+// ripeStatRPKIData is the RIPEstat rpki-validation API response.
+type ripeStatRPKIData struct {
+	Data struct {
+		Status string `json:"status"`
+	} `json:"data"`
+}
+
+// annotateRPKI sets the RPKIStatus of the first maxRPKIChecks prefixes, as
+// originated by asn. Prefixes whose status can't be looked up are left
+// unannotated.
+func (a *App) annotateRPKI(ctx context.Context, asn string, prefixes []GeoPrefix) {
+	slots := make(chan struct{}, rpkiConcurrency)
+	var wg sync.WaitGroup
+	for i := range prefixes[:min(len(prefixes), maxRPKIChecks)] {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			slots <- struct{}{}
+			defer func() { <-slots }()
+			status, err := a.lookupRPKIStatus(ctx, asn, prefixes[i].Prefix)
+			if err != nil {
+				a.logDebugf("RPKI lookup of %s from AS%s failed: %v", prefixes[i].Prefix, asn, err)
+				return
+			}
+			prefixes[i].RPKIStatus = status
+		}()
+	}
+	wg.Wait()
+}
+
+// lookupRPKIStatus returns the RPKI validation status of prefix originated
+// by asn: rpkiValid, rpkiInvalid or rpkiNotFound.
+func (a *App) lookupRPKIStatus(ctx context.Context, asn, prefix string) (string, error) {
+	key := cacheKey(sourceRIPEstat, "rpki", asn+"_"+prefix)
+	if !cacheBypassed(ctx) {
+		if status, _, found := cacheGetAs[string](a.cache, key); found {
+			return status, nil
+		}
+	}
+
+	v, err := a.lookups.Do(ctx, key, func(ctx context.Context) (interface{}, error) {
+		status, err := a.fetchRPKIStatus(ctx, asn, prefix)
+		if err != nil {
+			return nil, err
+		}
+		a.cache.Set(key, status, time.Hour)
+		return status, nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return v.(string), nil
+}
+
+// fetchRPKIStatus asks RIPEstat's rpki-validation API, which checks the
+// route against the ROAs of all five RIRs' trust anchors.
+func (a *App) fetchRPKIStatus(ctx context.Context, asn, prefix string) (string, error) {
+	var rpki ripeStatRPKIData
+	query := url.Values{"resource": {"AS" + asn}, "prefix": {prefix}}
+	if err := a.ripeStatGet(ctx, "rpki-validation", query, &rpki); err != nil {
+		return "", err
+	}
+	switch status := rpki.Data.Status; {
+	case status == "valid":
+		return rpkiValid, nil
+	case strings.HasPrefix(status, "invalid"): // also invalid_asn, invalid_length
+		return rpkiInvalid, nil
+	case status == "unknown":
+		return rpkiNotFound, nil
+	default:
+		return "", fmt.Errorf("unexpected RPKI status %q for %s", status, prefix)
+	}
+}
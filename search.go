@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxSearchQueryLength bounds the network name search input.
+const maxSearchQueryLength = 64
+
+// bgpViewSearchData represents the structure of the JSON response from
+// BGPView API for a search.
+type bgpViewSearchData struct {
+	Data struct {
+		ASNs []struct {
+			ASN         int    `json:"asn"`
+			Name        string `json:"name"`
+			Description string `json:"description"`
+			CountryCode string `json:"country_code"`
+		} `json:"asns"`
+	} `json:"data"`
+}
+
+// ASNSearchResult is an ASN matching a name search.
+type ASNSearchResult struct {
+	ASN         string
+	Name        string
+	Description string
+	CountryCode string
+}
+
+// cacheGetSearch returns the cached results of a name search from source,
+// and their age.
+func (a *App) cacheGetSearch(source, query string) ([]ASNSearchResult, time.Duration, bool) {
+	return cacheGetAs[[]ASNSearchResult](a.cache, cacheKey(source, "search", query))
+}
+
+// cacheSetSearch caches the results of a name search from source.
+func (a *App) cacheSetSearch(source, query string, results []ASNSearchResult, ttl time.Duration) {
+	a.cache.Set(cacheKey(source, "search", query), results, ttl)
+}
+
+// normalizeSearchQuery validates a network name search and returns it in
+// the form used for lookups and cache keys.
+func normalizeSearchQuery(input string) (string, error) {
+	query := strings.ToLower(strings.TrimSpace(input))
+	if query == "" {
+		return "", errors.New("please enter a network name to search for")
+	}
+	if len(query) > maxSearchQueryLength {
+		return "", fmt.Errorf("search term is too long (at most %d characters)", maxSearchQueryLength)
+	}
+	return query, nil
+}
+
+// searchASN queries the BGPView API for ASNs whose name or description
+// matches query, which must have been normalized with normalizeSearchQuery.
+func (a *App) searchASN(ctx context.Context, query string) ([]ASNSearchResult, error) {
+	// Check cache first
+	if results, _, found := a.cacheGetSearch(sourceBGPView, query); found {
+		return results, nil
+	}
+
+	// Collapse concurrent identical searches into one upstream call
+	v, err := a.lookups.Do(ctx, cacheKey(sourceBGPView, "search", query), func(ctx context.Context) (interface{}, error) {
+		return a.fetchSearch(ctx, query)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.([]ASNSearchResult), nil
+}
+
+// fetchSearch runs a name search against BGPView and caches the results.
+func (a *App) fetchSearch(ctx context.Context, query string) ([]ASNSearchResult, error) {
+	bgpURL := fmt.Sprintf("%s/search?query_term=%s", a.cfg.BGPViewBase, url.QueryEscape(query))
+
+	resp, err := a.retryWithBackoff(ctx, func(ctx context.Context) (*http.Response, error) {
+		return a.httpGet(ctx, bgpURL)
+	}, 3, upstreamRetryBudget)
+
+	if err != nil {
+		return nil, markError(ErrUpstreamUnavailable, fmt.Errorf("BGPView search API request failed: %w", err))
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		if resp.StatusCode == 429 {
+			return nil, markError(ErrRateLimited, fmt.Errorf("BGPView API rate limit exceeded while searching for %q. Please try again in a few minutes", query))
+		}
+		return nil, statusError(resp.StatusCode, fmt.Errorf("BGPView search API returned status %d for %q", resp.StatusCode, query))
+	}
+
+	var bgpSearch bgpViewSearchData
+	if err := a.decodeJSON(resp, &bgpSearch); err != nil {
+		return nil, fmt.Errorf("failed to parse BGPView search response for %q: %w", query, err)
+	}
+
+	results := make([]ASNSearchResult, 0, len(bgpSearch.Data.ASNs))
+	for _, a := range bgpSearch.Data.ASNs {
+		results = append(results, ASNSearchResult{
+			ASN:         strconv.Itoa(a.ASN),
+			Name:        a.Name,
+			Description: a.Description,
+			CountryCode: a.CountryCode,
+		})
+	}
+
+	// Search results only need to last while the user picks one
+	a.cacheSetSearch(sourceBGPView, query, results, 10*time.Minute)
+
+	return results, nil
+}
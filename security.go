@@ -0,0 +1,26 @@
+package main
+
+import "net/http"
+
+// contentSecurityPolicy only allows resources served by this application.
+// Inline scripts, inline styles and framing are all forbidden, so the
+// template must keep its CSS and JS in /static/.
+const contentSecurityPolicy = "default-src 'self'; " +
+	"script-src 'self'; " +
+	"style-src 'self'; " +
+	"img-src 'self' data:; " +
+	"form-action 'self'; " +
+	"frame-ancestors 'none'; " +
+	"base-uri 'none'"
+
+// withSecurityHeaders sets basic hardening headers on every response.
+func withSecurityHeaders(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header := w.Header()
+		header.Set("Content-Security-Policy", contentSecurityPolicy)
+		header.Set("X-Content-Type-Options", "nosniff")
+		header.Set("Referrer-Policy", "strict-origin-when-cross-origin")
+		header.Set("X-Frame-Options", "DENY")
+		h.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"runtime/debug"
+	"sync"
+)
+
+// flightTimeout bounds a lookup run by flightGroup.Do: the retry budget of
+// its upstream requests and some time queued for their turn.
+const flightTimeout = upstreamRetryBudget + upstreamTimeout
+
+// flightGroup collapses concurrent calls that share a key into a single
+// execution whose result is handed to every caller, in the manner of
+// golang.org/x/sync/singleflight.
+type flightGroup struct {
+	mu    sync.Mutex
+	calls map[string]*flightCall
+}
+
+type flightCall struct {
+	done chan struct{} // closed once val and err are set
+	val  interface{}
+	err  error
+}
+
+// Do runs fn for key unless a call for key is already in flight, and waits
+// for the call's result or for ctx to be done, whichever comes first. fn
+// doesn't run under ctx, since it serves every caller waiting for key: it
+// gets ctx's values, such as a cache bypass, but its own deadline of
+// flightTimeout, so a caller going away doesn't fail the others and the
+// result is still cached for the next.
+func (g *flightGroup) Do(ctx context.Context, key string, fn func(ctx context.Context) (interface{}, error)) (interface{}, error) {
+	g.mu.Lock()
+	if g.calls == nil {
+		g.calls = make(map[string]*flightCall)
+	}
+	c, ok := g.calls[key]
+	if !ok {
+		c = &flightCall{done: make(chan struct{})}
+		g.calls[key] = c
+		go g.run(ctx, key, c, fn)
+	}
+	g.mu.Unlock()
+
+	select {
+	case <-c.done:
+		return c.val, c.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// run makes call c for key with fn, then hands its result to the callers.
+func (g *flightGroup) run(ctx context.Context, key string, c *flightCall, fn func(ctx context.Context) (interface{}, error)) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), flightTimeout)
+	defer func() {
+		cancel()
+		if r := recover(); r != nil {
+			log.Printf("Lookup %s panicked: %v\n%s", key, r, debug.Stack())
+			c.val, c.err = nil, fmt.Errorf("lookup %s failed unexpectedly", key)
+		}
+		g.mu.Lock()
+		delete(g.calls, key)
+		g.mu.Unlock()
+		close(c.done)
+	}()
+
+	c.val, c.err = fn(ctx)
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// blockingPrefixes serves bgpViewPrefixes19625 once release is closed,
+// counting the requests in hits and signalling each on started.
+func blockingPrefixes(hits *atomic.Int32, started chan<- struct{}, release <-chan struct{}) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/asn/19625/prefixes" {
+			http.NotFound(w, r)
+			return
+		}
+		hits.Add(1)
+		started <- struct{}{}
+		<-release
+		w.Write([]byte(bgpViewPrefixes19625))
+	})
+}
+
+func TestConcurrentLookupsShareOneRequest(t *testing.T) {
+	var hits atomic.Int32
+	started, release := make(chan struct{}, 10), make(chan struct{})
+	a := newTestApp(t, blockingPrefixes(&hits, started, release))
+
+	const callers = 10
+	var wg sync.WaitGroup
+	errs := make(chan error, callers)
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			prefixes, err := a.lookupIPv6(context.Background(), "19625")
+			if err == nil && len(prefixes) != 2 {
+				err = errors.New("wrong prefixes")
+			}
+			errs <- err
+		}()
+	}
+	<-started
+	close(release)
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Errorf("lookup failed: %v", err)
+		}
+	}
+	if got := hits.Load(); got != 1 {
+		t.Errorf("%d upstream requests for %d concurrent lookups, want 1", got, callers)
+	}
+}
+
+func TestLookupOutlivesCancelledCaller(t *testing.T) {
+	var hits atomic.Int32
+	started, release := make(chan struct{}, 10), make(chan struct{})
+	a := newTestApp(t, blockingPrefixes(&hits, started, release))
+
+	// The first caller starts the lookup and then goes away
+	ctx, cancel := context.WithCancel(context.Background())
+	first := make(chan error, 1)
+	go func() {
+		_, err := a.lookupIPv6(ctx, "19625")
+		first <- err
+	}()
+	<-started
+
+	// A second caller waits for the same lookup
+	second := make(chan error, 1)
+	go func() {
+		_, err := a.lookupIPv6(context.Background(), "19625")
+		second <- err
+	}()
+
+	cancel()
+	if err := <-first; !errors.Is(err, context.Canceled) {
+		t.Errorf("cancelled caller got %v, want context.Canceled", err)
+	}
+	close(release)
+	if err := <-second; err != nil {
+		t.Errorf("waiting caller failed: %v", err)
+	}
+
+	// The result was cached despite the first caller going away
+	if _, err := a.lookupIPv6(context.Background(), "19625"); err != nil {
+		t.Errorf("later lookup failed: %v", err)
+	}
+	if got := hits.Load(); got != 1 {
+		t.Errorf("%d upstream requests, want 1", got)
+	}
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// startupCheckASN is a long-established ASN that always announces IPv6, used
+// to check that BGPView is reachable at startup.
+const startupCheckASN = "13335"
+
+// startupCheckTimeout bounds the startup connectivity check.
+const startupCheckTimeout = 15 * time.Second
+
+// startupCheck looks up startupCheckASN to confirm that BGPView can be
+// reached, so that blocked egress or a wrong -bgpview-base is reported when
+// the server starts rather than on the first user's lookup.
+func (a *App) startupCheck(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, startupCheckTimeout)
+	defer cancel()
+
+	start := time.Now()
+	prefixes, err := a.lookupIPv6(ctx, startupCheckASN)
+	if err != nil {
+		return fmt.Errorf("looking up AS%s at %s: %w", startupCheckASN, a.cfg.BGPViewBase, err)
+	}
+	if len(prefixes) == 0 {
+		return fmt.Errorf("AS%s unexpectedly has no IPv6 prefixes at %s", startupCheckASN, a.cfg.BGPViewBase)
+	}
+	a.logInfof("Startup check passed: BGPView answered in %v", time.Since(start).Round(time.Millisecond))
+	return nil
+}
@@ -0,0 +1,94 @@
+// Toggle collapsible sections
+function toggleCollapsible(element) {
+    element.classList.toggle("active");
+    var content = document.getElementById(element.getAttribute('aria-controls')) || element.nextElementSibling;
+    content.classList.toggle("active");
+
+    var expanded = content.classList.contains("active");
+    element.setAttribute('aria-expanded', expanded ? 'true' : 'false');
+    if (expanded) {
+        content.style.maxHeight = content.scrollHeight + "px";
+    } else {
+        content.style.maxHeight = "0";
+    }
+}
+
+// Show the IPv6 request message, which the server has already rendered into
+// the hidden textarea. Without JavaScript the Generate button submits the
+// form instead and the page comes back with the message shown.
+function generateMessage(button) {
+    document.getElementById('message-container').classList.remove('hidden');
+    button.setAttribute('aria-expanded', 'true');
+
+    // Scroll to the message
+    document.getElementById('message-container').scrollIntoView({ behavior: 'smooth' });
+}
+
+// Copy message to clipboard
+function copyToClipboard(copyBtn) {
+    var messageElement = document.getElementById('generated-message');
+    if (messageElement && messageElement.value) {
+        navigator.clipboard.writeText(messageElement.value).then(function() {
+            // Temporarily change button text to show success
+            var originalText = copyBtn.textContent;
+            copyBtn.textContent = '✅ Copied!';
+            copyBtn.style.backgroundColor = '#28a745';
+
+            setTimeout(function() {
+                copyBtn.textContent = originalText;
+                copyBtn.style.backgroundColor = '#6c757d';
+            }, 2000);
+        }).catch(function(err) {
+            alert('Failed to copy message to clipboard');
+        });
+    } else {
+        alert('Please generate a message first');
+    }
+}
+
+// Wire up event handlers here rather than with inline attributes, which the
+// Content-Security-Policy forbids
+document.addEventListener('DOMContentLoaded', function() {
+    document.querySelectorAll('.collapsible').forEach(function(button) {
+        button.addEventListener('click', function() { toggleCollapsible(button); });
+    });
+
+    var generateBtn = document.getElementById('generate-message');
+    if (generateBtn) {
+        generateBtn.addEventListener('click', function(event) {
+            event.preventDefault();
+            generateMessage(generateBtn);
+        });
+    }
+
+    // Count down the wait while we're rate limited
+    document.querySelectorAll('.retry-countdown').forEach(function(counter) {
+        var seconds = parseInt(counter.dataset.seconds, 10);
+        var timer = setInterval(function() {
+            seconds--;
+            counter.textContent = Math.max(seconds, 0);
+            if (seconds <= 0) {
+                clearInterval(timer);
+            }
+        }, 1000);
+    });
+
+    // Opening a provider's support form also copies the message, ready to
+    // paste into the form
+    var supportLink = document.getElementById('support-form-link');
+    if (supportLink) {
+        supportLink.addEventListener('click', function() {
+            var messageElement = document.getElementById('generated-message');
+            if (messageElement && messageElement.value && navigator.clipboard) {
+                navigator.clipboard.writeText(messageElement.value);
+            }
+        });
+    }
+
+    // Copying needs JavaScript, so the button is only shown with it
+    var copyBtn = document.getElementById('copy-message');
+    if (copyBtn) {
+        copyBtn.hidden = false;
+        copyBtn.addEventListener('click', function() { copyToClipboard(copyBtn); });
+    }
+});
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// supportForm is a provider that takes requests through a web form rather
+// than email, as configured with -support-forms-file.
+type supportForm struct {
+	ASNs     []uint32 `json:"asns"`
+	Provider string   `json:"provider"`
+	// URL is the form's address. "{asn}", "{subject}" and "{message}" in it
+	// are replaced with the query-escaped ASN, subject and message, for
+	// forms that can be pre-filled from the URL.
+	URL string `json:"url"`
+}
+
+// SupportFormLink is a provider's support form, pre-filled where possible,
+// for the results page.
+type SupportFormLink struct {
+	Provider string
+	URL      string
+}
+
+// loadSupportForms reads the JSON array of support forms in path and returns
+// them keyed by ASN.
+func loadSupportForms(path string) (map[string]supportForm, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read support forms: %w", err)
+	}
+	var list []supportForm
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, fmt.Errorf("failed to parse support forms %s: %w", path, err)
+	}
+
+	forms := make(map[string]supportForm)
+	for i, f := range list {
+		if f.Provider == "" || len(f.ASNs) == 0 {
+			return nil, fmt.Errorf("support form %d in %s needs a provider and asns", i+1, path)
+		}
+		u, err := url.Parse(f.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("support form %d in %s needs an http or https url", i+1, path)
+		}
+		for _, asn := range f.ASNs {
+			forms[strconv.FormatUint(uint64(asn), 10)] = f
+		}
+	}
+	return forms, nil
+}
+
+// supportFormLink returns the support form for asn pre-filled with message,
+// or nil if the provider has no configured form.
+func (a *App) supportFormLink(asn, message string) *SupportFormLink {
+	f, ok := a.supportForms[asn]
+	if !ok {
+		return nil
+	}
+	fill := strings.NewReplacer(
+		"{asn}", url.QueryEscape(asn),
+		"{subject}", url.QueryEscape(fmt.Sprintf("IPv6 support request for AS%s", asn)),
+		"{message}", url.QueryEscape(message),
+	)
+	return &SupportFormLink{Provider: f.Provider, URL: fill.Replace(f.URL)}
+}
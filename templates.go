@@ -0,0 +1,47 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"path/filepath"
+)
+
+// parseTemplateFile parses the index template from path.
+func parseTemplateFile(path string) (*template.Template, error) {
+	tmpl, err := template.New("index").ParseFiles(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse template %s: %w", path, err)
+	}
+	// ParseFiles names the template after the file; execute that one
+	return tmpl.Lookup(filepath.Base(path)), nil
+}
+
+// loadTemplate parses the template the web interface is rendered with: the
+// built-in indexTemplateHTML, or -template-file, so that a broken template
+// is reported at startup rather than on the first request.
+func (a *App) loadTemplate() error {
+	path := a.cfg.TemplateFile
+	if path == "" {
+		tmpl, err := template.New("index").Parse(indexTemplateHTML)
+		a.template = tmpl
+		return err
+	}
+	tmpl, err := parseTemplateFile(path)
+	if err != nil {
+		return err
+	}
+	a.template = tmpl
+	if a.cfg.Dev {
+		a.logInfof("Dev mode: reloading template %s on every request", path)
+	}
+	return nil
+}
+
+// pageTemplate returns the template used to render the web interface. In
+// dev mode -template-file is re-parsed on every call so edits show up live.
+func (a *App) pageTemplate() (*template.Template, error) {
+	if a.cfg.Dev && a.cfg.TemplateFile != "" {
+		return parseTemplateFile(a.cfg.TemplateFile)
+	}
+	return a.template, nil
+}
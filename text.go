@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// hasTextSuffix reports whether path ends in ".txt", in any case, as the
+// paths withCanonicalPaths lowercases do by the time they're routed.
+func hasTextSuffix(path string) bool {
+	return len(path) >= len(".txt") && strings.EqualFold(path[len(path)-len(".txt"):], ".txt")
+}
+
+// wantsPlainText reports whether the client asked for the text rendering of
+// an ASN, either with a .txt path or an Accept header naming text/plain.
+func wantsPlainText(r *http.Request) bool {
+	if hasTextSuffix(r.URL.Path) {
+		return true
+	}
+	for _, accept := range strings.Split(r.Header.Get("Accept"), ",") {
+		if mediaType, _, err := mime.ParseMediaType(accept); err == nil && mediaType == "text/plain" {
+			return true
+		}
+	}
+	return false
+}
+
+// asnTextHandler serves /asn/{asn}.txt: the ASN's details and IPv6 prefixes
+// as an aligned, whois-style text block for use with curl.
+func (a *App) asnTextHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+
+	if !wantsPlainText(r) {
+		w.WriteHeader(http.StatusNotAcceptable)
+		fmt.Fprintln(w, "Only a text/plain representation is available; request /asn/{asn}.txt")
+		return
+	}
+
+	asn := r.PathValue("asn")
+	if hasTextSuffix(asn) {
+		asn = asn[:len(asn)-len(".txt")]
+	}
+	asn, err := normalizeASN(asn)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "%% Error: %v\n", err)
+		return
+	}
+	if err := a.checkASNPermitted(asn); err != nil {
+		w.WriteHeader(http.StatusForbidden)
+		fmt.Fprintf(w, "%% Error: %v\n", err)
+		return
+	}
+	if err := checkRoutableASN(asn); err != nil {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		fmt.Fprintf(w, "%% %v\n", err)
+		return
+	}
+
+	ctx, _, _ := a.refreshContext(w, r)
+
+	var (
+		details             *ASNDetails
+		prefixes            []string
+		detailsErr, prefErr error
+		wg                  sync.WaitGroup
+	)
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		details, detailsErr = a.lookupASNDetails(ctx, asn)
+	}()
+	go func() {
+		defer wg.Done()
+		prefixes, prefErr = a.lookupIPv6(ctx, asn)
+	}()
+	wg.Wait()
+
+	if prefErr != nil {
+		setRetryAfter(w, prefErr)
+		w.WriteHeader(lookupErrorStatus(prefErr))
+		fmt.Fprintf(w, "%% Error: %v\n", prefErr)
+		return
+	}
+	if detailsErr != nil {
+		details = nil
+	}
+	writeASNText(w, asn, details, prefixes)
+}
+
+// writeASNText writes the text rendering of an ASN. Fields that are unknown
+// are left out.
+func writeASNText(w io.Writer, asn string, details *ASNDetails, prefixes []string) {
+	field := func(name, value string) {
+		if value != "" {
+			fmt.Fprintf(w, "%-16s%s\n", name+":", value)
+		}
+	}
+
+	field("asn", "AS"+asn)
+	if details != nil {
+		field("as-name", details.Name)
+		field("descr", details.DescriptionShort)
+		country := details.CountryCode
+		if name := details.CountryName(); name != "" {
+			country += " (" + name + ")"
+		}
+		field("country", country)
+		field("website", details.Website)
+		for _, email := range details.AbuseContacts {
+			field("abuse-c", email)
+		}
+		for _, email := range details.EmailContacts {
+			field("e-mail", email)
+		}
+		field("rir", details.RIRAllocation)
+		field("last-modified", details.DateUpdated)
+	}
+	field("ipv6-readiness", ipv6Readiness(prefixes))
+	field("ipv6-prefixes", fmt.Sprint(len(prefixes)))
+	for _, prefix := range prefixes {
+		field("route6", prefix)
+	}
+}
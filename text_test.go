@@ -0,0 +1,46 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestASNTextHandlerSuffixCase(t *testing.T) {
+	a := newTestApp(t, bgpViewStub(map[string]string{
+		"/asn/19625":          bgpViewASN19625,
+		"/asn/19625/prefixes": bgpViewPrefixes19625,
+	}))
+	router := a.newRouter()
+
+	tests := []struct {
+		path   string
+		accept string
+		status int
+	}{
+		{"/asn/19625.txt", "", http.StatusOK},
+		{"/asn/19625.TXT", "", http.StatusOK},
+		{"/ASN/19625.TXT", "", http.StatusOK},
+		{"/asn/AS19625.Txt", "", http.StatusOK},
+		{"/asn/19625", "text/plain", http.StatusOK},
+		{"/asn/19625", "text/html", http.StatusNotAcceptable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path+" "+tt.accept, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.accept != "" {
+				r.Header.Set("Accept", tt.accept)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, r)
+
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d; body:\n%s", w.Code, tt.status, w.Body)
+			}
+			if tt.status == http.StatusOK && !strings.Contains(w.Body.String(), "2001:db8::/32") {
+				t.Errorf("body lacks the prefixes:\n%s", w.Body)
+			}
+		})
+	}
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// errUpstreamBusy is returned when no upstream request slot frees up in time.
+var errUpstreamBusy = errors.New("too many lookups in progress; please try again shortly")
+
+// defaultMaxUpstream is the number of BGPView requests an App may have in
+// flight at once unless -max-upstream-concurrency says otherwise.
+const defaultMaxUpstream = 8
+
+// upstreamAcquireTimeout is how long a request waits for a free slot before
+// giving up with errUpstreamBusy.
+var upstreamAcquireTimeout = 2 * time.Second
+
+// defaultUpstreamMinInterval and defaultUpstreamBurst set BGPView's request
+// budget unless -upstream-min-interval and -upstream-burst say otherwise: one
+// request a second on average, with a burst large enough for all the
+// lookups of a single page to go out at once.
+const (
+	defaultUpstreamMinInterval = time.Second
+	defaultUpstreamBurst       = 5
+)
+
+// upstreamPacer is the queue every BGPView request of an App waits in for
+// its turn, whichever handler, batch worker or watcher makes it. It is a
+// token bucket refilled by one token per interval up to burst: a request
+// takes a token, or reserves the next one to be added and waits for it, so
+// requests go out in the order they asked and never faster than the budget
+// allows. While BGPView is rate limiting us, no turns are handed out at all.
+type upstreamPacer struct {
+	interval time.Duration
+	burst    int
+
+	mu     sync.Mutex
+	tokens float64   // negative when turns are reserved ahead
+	last   time.Time // when tokens was last brought up to date
+}
+
+// newUpstreamPacer returns a pacer allowing one request per interval on
+// average and up to burst at once. An interval of 0 disables pacing.
+func newUpstreamPacer(interval time.Duration, burst int) *upstreamPacer {
+	burst = max(burst, 1)
+	return &upstreamPacer{
+		interval: max(interval, 0),
+		burst:    burst,
+		tokens:   float64(burst),
+		last:     time.Now(),
+	}
+}
+
+// refill brings p.tokens up to date. p.mu must be held.
+func (p *upstreamPacer) refill(now time.Time) {
+	p.tokens = min(p.tokens+float64(now.Sub(p.last))/float64(p.interval), float64(p.burst))
+	p.last = now
+}
+
+// wait takes the request's turn, sleeping until it comes. A request whose
+// turn would come after ctx's deadline gives up at once without taking it,
+// with ErrRateLimited while BGPView is rate limiting us and errUpstreamBusy
+// otherwise, and one cancelled while waiting gives its turn back.
+func (p *upstreamPacer) wait(ctx context.Context) error {
+	if p.interval == 0 {
+		return nil
+	}
+
+	p.mu.Lock()
+	now := time.Now()
+	p.refill(now)
+	var delay time.Duration
+	if p.tokens < 1 {
+		delay = time.Duration((1 - p.tokens) * float64(p.interval))
+	}
+	if deadline, ok := ctx.Deadline(); ok && now.Add(delay).After(deadline) {
+		p.mu.Unlock()
+		if wait := bgpViewRateLimit.RetryAfter(); wait > 0 {
+			return markError(ErrRateLimited, fmt.Errorf("BGPView is rate limiting us for another %v", wait.Round(time.Second)))
+		}
+		return errUpstreamBusy
+	}
+	p.tokens--
+	p.mu.Unlock()
+
+	if delay == 0 {
+		return nil
+	}
+	if err := sleepContext(ctx, delay); err != nil {
+		// Give the turn back for the requests still waiting
+		p.mu.Lock()
+		p.refill(time.Now())
+		p.tokens = min(p.tokens+1, float64(p.burst))
+		p.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// pause hands out no turns for d, as when BGPView has told us to back off
+// with a 429. Turns reserved before the pause keep their times.
+func (p *upstreamPacer) pause(d time.Duration) {
+	if p.interval == 0 || d <= 0 {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.refill(time.Now())
+	p.tokens = min(p.tokens, 0) - float64(d)/float64(p.interval)
+}
+
+// upstreamLimiter holds back an App's BGPView requests: each waits for its
+// turn under pace, then for one of slots, which bound the number in flight
+// at once. A request holds its slot from sending until its response body is
+// closed.
+type upstreamLimiter struct {
+	slots chan struct{}
+	pace  *upstreamPacer
+}
+
+// newUpstreamLimiter returns a limiter allowing up to concurrency requests
+// in flight, paced by interval and burst as newUpstreamPacer describes.
+func newUpstreamLimiter(concurrency int, interval time.Duration, burst int) *upstreamLimiter {
+	return &upstreamLimiter{
+		slots: make(chan struct{}, max(concurrency, 1)),
+		pace:  newUpstreamPacer(interval, burst),
+	}
+}
+
+// acquire waits for the request's turn, then for a free slot, and returns
+// the function that gives the slot back.
+func (l *upstreamLimiter) acquire(ctx context.Context) (func(), error) {
+	if err := l.pace.wait(ctx); err != nil {
+		return nil, err
+	}
+
+	timer := time.NewTimer(upstreamAcquireTimeout)
+	defer timer.Stop()
+
+	select {
+	case l.slots <- struct{}{}:
+		var once sync.Once
+		return func() { once.Do(func() { <-l.slots }) }, nil
+	case <-timer.C:
+		return nil, errUpstreamBusy
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// releasingBody releases an upstream slot when the response body is closed.
+type releasingBody struct {
+	io.ReadCloser
+	release func()
+}
+
+func (b releasingBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.release()
+	return err
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestUpstreamPacerBurst(t *testing.T) {
+	p := newUpstreamPacer(time.Hour, 2)
+
+	// The burst goes out at once
+	for i := 0; i < 2; i++ {
+		if err := p.wait(context.Background()); err != nil {
+			t.Fatalf("request %d of the burst: %v", i+1, err)
+		}
+	}
+
+	// The next would wait an hour, past its deadline, so it gives up at
+	// once without taking the turn
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	for i := 0; i < 2; i++ {
+		if err := p.wait(ctx); !errors.Is(err, errUpstreamBusy) {
+			t.Errorf("request after the burst: got %v, want %v", err, errUpstreamBusy)
+		}
+	}
+	if p.tokens < -0.01 {
+		t.Errorf("%.2f tokens after requests that gave up, want none taken", p.tokens)
+	}
+}
+
+func TestUpstreamPacerCancelledWaitRefunds(t *testing.T) {
+	p := newUpstreamPacer(time.Hour, 1)
+	if err := p.wait(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// A request waiting for its turn is cancelled, with no deadline to
+	// give up on beforehand
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- p.wait(ctx) }()
+	time.Sleep(20 * time.Millisecond)
+	cancel()
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("cancelled wait: got %v, want %v", err, context.Canceled)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("cancelled wait didn't return")
+	}
+
+	// Its turn is given back rather than pushing later requests back
+	p.mu.Lock()
+	tokens := p.tokens
+	p.mu.Unlock()
+	if tokens < -0.01 {
+		t.Errorf("%.2f tokens after the cancelled wait, want its turn back", tokens)
+	}
+}
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// watchDelay separates the lookups of consecutive watched ASNs, so that a
+// long watch list doesn't exceed BGPView's rate limit.
+const watchDelay = 2 * time.Second
+
+// watchStatus is the last known IPv6 status of a watched ASN.
+type watchStatus struct {
+	ASN         string
+	Name        string
+	PrefixCount int
+	HasIPv6     bool
+	CheckedAt   time.Time // zero until the first check completes
+	Error       string
+}
+
+// watcher refreshes the status of a fixed list of ASNs in the background.
+type watcher struct {
+	app      *App
+	asns     []string
+	interval time.Duration
+	state    *watchState
+
+	mu       sync.Mutex
+	statuses map[string]watchStatus
+}
+
+// parseWatchList parses a comma-separated list of ASNs as given to -watch.
+func parseWatchList(list string) ([]string, error) {
+	var asns []string
+	seen := make(map[string]bool)
+	for _, field := range strings.Split(list, ",") {
+		if strings.TrimSpace(field) == "" {
+			continue
+		}
+		asn, err := normalizeASN(field)
+		if err != nil {
+			return nil, err
+		}
+		if err := checkRoutableASN(asn); err != nil {
+			return nil, err
+		}
+		if !seen[asn] {
+			seen[asn] = true
+			asns = append(asns, asn)
+		}
+	}
+	return asns, nil
+}
+
+// useWatchList enables the dashboard for the ASNs in list, refreshing each
+// one every interval once the server runs. Their last known prefix counts
+// are kept in stateFile, if set, so that webhooks survive restarts.
+func (a *App) useWatchList(list string, interval time.Duration, stateFile string) error {
+	asns, err := parseWatchList(list)
+	if err != nil {
+		return err
+	}
+	if len(asns) == 0 {
+		return nil
+	}
+	if interval < time.Duration(len(asns))*watchDelay {
+		return fmt.Errorf("a -watch-interval of %v is too short to check %d ASNs", interval, len(asns))
+	}
+	state, err := loadWatchState(stateFile)
+	if err != nil {
+		return err
+	}
+	a.watchlist = &watcher{
+		app:      a,
+		asns:     asns,
+		interval: interval,
+		state:    state,
+		statuses: make(map[string]watchStatus),
+	}
+	a.logInfof("Watching %d ASNs, refreshed every %v", len(asns), interval)
+	return nil
+}
+
+// run checks every watched ASN now and then every interval until ctx is
+// done. Checks bypass the cache, so the watched ASNs stay warm in it for
+// ordinary lookups too.
+func (w *watcher) run(ctx context.Context) {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+	for {
+		w.checkAll(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// checkAll checks each watched ASN in turn, watchDelay apart.
+func (w *watcher) checkAll(ctx context.Context) {
+	for i, asn := range w.asns {
+		if i > 0 {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(watchDelay):
+			}
+		}
+		w.check(ctx, asn)
+	}
+}
+
+// check looks up asn and records its status. A failed lookup keeps the
+// previous counts but notes the error. When asn has just gained IPv6 and
+// -webhook-url is set, a notification is sent, and the new count is only
+// recorded once it has been delivered, so that a failed notification is
+// retried on the next check.
+func (w *watcher) check(ctx context.Context, asn string) {
+	prefixes, err := w.app.lookupIPv6(withCacheBypass(ctx), asn)
+
+	// The name rarely changes, so it may come from the cache
+	var name string
+	if err == nil {
+		if details, err := w.app.lookupASNDetails(ctx, asn); err == nil {
+			name = details.Name
+		}
+	}
+
+	w.record(asn, name, prefixes, err)
+	if err != nil {
+		return
+	}
+
+	if w.state.gained(asn, len(prefixes)) {
+		w.app.logInfof("Watch: ASN %s now announces %d IPv6 prefixes", asn, len(prefixes))
+		if w.app.cfg.WebhookURL != "" {
+			event := ipv6Event{
+				Event:           "ipv6_gained",
+				ASN:             asn,
+				Name:            name,
+				IPv6PrefixCount: len(prefixes),
+				Prefixes:        prefixes,
+				DetectedAt:      time.Now().UTC(),
+			}
+			if err := w.app.sendWebhook(ctx, event); err != nil {
+				log.Printf("Watch: failed to notify that ASN %s gained IPv6, retrying on the next check: %v", asn, err)
+				return
+			}
+		}
+	}
+	if err := w.state.update(asn, len(prefixes)); err != nil {
+		log.Printf("Watch: %v", err)
+	}
+}
+
+// record updates the dashboard status of asn with the result of a check.
+func (w *watcher) record(asn, name string, prefixes []string, err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	status := w.statuses[asn]
+	status.ASN = asn
+	if err != nil {
+		log.Printf("Watch: failed to check ASN %s: %v", asn, err)
+		status.Error = err.Error()
+		w.statuses[asn] = status
+		return
+	}
+	status.PrefixCount = len(prefixes)
+	status.HasIPv6 = len(prefixes) > 0
+	status.CheckedAt = time.Now()
+	status.Error = ""
+	if name != "" {
+		status.Name = name
+	}
+	w.statuses[asn] = status
+}
+
+// snapshot returns the status of every watched ASN in watch-list order.
+func (w *watcher) snapshot() []watchStatus {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	statuses := make([]watchStatus, 0, len(w.asns))
+	for _, asn := range w.asns {
+		status, ok := w.statuses[asn]
+		if !ok {
+			status = watchStatus{ASN: asn}
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
+
+// dashboardTemplate renders the watched ASNs as a table.
+var dashboardTemplate = template.Must(template.New("dashboard").Funcs(template.FuncMap{
+	"ago": func(t time.Time) string {
+		if age := time.Since(t); age >= time.Minute {
+			return age.Round(time.Minute).String() + " ago"
+		}
+		return "just now"
+	},
+}).Parse(`
+<!DOCTYPE html>
+<html>
+<head>
+    <meta charset="utf-8">
+    <title>IPv6 Dashboard</title>
+    <link rel="stylesheet" href="/static/style.css">
+</head>
+<body>
+    <div class="container">
+        <h1>IPv6 Dashboard</h1>
+        <p>Watched networks are checked every {{.Interval}}.</p>
+        <table class="dashboard">
+            <tr><th>ASN</th><th>Name</th><th>IPv6 prefixes</th><th>IPv6</th><th>Last checked</th></tr>
+            {{range .Statuses}}
+            <tr>
+                <td><a href="/?asn={{.ASN}}">AS{{.ASN}}</a></td>
+                <td>{{.Name}}</td>
+                <td>{{if not .CheckedAt.IsZero}}{{.PrefixCount}}{{end}}</td>
+                <td>{{if .CheckedAt.IsZero}}<span class="badge badge-pending">pending</span>{{else if .HasIPv6}}<span class="badge badge-full">✅ IPv6</span>{{else}}<span class="badge badge-none">❌ none</span>{{end}}</td>
+                <td>{{if .CheckedAt.IsZero}}never{{else}}{{ago .CheckedAt}}{{end}}{{if .Error}} <span class="error-note" title="{{.Error}}">⚠️ last check failed</span>{{end}}</td>
+            </tr>
+            {{end}}
+        </table>
+        <p class="footnote"><a href="/">Look up another ASN</a></p>
+    </div>
+</body>
+</html>
+`))
+
+// dashboardHandler serves /dashboard, the status of every watched ASN.
+func (a *App) dashboardHandler(w http.ResponseWriter, r *http.Request) {
+	if a.watchlist == nil {
+		http.Error(w, "No ASNs are being watched; start the server with -watch", http.StatusNotFound)
+		return
+	}
+
+	var buf bytes.Buffer
+	err := dashboardTemplate.Execute(&buf, struct {
+		Interval time.Duration
+		Statuses []watchStatus
+	}{a.watchlist.interval, a.watchlist.snapshot()})
+	if err != nil {
+		log.Printf("Failed to render dashboard: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	buf.WriteTo(w)
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+)
+
+func TestWatcherRetriesFailedWebhook(t *testing.T) {
+	stateFile := filepath.Join(t.TempDir(), "watch-state.json")
+	if err := os.WriteFile(stateFile, []byte(`{"19625": 0}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	var deliveries atomic.Int32
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The first notification fails, the next ones are accepted
+		if deliveries.Add(1) == 1 {
+			http.Error(w, "try later", http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer hook.Close()
+
+	a := newTestApp(t, bgpViewStub(map[string]string{
+		"/asn/19625":          bgpViewASN19625,
+		"/asn/19625/prefixes": bgpViewPrefixes19625,
+	}), "-watch", "19625", "-watch-state-file", stateFile, "-webhook-url", hook.URL)
+
+	steps := []struct {
+		deliveries int32
+		saved      string
+	}{
+		{1, `{"19625": 0}`}, // failed, so the count isn't recorded
+		{2, "{\n  \"19625\": 2\n}"},
+		{2, "{\n  \"19625\": 2\n}"}, // already notified
+	}
+	for i, step := range steps {
+		a.watchlist.check(context.Background(), "19625")
+
+		if got := deliveries.Load(); got != step.deliveries {
+			t.Errorf("check %d: %d webhook deliveries, want %d", i+1, got, step.deliveries)
+		}
+		saved, err := os.ReadFile(stateFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(saved) != step.saved {
+			t.Errorf("check %d: saved state %s, want %s", i+1, saved, step.saved)
+		}
+	}
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// sourceWhois is the cache namespace for whois responses.
+const sourceWhois = "whois"
+
+// whoisCacheTTL is how long a whois response is served from the cache.
+const whoisCacheTTL = 15 * time.Minute
+
+// whoisInterval is how often one client may query /whois.
+const whoisInterval = 5 * time.Second
+
+// ianaWhoisServer is asked which registry holds a resource when the RIR
+// can't be told from the ASN's details.
+const ianaWhoisServer = "whois.iana.org"
+
+// rirWhoisServers maps the RIR names used by BGPView to their whois servers,
+// which are also the only servers an IANA referral is followed to.
+var rirWhoisServers = map[string]string{
+	"ARIN":    "whois.arin.net",
+	"RIPE":    "whois.ripe.net",
+	"APNIC":   "whois.apnic.net",
+	"LACNIC":  "whois.lacnic.net",
+	"AFRINIC": "whois.afrinic.net",
+}
+
+// normalizeWhoisQuery validates q as an ASN, IP address or prefix and returns
+// it in the form sent to whois servers, so that nothing but those reaches
+// them. ASNs are written "AS64500", which every RIR accepts.
+func normalizeWhoisQuery(q string) (query, asn string, err error) {
+	q = strings.TrimSpace(q)
+	if prefix, err := netip.ParsePrefix(q); err == nil {
+		if isNonPublicIP(prefix.Addr().String()) {
+			return "", "", fmt.Errorf("%s is not publicly routed", prefix.Masked())
+		}
+		return prefix.Masked().String(), "", nil
+	}
+	if addr, err := netip.ParseAddr(q); err == nil {
+		if addr.Zone() != "" || isNonPublicIP(addr.String()) {
+			return "", "", fmt.Errorf("%s is not a public address", q)
+		}
+		return addr.Unmap().String(), "", nil
+	}
+	asn, err = normalizeASN(q)
+	if err != nil {
+		return "", "", fmt.Errorf("%q is not an ASN, IP address or prefix", q)
+	}
+	return "AS" + asn, asn, nil
+}
+
+// whoisServerFor returns the whois server holding query. For an ASN it is
+// the one named in the ASN's details; otherwise IANA is asked, and its
+// referral followed if it names an RIR. Failing that, IANA's own answer is
+// used.
+func (a *App) whoisServerFor(ctx context.Context, query, asn string) (server, ianaReply string, err error) {
+	if asn != "" {
+		if details, err := a.lookupASNDetails(ctx, asn); err == nil {
+			if server, ok := knownWhoisServer(details.WhoisServer); ok {
+				return server, "", nil
+			}
+			if server, ok := rirWhoisServers[strings.ToUpper(details.RIRAllocation)]; ok {
+				return server, "", nil
+			}
+		}
+	}
+
+	reply, err := whoisQuery(ctx, ianaWhoisServer, query, a.cfg.MaxBodySize)
+	if err != nil {
+		return "", "", err
+	}
+	scanner := bufio.NewScanner(strings.NewReader(reply))
+	for scanner.Scan() {
+		if name, value, ok := strings.Cut(scanner.Text(), ":"); ok && strings.TrimSpace(name) == "refer" {
+			if server, ok := knownWhoisServer(value); ok {
+				return server, "", nil
+			}
+		}
+	}
+	return ianaWhoisServer, reply, nil
+}
+
+// knownWhoisServer reports whether name is one of rirWhoisServers, which
+// keeps upstream data from pointing whois queries at arbitrary hosts.
+func knownWhoisServer(name string) (string, bool) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	for _, server := range rirWhoisServers {
+		if name == server {
+			return server, true
+		}
+	}
+	return "", false
+}
+
+// lookupWhois returns the registry's whois response for query, which must
+// have been normalized with normalizeWhoisQuery, headed by the server it
+// came from.
+func (a *App) lookupWhois(ctx context.Context, query, asn string) (string, error) {
+	key := cacheKey(sourceWhois, "query", query)
+	if !cacheBypassed(ctx) {
+		if reply, _, found := cacheGetAs[string](a.cache, key); found {
+			return reply, nil
+		}
+	}
+
+	v, err := a.lookups.Do(ctx, key, func(ctx context.Context) (interface{}, error) {
+		server, reply, err := a.whoisServerFor(ctx, query, asn)
+		if err == nil && reply == "" {
+			reply, err = whoisQuery(ctx, server, query, a.cfg.MaxBodySize)
+		}
+		if err != nil {
+			return nil, markError(ErrUpstreamUnavailable, fmt.Errorf("whois query for %s failed: %w", query, err))
+		}
+		reply = fmt.Sprintf("%% Answer from %s\n\n%s", server, reply)
+		a.cache.Set(key, reply, whoisCacheTTL)
+		return reply, nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return v.(string), nil
+}
+
+// whoisQuery sends query to the whois server on port 43 of host and returns
+// its whole response. Responses longer than maxSize are refused.
+func whoisQuery(ctx context.Context, host, query string, maxSize int64) (string, error) {
+	conn, err := dialUpstream(ctx, host+":43")
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+
+	if _, err := io.WriteString(conn, query+"\r\n"); err != nil {
+		return "", err
+	}
+	reply, err := io.ReadAll(io.LimitReader(conn, maxSize+1))
+	if err != nil {
+		return "", err
+	}
+	if int64(len(reply)) > maxSize {
+		return "", fmt.Errorf("%w: whois response from %s", errBodyTooLarge, host)
+	}
+	return string(reply), nil
+}
+
+// whoisHandler serves /whois?q=..., relaying the registry's whois response
+// for an ASN, IP address or prefix as plain text.
+func (a *App) whoisHandler(w http.ResponseWriter, r *http.Request) {
+	query, asn, err := normalizeWhoisQuery(r.URL.Query().Get("q"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if asn != "" {
+		if err := a.checkASNPermitted(asn); err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+	}
+	if wait, ok := a.whoisQueries.Allow(a.clientAddr(r)); !ok {
+		secs := int((wait + time.Second - 1) / time.Second)
+		w.Header().Set("Retry-After", strconv.Itoa(secs))
+		http.Error(w, fmt.Sprintf("Too many whois queries; try again in %d seconds", secs), http.StatusTooManyRequests)
+		return
+	}
+
+	reply, err := a.lookupWhois(r.Context(), query, asn)
+	if err != nil {
+		log.Printf("Whois lookup failed: %v", err)
+		status := http.StatusBadGateway
+		if errors.Is(err, context.DeadlineExceeded) {
+			status = http.StatusGatewayTimeout
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	io.WriteString(w, reply)
+}